@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Financial-Times/content-unroller/content"
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+const defaultConfigPollInterval = 10 * time.Second
+
+// config holds the settings of the service. They are set by the options, and overridden by the settings of the
+// config file, if any.
+type config struct {
+	LogLevel       string                `yaml:"logLevel"`
+	Port           string                `yaml:"port"`
+	APIHost        string                `yaml:"apiHost"`
+	MaxRequestSize int64                 `yaml:"maxRequestSize"`
+	ContentStore   content.ReaderConfig  `yaml:"contentStore"`
+	Limits         content.Limits        `yaml:"limits"`
+	DegradedMode   bool                  `yaml:"degradedMode"`
+	Breaker        breakerConfig         `yaml:"breaker"`
+	Concurrency    concurrencyConfig     `yaml:"concurrency"`
+	Server         serverConfig          `yaml:"server"`
+	Tracing        content.TracingConfig `yaml:"tracing"`
+	// RateLimits, Auth and Rules are the paths of the rate limits, clients and expansion rules files.
+	RateLimits string `yaml:"rateLimits"`
+	Auth       string `yaml:"auth"`
+	APIKeys    string `yaml:"apiKeys"`
+	Rules      string `yaml:"expansionRules"`
+}
+
+type breakerConfig struct {
+	Failures int           `yaml:"failures"`
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+type concurrencyConfig struct {
+	content.ConcurrencyLimits `yaml:",inline"`
+	// InternalMaxInFlight gives the internal content requests their own limits, when set.
+	InternalMaxInFlight int `yaml:"internalMaxInFlight"`
+	InternalMaxQueued   int `yaml:"internalMaxQueued"`
+}
+
+// loadConfig overrides the settings of cfg with the ones of the YAML or JSON config file, and validates them.
+func loadConfig(path string, cfg config) (config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	// an empty file leaves the settings as they are
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return cfg, fmt.Errorf("decoding config from %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return cfg, fmt.Errorf("invalid config in %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (cfg config) validate() error {
+	var errs []error
+	if _, err := logrus.ParseLevel(cfg.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("logLevel: %w", err))
+	}
+	if cfg.Port == "" {
+		errs = append(errs, errors.New("port is not set"))
+	}
+	if cfg.ContentStore.ContentStoreHost == "" {
+		errs = append(errs, errors.New("contentStore.host is not set"))
+	}
+	if cfg.MaxRequestSize <= 0 {
+		errs = append(errs, fmt.Errorf("maxRequestSize must be positive, got %d", cfg.MaxRequestSize))
+	}
+	for name, value := range map[string]int{
+		"limits.maxDepth":                 cfg.Limits.MaxDepth,
+		"limits.maxItems":                 cfg.Limits.MaxItems,
+		"limits.maxFetches":               cfg.Limits.MaxFetches,
+		"breaker.failures":                cfg.Breaker.Failures,
+		"concurrency.maxInFlight":         cfg.Concurrency.MaxInFlight,
+		"concurrency.maxQueued":           cfg.Concurrency.MaxQueued,
+		"concurrency.internalMaxInFlight": cfg.Concurrency.InternalMaxInFlight,
+		"concurrency.internalMaxQueued":   cfg.Concurrency.InternalMaxQueued,
+	} {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %d", name, value))
+		}
+	}
+	for name, value := range map[string]time.Duration{
+		"limits.timeout":             cfg.Limits.Timeout,
+		"breaker.cooldown":           cfg.Breaker.Cooldown,
+		"concurrency.queueTimeout":   cfg.Concurrency.QueueTimeout,
+		"concurrency.retryAfter":     cfg.Concurrency.RetryAfter,
+		"server.readTimeout":         cfg.Server.ReadTimeout,
+		"server.readHeaderTimeout":   cfg.Server.ReadHeaderTimeout,
+		"server.writeTimeout":        cfg.Server.WriteTimeout,
+		"server.idleTimeout":         cfg.Server.IdleTimeout,
+		"server.drainDelay":          cfg.Server.DrainDelay,
+		"server.shutdownGracePeriod": cfg.Server.GracePeriod,
+	} {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %v", name, value))
+		}
+	}
+	exporters := []string{"", content.NoExporter, content.StdoutExporter, content.FileExporter, content.OTLPExporter}
+	if !slices.Contains(exporters, cfg.Tracing.Exporter) {
+		errs = append(errs, fmt.Errorf("unsupported tracing.exporter %q", cfg.Tracing.Exporter))
+	}
+	if cfg.Auth != "" && cfg.APIKeys != "" {
+		errs = append(errs, errors.New("only one of auth and apiKeys can be set"))
+	}
+	// sorted, so that the same config always gets the same error
+	slices.SortFunc(errs, func(a, b error) int { return strings.Compare(a.Error(), b.Error()) })
+	return errors.Join(errs...)
+}
+
+// withReloadable returns cfg with the settings which are applied without restarting taken from next.
+func (cfg config) withReloadable(next config) config {
+	cfg.LogLevel = next.LogLevel
+	cfg.Limits = next.Limits
+	cfg.DegradedMode = next.DegradedMode
+	return cfg
+}
+
+// reloader applies the settings of the config file which are safe to change while the service runs, whenever the
+// file changes or the service gets a SIGHUP.
+type reloader struct {
+	path string
+	// options are the settings set by the options, which the config file overrides.
+	options config
+	current config
+	apply   func(config)
+	log     *logger.UPPLogger
+	modTime time.Time
+}
+
+func newReloader(path string, options config, current config, apply func(config), log *logger.UPPLogger) *reloader {
+	rl := &reloader{path: path, options: options, current: current, apply: apply, log: log}
+	if info, err := os.Stat(path); err == nil {
+		rl.modTime = info.ModTime()
+	}
+	return rl
+}
+
+// reload applies the reloadable settings of the config file. Invalid files are ignored, and changes to the other
+// settings are only logged, as they need a restart.
+func (rl *reloader) reload() {
+	next, err := loadConfig(rl.path, rl.options)
+	if err != nil {
+		rl.log.WithError(err).Error("Keeping the current config")
+		return
+	}
+	if rl.current.withReloadable(next) != next {
+		rl.log.Warn("Only logLevel, limits and degradedMode are reloaded, restart the service to apply the other changes to the config")
+	}
+	rl.current = rl.current.withReloadable(next)
+	rl.apply(rl.current)
+	rl.log.Infof("Reloaded config from %s", rl.path)
+}
+
+// watch reloads the config file on every signal received on hup, and whenever its modification time changes,
+// checked every interval, until done is closed.
+func (rl *reloader) watch(interval time.Duration, hup <-chan os.Signal, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-hup:
+			rl.reload()
+		case <-ticker.C:
+			info, err := os.Stat(rl.path)
+			if err != nil {
+				rl.log.WithError(err).Error("Unable to check the config file for changes")
+				continue
+			}
+			if !info.ModTime().Equal(rl.modTime) {
+				rl.modTime = info.ModTime()
+				rl.reload()
+			}
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/content-unroller/content"
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// testOptions returns the settings of the service with the default options.
+func testOptions() config {
+	return config{
+		LogLevel:       "INFO",
+		Port:           "9090",
+		APIHost:        "test.api.ft.com",
+		MaxRequestSize: testMaxRequestSize,
+		ContentStore: content.ReaderConfig{
+			ContentStoreAppName: "content-public-read",
+			ContentStoreHost:    "http://localhost:8080/__content-public-read",
+		},
+		Limits:      content.Limits{MaxDepth: content.DefaultMaxDepth, Timeout: content.DefaultTimeout},
+		Concurrency: concurrencyConfig{ConcurrencyLimits: content.ConcurrencyLimits{MaxInFlight: content.DefaultMaxInFlight}},
+		Tracing:     content.TracingConfig{ServiceName: AppCode},
+	}
+}
+
+func writeConfig(t *testing.T, path string, cfg string) {
+	t.Helper()
+	assert.NoError(t, os.WriteFile(path, []byte(cfg), 0o600))
+}
+
+func TestLoadConfig_OverridesTheOptions(t *testing.T) {
+	expected := testOptions()
+	expected.LogLevel = "debug"
+	expected.ContentStore.ContentStoreHost = "http://content-public-read:8080"
+	expected.Limits = content.Limits{MaxDepth: 2, Timeout: 5 * time.Second}
+	expected.DegradedMode = true
+	expected.Concurrency.MaxInFlight = 32
+	expected.Concurrency.InternalMaxInFlight = 8
+	expected.Server.GracePeriod = 30 * time.Second
+
+	cfg, err := loadConfig("testdata/config.yaml", testOptions())
+
+	assert.NoError(t, err)
+	assert.Equal(t, expected, cfg)
+}
+
+func TestLoadConfig_JSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	writeConfig(t, path, `{"logLevel": "warn", "limits": {"maxItems": 10, "timeout": "2s"}}`)
+
+	cfg, err := loadConfig(path, testOptions())
+
+	assert.NoError(t, err)
+	assert.Equal(t, "warn", cfg.LogLevel)
+	assert.Equal(t, content.Limits{MaxDepth: content.DefaultMaxDepth, MaxItems: 10, Timeout: 2 * time.Second}, cfg.Limits)
+}
+
+func TestLoadConfig_Empty(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "")
+
+	cfg, err := loadConfig(path, testOptions())
+
+	assert.NoError(t, err)
+	assert.Equal(t, testOptions(), cfg)
+}
+
+func TestLoadConfig_Invalid(t *testing.T) {
+	tests := map[string]struct {
+		config string
+		err    string
+	}{
+		"unknown setting":  {"maxDepth: 2\n", "field maxDepth not found"},
+		"invalid duration": {"limits:\n  timeout: soon\n", "decoding config"},
+		"log level":        {"logLevel: loud\n", `logLevel: not a valid logrus Level: "loud"`},
+		"negative limit":   {"limits:\n  maxItems: -1\n", "limits.maxItems must not be negative, got -1"},
+		"negative timeout": {"server:\n  drainDelay: -1s\n", "server.drainDelay must not be negative, got -1s"},
+		"no port":          {"port: \"\"\n", "port is not set"},
+		"exporter":         {"tracing:\n  exporter: jaeger\n", `unsupported tracing.exporter "jaeger"`},
+		"auth":             {"auth: clients.yaml\napiKeys: a=b\n", "only one of auth and apiKeys can be set"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			writeConfig(t, path, test.config)
+
+			_, err := loadConfig(path, testOptions())
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
+
+// appliedConfigs keeps the configs applied by a reloader.
+type appliedConfigs struct {
+	mu      sync.Mutex
+	configs []config
+}
+
+func (a *appliedConfigs) apply(cfg config) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.configs = append(a.configs, cfg)
+}
+
+func (a *appliedConfigs) last() (config, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.configs) == 0 {
+		return config{}, 0
+	}
+	return a.configs[len(a.configs)-1], len(a.configs)
+}
+
+func TestReloader_AppliesOnlyTheReloadableSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "logLevel: info\n")
+	current, err := loadConfig(path, testOptions())
+	assert.NoError(t, err)
+	applied := &appliedConfigs{}
+	rl := newReloader(path, testOptions(), current, applied.apply, logger.NewUPPLogger("test-service", "Error"))
+
+	writeConfig(t, path, "logLevel: debug\nport: \"8080\"\nlimits:\n  maxDepth: 1\ndegradedMode: true\n")
+	rl.reload()
+
+	cfg, count := applied.last()
+	assert.Equal(t, 1, count)
+	assert.Equal(t, "debug", cfg.LogLevel)
+	assert.Equal(t, content.Limits{MaxDepth: 1, Timeout: content.DefaultTimeout}, cfg.Limits)
+	assert.True(t, cfg.DegradedMode)
+	assert.Equal(t, "9090", cfg.Port, "Settings which need a restart should not be applied")
+
+	writeConfig(t, path, "logLevel: loud\n")
+	rl.reload()
+	_, count = applied.last()
+	assert.Equal(t, 1, count, "Invalid configs should not be applied")
+}
+
+func TestReloader_WarnsOnlyAboutSettingsNeedingARestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "logLevel: info\n")
+	current, err := loadConfig(path, testOptions())
+	assert.NoError(t, err)
+	log := logger.NewUPPLogger("test-service", "Warn")
+	hook := test.NewLocal(log.Logger)
+	rl := newReloader(path, testOptions(), current, (&appliedConfigs{}).apply, log)
+
+	writeConfig(t, path, "logLevel: warn\nlimits:\n  maxDepth: 1\ndegradedMode: true\n")
+	rl.reload()
+	assert.Empty(t, hook.AllEntries(), "Reloadable settings should be applied without a warning")
+
+	writeConfig(t, path, "logLevel: warn\nport: \"8080\"\n")
+	rl.reload()
+	assert.Len(t, hook.AllEntries(), 1, "Changes to the settings needing a restart should be warned about")
+}
+
+func TestReloader_WatchesTheFileAndSIGHUP(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, "limits:\n  maxDepth: 3\n")
+	current, err := loadConfig(path, testOptions())
+	assert.NoError(t, err)
+	applied := &appliedConfigs{}
+	rl := newReloader(path, testOptions(), current, applied.apply, logger.NewUPPLogger("test-service", "Error"))
+
+	hup := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go rl.watch(10*time.Millisecond, hup, done)
+
+	writeConfig(t, path, "limits:\n  maxDepth: 1\n")
+	// the modification time may have a coarse resolution
+	assert.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)))
+	assert.Eventually(t, func() bool {
+		cfg, _ := applied.last()
+		return cfg.Limits.MaxDepth == 1
+	}, time.Second, 5*time.Millisecond, "Changes to the file should be applied")
+
+	_, count := applied.last()
+	hup <- syscall.SIGHUP
+	assert.Eventually(t, func() bool {
+		_, n := applied.last()
+		return n == count+1
+	}, time.Second, 5*time.Millisecond, "The file should be reloaded on SIGHUP")
+}
@@ -0,0 +1,201 @@
+package content
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// PathError reports a value inside the content which is missing or is not of the expected JSON type.
+type PathError struct {
+	Path string
+	Want string
+	Got  interface{}
+	Err  error
+}
+
+func (e *PathError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("malformed content at %s: %v", e.Path, e.Err)
+	}
+	if e.Got == nil {
+		return fmt.Sprintf("malformed content at %s: missing %s", e.Path, e.Want)
+	}
+	return fmt.Sprintf("malformed content at %s: expected %s, got %s", e.Path, e.Want, jsonTypeName(e.Got))
+}
+
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
+
+func (e *PathError) Is(target error) bool {
+	return target == ErrConverting
+}
+
+// value is a JSON value found at path while traversing content. Traversal errors are carried along,
+// so that chained lookups like c.field(mainImageField).field(id).str() report the first failing path.
+type value struct {
+	v     interface{}
+	path  string
+	found bool
+	err   error
+}
+
+// root returns the content as a value placed at path, so that errors name paths relative to the parent document.
+func (c Content) root(path string) value {
+	return value{v: map[string]interface{}(c), path: path, found: true}
+}
+
+func (c Content) field(key string) value {
+	return c.root("").field(key)
+}
+
+func (v value) exists() bool {
+	return v.err == nil && v.found
+}
+
+func (v value) field(key string) value {
+	if v.err != nil {
+		return v
+	}
+	path := joinPath(v.path, key)
+	if !v.found {
+		return value{path: path, err: &PathError{Path: v.path, Want: "object"}}
+	}
+	obj, ok := asObject(v.v)
+	if !ok {
+		return value{path: path, err: &PathError{Path: v.path, Want: "object", Got: v.v}}
+	}
+	child, found := obj[key]
+	return value{v: child, path: path, found: found}
+}
+
+func (v value) index(i int) value {
+	if v.err != nil {
+		return v
+	}
+	path := v.path + "[" + strconv.Itoa(i) + "]"
+	arr, err := v.array()
+	if err != nil {
+		return value{path: path, err: err}
+	}
+	if i < 0 || i >= len(arr) {
+		return value{path: path}
+	}
+	return value{v: arr[i], path: path, found: true}
+}
+
+func (v value) str() (string, error) {
+	if v.err != nil {
+		return "", v.err
+	}
+	s, ok := v.v.(string)
+	if !ok {
+		return "", v.typeError("string")
+	}
+	return s, nil
+}
+
+func (v value) object() (Content, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+	obj, ok := asObject(v.v)
+	if !ok {
+		return nil, v.typeError("object")
+	}
+	return obj, nil
+}
+
+func (v value) array() ([]interface{}, error) {
+	if v.err != nil {
+		return nil, v.err
+	}
+	switch arr := v.v.(type) {
+	case []interface{}:
+		return arr, nil
+	case []Content:
+		list := make([]interface{}, 0, len(arr))
+		for _, c := range arr {
+			list = append(list, c)
+		}
+		return list, nil
+	}
+	return nil, v.typeError("array")
+}
+
+// uuid reads a string value and extracts the UUID it contains.
+func (v value) uuid() (string, error) {
+	s, err := v.str()
+	if err != nil {
+		return "", err
+	}
+	u, err := extractUUIDFromString(s)
+	if err != nil {
+		return "", &PathError{Path: v.path, Want: "UUID", Got: s, Err: err}
+	}
+	return u, nil
+}
+
+// each calls fn with every element of an array value.
+func (v value) each(fn func(i int, elem value) error) error {
+	arr, err := v.array()
+	if err != nil {
+		return err
+	}
+	for i := range arr {
+		if err := fn(i, v.index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (v value) typeError(want string) error {
+	if !v.found {
+		return &PathError{Path: v.path, Want: want}
+	}
+	return &PathError{Path: v.path, Want: want, Got: v.v}
+}
+
+func asObject(v interface{}) (Content, bool) {
+	switch obj := v.(type) {
+	case map[string]interface{}:
+		return obj, true
+	case Content:
+		return obj, true
+	}
+	return nil, false
+}
+
+func joinPath(parent string, key string) string {
+	if parent == "" {
+		return key
+	}
+	return parent + "." + key
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case float64, int:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}, []Content:
+		return "array"
+	case map[string]interface{}, Content:
+		return "object"
+	}
+	return "null"
+}
+
+// malformedPath returns the path of the first PathError in err, if any.
+func malformedPath(err error) (string, bool) {
+	var pe *PathError
+	if errors.As(err, &pe) {
+		return pe.Path, true
+	}
+	return "", false
+}
@@ -0,0 +1,91 @@
+package content
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValueAccessors(t *testing.T) {
+	var c Content
+	err := json.Unmarshal([]byte(`{
+		"id": "http://www.ft.com/thing/22c0d426-1466-11e7-b0c1-37e417ee6c76",
+		"mainImage": {"id": 5},
+		"members": [{"id": "http://api.ft.com/content/639cd952-149f-11e7-2ea7-a07ecd9ac73f"}, "not an object"],
+		"bodyXML": ["not a string"]
+	}`), &c)
+	assert.NoError(t, err, "Cannot build json body")
+
+	u, err := c.field(id).uuid()
+	assert.NoError(t, err)
+	assert.Equal(t, "22c0d426-1466-11e7-b0c1-37e417ee6c76", u)
+
+	u, err = c.field(membersField).index(0).field(id).uuid()
+	assert.NoError(t, err)
+	assert.Equal(t, "639cd952-149f-11e7-2ea7-a07ecd9ac73f", u)
+
+	tests := []struct {
+		name         string
+		access       func() error
+		expectedPath string
+		expectedMsg  string
+	}{
+		{
+			name: "wrong type",
+			access: func() error {
+				_, err := c.field(mainImageField).field(id).str()
+				return err
+			},
+			expectedPath: "mainImage.id",
+			expectedMsg:  "malformed content at mainImage.id: expected string, got number",
+		},
+		{
+			name: "missing field",
+			access: func() error {
+				_, err := c.field(altImagesField).field(promotionalImage).str()
+				return err
+			},
+			expectedPath: "alternativeImages",
+			expectedMsg:  "malformed content at alternativeImages: missing object",
+		},
+		{
+			name: "element is not an object",
+			access: func() error {
+				_, err := c.field(membersField).index(1).field(id).str()
+				return err
+			},
+			expectedPath: "members[1]",
+			expectedMsg:  "malformed content at members[1]: expected object, got string",
+		},
+		{
+			name: "not an array",
+			access: func() error {
+				_, err := c.field(bodyXMLField).str()
+				return err
+			},
+			expectedPath: "bodyXML",
+			expectedMsg:  "malformed content at bodyXML: expected string, got array",
+		},
+		{
+			name: "nested root",
+			access: func() error {
+				_, err := c.root("embeds[0]").field(mainImageField).field(id).str()
+				return err
+			},
+			expectedPath: "embeds[0].mainImage.id",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.access()
+			assert.ErrorIs(t, err, ErrConverting)
+			path, found := malformedPath(err)
+			assert.True(t, found)
+			assert.Equal(t, tt.expectedPath, path)
+			if tt.expectedMsg != "" {
+				assert.EqualError(t, err, tt.expectedMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package content
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultKeyHeader    = "X-Api-Key"
+	DefaultMaxClockSkew = 5 * time.Minute
+
+	// Headers of the requests signed with HMAC.
+	clientHeader    = "X-Auth-Client"
+	timestampHeader = "X-Auth-Timestamp"
+	signatureHeader = "X-Auth-Signature"
+)
+
+// ErrMissingCredentials is returned for requests without an API key or a signature.
+var ErrMissingCredentials = errors.New("missing credentials")
+
+// Client holds the credentials of a client of the API.
+type Client struct {
+	// Key is a static API key, sent in the key header.
+	Key string `yaml:"key"`
+	// Secret signs the requests of the client with HMAC-SHA256.
+	Secret string `yaml:"secret"`
+	// Endpoints are the path templates of the endpoints the client may call, e.g. /content/plan. It may call all of
+	// them when none are set.
+	Endpoints []string `yaml:"endpoints"`
+}
+
+// AuthConfig sets the clients allowed to call the API, by name.
+type AuthConfig struct {
+	// KeyHeader holds the API key of the client. Defaults to X-Api-Key.
+	KeyHeader string `yaml:"keyHeader"`
+	// MaxClockSkew is how far the timestamp of a signed request may be from the time it is received, which bounds
+	// how long a signed request can be replayed for. Defaults to 5 minutes.
+	MaxClockSkew time.Duration     `yaml:"maxClockSkew"`
+	Clients      map[string]Client `yaml:"clients"`
+}
+
+func (cfg AuthConfig) withDefaults() AuthConfig {
+	if cfg.KeyHeader == "" {
+		cfg.KeyHeader = DefaultKeyHeader
+	}
+	if cfg.MaxClockSkew <= 0 {
+		cfg.MaxClockSkew = DefaultMaxClockSkew
+	}
+	return cfg
+}
+
+// LoadAuthConfig reads and validates the clients from a YAML file.
+func LoadAuthConfig(path string) (AuthConfig, error) {
+	var cfg AuthConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("decoding clients from %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return cfg, fmt.Errorf("invalid clients in %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// ParseAPIKeys reads clients with static API keys, allowed to call all the endpoints, from a comma separated list of
+// name=key pairs.
+func ParseAPIKeys(s string) (AuthConfig, error) {
+	cfg := AuthConfig{Clients: map[string]Client{}}
+	for _, pair := range strings.Split(s, ",") {
+		name, key, found := strings.Cut(strings.TrimSpace(pair), "=")
+		if !found || name == "" {
+			return cfg, fmt.Errorf("invalid API key %q, expected name=key", pair)
+		}
+		if _, duplicate := cfg.Clients[name]; duplicate {
+			return cfg, fmt.Errorf("client %s is set more than once", name)
+		}
+		cfg.Clients[name] = Client{Key: key}
+	}
+	if err := cfg.validate(); err != nil {
+		return cfg, fmt.Errorf("invalid API keys: %w", err)
+	}
+	return cfg, nil
+}
+
+func (cfg AuthConfig) validate() error {
+	if len(cfg.Clients) == 0 {
+		return errors.New("no clients are set")
+	}
+	keys := map[string]string{}
+	for name, client := range cfg.Clients {
+		if client.Key == "" && client.Secret == "" {
+			return fmt.Errorf("client %s has neither a key nor a secret", name)
+		}
+		if client.Key == "" {
+			continue
+		}
+		if other, found := keys[client.Key]; found {
+			return fmt.Errorf("clients %s and %s have the same key", other, name)
+		}
+		keys[client.Key] = name
+	}
+	return nil
+}
+
+// Authenticator tells the clients of the API apart by their API key or the signature of their requests.
+type Authenticator struct {
+	cfg AuthConfig
+	now func() time.Time
+}
+
+// NewAuthenticator returns an authenticator for the validated config.
+func NewAuthenticator(cfg AuthConfig) *Authenticator {
+	return &Authenticator{cfg: cfg.withDefaults(), now: time.Now}
+}
+
+// authenticate returns the name of the client sending the request. Requests with an X-Auth-Client header must be
+// signed, otherwise they must have an API key.
+func (a *Authenticator) authenticate(r *http.Request) (string, error) {
+	if name := r.Header.Get(clientHeader); name != "" {
+		return name, a.verifySignature(r, name)
+	}
+	key := r.Header.Get(a.cfg.KeyHeader)
+	if key == "" {
+		return "", ErrMissingCredentials
+	}
+	// every key is compared, so that the time taken doesn't tell how close the key is to a valid one
+	var client string
+	for name, c := range a.cfg.Clients {
+		if c.Key != "" && subtle.ConstantTimeCompare([]byte(c.Key), []byte(key)) == 1 {
+			client = name
+		}
+	}
+	if client == "" {
+		return "", errors.New("invalid API key")
+	}
+	return client, nil
+}
+
+// verifySignature checks that the request was signed by the client within the allowed clock skew. The signature is
+// the hex encoded HMAC-SHA256 of the method, path and query, timestamp and body of the request, separated by new
+// lines. No nonce is signed, so a signed request can be replayed as it is until its timestamp is further than the
+// clock skew from now.
+func (a *Authenticator) verifySignature(r *http.Request, name string) error {
+	client, found := a.cfg.Clients[name]
+	if !found || client.Secret == "" {
+		return fmt.Errorf("client %s can't sign requests", name)
+	}
+	timestamp := r.Header.Get(timestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q", timestampHeader, timestamp)
+	}
+	if skew := a.now().Sub(time.Unix(seconds, 0)).Abs(); skew > a.cfg.MaxClockSkew {
+		return fmt.Errorf("request was signed %v away from now", skew)
+	}
+	signature, err := hex.DecodeString(r.Header.Get(signatureHeader))
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", signatureHeader, err)
+	}
+
+	var body []byte
+	if r.Body != nil {
+		if body, err = io.ReadAll(r.Body); err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				return newUnrollError(CodeRequestTooLarge, "", err)
+			}
+			return err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	if !hmac.Equal(signature, sign(client.Secret, r.Method, r.URL.RequestURI(), timestamp, body)) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func sign(secret string, method string, requestURI string, timestamp string, body []byte) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n", method, requestURI, timestamp)
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+type clientKey struct{}
+
+// withClient returns a context carrying the name of the authenticated client.
+func withClient(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, clientKey{}, name)
+}
+
+// clientFrom returns the name of the client the request was authenticated as, if it was.
+func clientFrom(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(clientKey{}).(string)
+	return name, ok
+}
+
+// allowed reports whether the client may call the endpoint with the path template.
+func (a *Authenticator) allowed(name string, endpoint string) bool {
+	endpoints := a.cfg.Clients[name].Endpoints
+	return len(endpoints) == 0 || slices.Contains(endpoints, endpoint)
+}
+
+// Authenticate rejects the requests without valid credentials with a 401 response, and the requests of clients not
+// allowed to call the endpoint with a 403 response.
+func Authenticate(a *Authenticator, log *logger.UPPLogger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tid := transactionidutils.GetTransactionIDFromRequest(r)
+			client, err := a.authenticate(r)
+			if err != nil {
+				var ue *UnrollError
+				if !errors.As(err, &ue) {
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf("ApiKey header=%q, HMAC-SHA256", a.cfg.KeyHeader))
+					err = newUnrollError(CodeUnauthenticated, "", err)
+				}
+				handleError(r, log, tid, "", w, err)
+				return
+			}
+			if endpoint := routeTemplate(r); !a.allowed(client, endpoint) {
+				handleError(r, log, tid, "", w, newUnrollError(CodeForbidden, "", fmt.Errorf("client %s may not call %s", client, endpoint)))
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(withClient(r.Context(), client)))
+		})
+	}
+}
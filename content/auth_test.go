@@ -0,0 +1,155 @@
+package content
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadAuthConfig(t *testing.T) {
+	cfg, err := LoadAuthConfig("testdata/auth.yaml")
+
+	assert.NoError(t, err)
+	assert.Equal(t, AuthConfig{
+		KeyHeader:    "X-Api-Key",
+		MaxClockSkew: time.Minute,
+		Clients: map[string]Client{
+			"next-article":      {Key: "next-article-key"},
+			"methode-publisher": {Secret: "methode-publisher-secret", Endpoints: []string{"/internalcontent", "/internalcontent/plan"}},
+		},
+	}, cfg)
+}
+
+func TestLoadAuthConfig_Invalid(t *testing.T) {
+	tests := map[string]struct {
+		config string
+		err    string
+	}{
+		"no clients":       {"keyHeader: X-Api-Key\n", "no clients are set"},
+		"no credentials":   {"clients:\n  a: {endpoints: [/content]}\n", "client a has neither a key nor a secret"},
+		"same key":         {"clients:\n  a: {key: k}\n  b: {key: k}\n", "have the same key"},
+		"unknown field":    {"clients:\n  a: {token: k}\n", "field token not found"},
+		"invalid duration": {"maxClockSkew: soon\nclients:\n  a: {key: k}\n", "decoding clients"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "auth.yaml")
+			assert.NoError(t, os.WriteFile(path, []byte(test.config), 0o600))
+
+			_, err := LoadAuthConfig(path)
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	cfg, err := ParseAPIKeys("next-article=key-1, next-video=key-2")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Client{"next-article": {Key: "key-1"}, "next-video": {Key: "key-2"}}, cfg.Clients)
+
+	for _, keys := range []string{"next-article", "=key-1", "a=key-1,a=key-2", "a=", "a=key-1,b=key-1"} {
+		_, err := ParseAPIKeys(keys)
+		assert.Error(t, err, keys)
+	}
+}
+
+// authRouter serves the unroll endpoints, which always succeed, behind the authenticator.
+func authRouter(a *Authenticator) *mux.Router {
+	r := mux.NewRouter()
+	r.Use(Authenticate(a, logger.NewUPPLogger("test-service", "Error")))
+	ok := func(w http.ResponseWriter, _ *http.Request) {}
+	r.HandleFunc("/content", ok)
+	r.HandleFunc("/internalcontent", ok)
+	return r
+}
+
+func signedRequest(target string, client string, secret string, timestamp time.Time, body string) *http.Request {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set(clientHeader, client)
+	req.Header.Set(timestampHeader, ts)
+	req.Header.Set(signatureHeader, hex.EncodeToString(sign(secret, http.MethodPost, req.URL.RequestURI(), ts, []byte(body))))
+	return req
+}
+
+func TestAuthenticate(t *testing.T) {
+	cfg, err := LoadAuthConfig("testdata/auth.yaml")
+	assert.NoError(t, err)
+	a := NewAuthenticator(cfg)
+	now := time.Unix(1700000000, 0)
+	a.now = func() time.Time { return now }
+	r := authRouter(a)
+
+	withKey := func(path string, key string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("{}"))
+		req.Header.Set("X-Api-Key", key)
+		return req
+	}
+	tamperedBody := signedRequest("/internalcontent", "methode-publisher", "methode-publisher-secret", now, "{}")
+	tamperedBody.Body = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"id":"x"}`)).Body
+	tamperedQuery := signedRequest("/internalcontent?unrollDepth=1", "methode-publisher", "methode-publisher-secret", now, "{}")
+	tamperedQuery.URL.RawQuery = "unrollDepth=4"
+
+	tests := map[string]struct {
+		req          *http.Request
+		expectedCode ErrorCode
+	}{
+		"valid key":             {withKey("/content", "next-article-key"), ""},
+		"valid signature":       {signedRequest("/internalcontent", "methode-publisher", "methode-publisher-secret", now.Add(-time.Minute), "{}"), ""},
+		"no credentials":        {httptest.NewRequest(http.MethodPost, "/content", nil), CodeUnauthenticated},
+		"invalid key":           {withKey("/content", "next-article"), CodeUnauthenticated},
+		"wrong secret":          {signedRequest("/internalcontent", "methode-publisher", "guessed", now, "{}"), CodeUnauthenticated},
+		"tampered body":         {tamperedBody, CodeUnauthenticated},
+		"signed query":          {signedRequest("/internalcontent?unrollDepth=1", "methode-publisher", "methode-publisher-secret", now, "{}"), ""},
+		"tampered query":        {tamperedQuery, CodeUnauthenticated},
+		"stale signature":       {signedRequest("/internalcontent", "methode-publisher", "methode-publisher-secret", now.Add(-2*time.Minute), "{}"), CodeUnauthenticated},
+		"client without secret": {signedRequest("/content", "next-article", "", now, "{}"), CodeUnauthenticated},
+		"endpoint not allowed":  {signedRequest("/content", "methode-publisher", "methode-publisher-secret", now, "{}"), CodeForbidden},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, test.req)
+
+			if test.expectedCode == "" {
+				assert.Equal(t, http.StatusOK, rec.Code)
+				return
+			}
+			var p problem
+			assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &p))
+			assert.Equal(t, test.expectedCode, p.Code)
+			assert.Equal(t, errorCodes[test.expectedCode].status, rec.Code)
+			if test.expectedCode == CodeUnauthenticated {
+				assert.Equal(t, `ApiKey header="X-Api-Key", HMAC-SHA256`, rec.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestAuthenticate_KeepsTheSignedBody(t *testing.T) {
+	a := NewAuthenticator(AuthConfig{Clients: map[string]Client{"a": {Secret: "s"}}})
+	var body []byte
+	r := mux.NewRouter()
+	r.Use(Authenticate(a, logger.NewUPPLogger("test-service", "Error")))
+	r.HandleFunc("/content", func(_ http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	})
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, signedRequest("/content", "a", "s", time.Now(), `{"id":"x"}`))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `{"id":"x"}`, string(body))
+}
@@ -1,49 +1,249 @@
 package content
 
 import (
+	"errors"
+	"io"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/Financial-Times/go-logger/v2"
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
-func getEmbedded(log *logger.UPPLogger, body string, acceptedTypes []string, tid string, uuid string) ([]string, error) {
-	embedsResult := []string{}
-	doc, err := html.Parse(strings.NewReader(body))
-	if err != nil {
-		return embedsResult, err
-	}
-
-	parse(doc, log, acceptedTypes, &embedsResult, tid, uuid)
-	return embedsResult, nil
-}
-
-func parse(n *html.Node, log *logger.UPPLogger, acceptedTypes []string, embedsResult *[]string, tid string, uuid string) {
-	if n.Data == "ft-content" {
-		isEmbedded := false
-		isTypeMatching := false
-		var id string
-		for _, a := range n.Attr {
-			if a.Key == "data-embedded" && a.Val == "true" {
-				isEmbedded = true
-			} else if a.Key == "type" {
-				isTypeMatching = isContentTypeMatching(a.Val, acceptedTypes)
-			} else if a.Key == "url" {
-				id = a.Val
+const (
+	ftContentTag = "ft-content"
+	// embedField holds the attributes of the tag embedding the content in the body, in every expanded embed.
+	embedField = "embed"
+	// embedIndexAttr is set to the position of every tag embedding content in the body, when asked for.
+	embedIndexAttr = "data-embed-index"
+	// embedIndexHeader asks for the tags embedding content in the returned body to be indexed.
+	embedIndexHeader = "X-Unroll-Embed-Index"
+)
+
+// Embed is an instance of content embedded in the bodyXML by an ft-content tag.
+type Embed struct {
+	UUID string
+	Type string
+	// Attributes are all the attributes of the tag, e.g. data-layout-width or data-alignment.
+	Attributes map[string]string
+	// Position is the position of the tag among the tags embedding content in the body, from 0. It is the value of
+	// the data-embed-index attribute of the tag in indexed bodies.
+	Position int
+	// Occurrence is the position of the tag among the tags embedding the same content in the body, from 0.
+	Occurrence int
+	// Parent is the name of the element the tag is in, e.g. p.
+	Parent string
+	// Path lists the elements the tag is in inside the body, from the outermost one, e.g.
+	// scrollable-block > scrollable-section. It is empty for tags directly in the body.
+	Path string
+}
+
+// toContent returns the attributes of the instance set in the expanded embed.
+func (e Embed) toContent() Content {
+	attributes := make(map[string]interface{}, len(e.Attributes))
+	for k, v := range e.Attributes {
+		attributes[k] = v
+	}
+	return Content{
+		"position":   e.Position,
+		"occurrence": e.Occurrence,
+		"parent":     e.Parent,
+		"path":       e.Path,
+		"attributes": attributes,
+	}
+}
+
+// withEmbed returns a copy of the content expanded for the embed, carrying the attributes of the instance.
+func withEmbed(c Content, e Embed) Content {
+	placed := c.clone()
+	placed[embedField] = e.toContent()
+	return placed
+}
+
+func embedUUIDs(embeds []Embed) []string {
+	uuids := make([]string, 0, len(embeds))
+	for _, e := range embeds {
+		uuids = append(uuids, e.UUID)
+	}
+	return uuids
+}
+
+// getEmbedded scans the body for the tags embedding content of the accepted types in a single pass over its tokens,
+// without building the document tree.
+func getEmbedded(log *logger.UPPLogger, body string, acceptedTypes []string, tid string, uuid string) ([]Embed, error) {
+	embedsResult := []Embed{}
+	p := &bodyParser{log: log, acceptedTypes: acceptedTypes, occurrences: map[string]int{}, tid: tid, uuid: uuid}
+	z := html.NewTokenizer(strings.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if errors.Is(z.Err(), io.EOF) {
+				return embedsResult, nil
 			}
+			return embedsResult, z.Err()
+		case html.StartTagToken:
+			p.start(z, false, &embedsResult)
+		case html.SelfClosingTagToken:
+			p.start(z, true, &embedsResult)
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			p.end(tagName(name))
 		}
+	}
+}
 
-		if isEmbedded && isTypeMatching {
-			u, err := extractUUIDFromString(id)
-			if err != nil {
-				log.WithError(err).Errorf(tid, uuid, "Cannot extract UUID: %v", err.Error())
-			} else {
-				*embedsResult = append(*embedsResult, u)
-			}
+// bodyParser counts the tags embedding content while the body is scanned, so that every embed knows its instance,
+// and keeps the elements open at the current token, so that every embed knows where it is.
+type bodyParser struct {
+	log           *logger.UPPLogger
+	acceptedTypes []string
+	position      int
+	occurrences   map[string]int
+	// open are the names of the elements open inside the body, from the outermost one. The ft-content elements are
+	// left out, as self-closing ft-content tags are not closed by the HTML parser and don't hold the tags after them.
+	open []string
+	tid  string
+	uuid string
+}
+
+func (p *bodyParser) start(z *html.Tokenizer, selfClosing bool, embedsResult *[]Embed) {
+	name, hasAttr := z.TagName()
+	if string(name) != ftContentTag {
+		p.push(tagName(name), selfClosing)
+		return
+	}
+	attributes := map[string]string{}
+	for hasAttr {
+		var key, val []byte
+		key, val, hasAttr = z.TagAttr()
+		attributes[string(key)] = string(val)
+	}
+	if attributes["data-embedded"] != "true" {
+		return
+	}
+
+	u, err := extractUUIDFromString(attributes["url"])
+	switch {
+	case !isContentTypeMatching(attributes["type"], p.acceptedTypes):
+	case err != nil:
+		p.log.WithError(err).Errorf(p.tid, p.uuid, "Cannot extract UUID: %v", err.Error())
+	default:
+		*embedsResult = append(*embedsResult, Embed{
+			UUID:       u,
+			Type:       attributes["type"],
+			Attributes: attributes,
+			Position:   p.position,
+			Occurrence: p.occurrences[u],
+			Parent:     p.parent(),
+			Path:       strings.Join(p.open, " > "),
+		})
+	}
+	p.position++
+	if err == nil {
+		p.occurrences[u]++
+	}
+}
+
+// push opens the element, closing the open paragraph or list item first for the elements the HTML parser closes
+// them for.
+func (p *bodyParser) push(name string, selfClosing bool) {
+	switch name {
+	case "html", "head", "body":
+		return
+	case "li":
+		p.closeUntil("li", "ul", "ol")
+	case "dt", "dd":
+		p.closeUntil("dt", "dl")
+		p.closeUntil("dd", "dl")
+	}
+	if slices.Contains(closesParagraph, name) {
+		p.closeUntil("p", "button", "caption", "object", "table", "td", "th")
+	}
+	// the HTML parser ignores the self-closing flag of the tags of the HTML elements, which stay open
+	foreign := slices.Contains(p.open, "svg") || slices.Contains(p.open, "math")
+	if !slices.Contains(voidElements, name) && !(selfClosing && foreign) {
+		p.open = append(p.open, name)
+	}
+}
+
+// end closes the innermost open element with the name and the ones opened in it, if there is one.
+func (p *bodyParser) end(name string) {
+	p.closeUntil(name)
+}
+
+// closeUntil closes the innermost open element with the name, unless one of the boundary elements is open inside it.
+func (p *bodyParser) closeUntil(name string, boundaries ...string) {
+	for i := len(p.open) - 1; i >= 0; i-- {
+		switch {
+		case p.open[i] == name:
+			p.open = p.open[:i]
+			return
+		case slices.Contains(boundaries, p.open[i]):
+			return
 		}
 	}
-	for c := n.FirstChild; c != nil; c = c.NextSibling {
-		parse(c, log, acceptedTypes, embedsResult, tid, uuid)
+}
+
+// parent returns the name of the element holding the tag.
+func (p *bodyParser) parent() string {
+	if len(p.open) == 0 {
+		return "body"
+	}
+	return p.open[len(p.open)-1]
+}
+
+// voidElements are the elements which have no end tag in HTML.
+var voidElements = []string{"area", "base", "br", "col", "embed", "hr", "img", "input", "link", "meta", "source", "track", "wbr"}
+
+// closesParagraph are the elements whose start tag closes an open paragraph.
+var closesParagraph = []string{
+	"address", "article", "aside", "blockquote", "details", "div", "dl", "fieldset", "figcaption", "figure", "footer",
+	"form", "h1", "h2", "h3", "h4", "h5", "h6", "header", "hr", "main", "nav", "ol", "p", "pre", "section", "table", "ul",
+}
+
+// tagName returns the name of a tag, without allocating for the names of the HTML elements.
+func tagName(name []byte) string {
+	if a := atom.Lookup(name); a != 0 {
+		return a.String()
+	}
+	return string(name)
+}
+
+// isEmbedTag reports whether the token is a tag embedding content in the body.
+func isEmbedTag(tok html.Token) bool {
+	return tok.Data == ftContentTag && slices.ContainsFunc(tok.Attr, func(a html.Attribute) bool { return a.Key == "data-embedded" && a.Val == "true" })
+}
+
+// indexEmbeds sets the data-embed-index attribute of every tag embedding content in the body to the position of
+// the tag, which is the position of the embed expanded for it. The rest of the body is left as it is.
+func indexEmbeds(body string) (string, error) {
+	z := html.NewTokenizer(strings.NewReader(body))
+	var indexed strings.Builder
+	position := 0
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if errors.Is(z.Err(), io.EOF) {
+				return indexed.String(), nil
+			}
+			return "", z.Err()
+		}
+		raw := string(z.Raw())
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			indexed.WriteString(raw)
+			continue
+		}
+		tok := z.Token()
+		if !isEmbedTag(tok) {
+			indexed.WriteString(raw)
+			continue
+		}
+		tok.Attr = slices.DeleteFunc(tok.Attr, func(a html.Attribute) bool { return a.Key == embedIndexAttr })
+		tok.Attr = append(tok.Attr, html.Attribute{Key: embedIndexAttr, Val: strconv.Itoa(position)})
+		indexed.WriteString(tok.String())
+		position++
 	}
 }
 
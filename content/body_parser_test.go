@@ -3,10 +3,13 @@ package content
 import (
 	"errors"
 	"os"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/Financial-Times/go-logger/v2"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/html"
 )
 
 func TestGetEmbedded(t *testing.T) {
@@ -100,19 +103,187 @@ func TestGetEmbedded(t *testing.T) {
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			emImagesUUIDs, err := getEmbedded(testLogger, test.body, test.acceptedTypes, "", "")
+			emContent, err := getEmbedded(testLogger, test.body, test.acceptedTypes, "", "")
 			if test.expectedErr != nil {
 				assert.Error(t, err)
 				assert.True(t, errors.Is(err, test.expectedErr))
 			} else {
 				assert.NoError(t, err)
-				assert.Equal(t, test.expectedOutput, emImagesUUIDs)
+				assert.Equal(t, test.expectedOutput, embedUUIDs(emContent))
 			}
 		})
 	}
 }
 
-func loadBodyFromFile(t *testing.T, filePath string) string {
+func TestGetEmbedded_KeepsTheAttributesOfEveryInstance(t *testing.T) {
+	body := `<body>
+		<ft-content type="http://www.ft.com/ontology/content/ImageSet" url="http://api.ft.com/content/639cd952-149f-11e7-2ea7-a07ecd9ac73f" data-embedded="true" data-layout-width="full-grid"></ft-content>
+		<p><ft-content type="http://www.ft.com/ontology/content/Article" url="http://api.ft.com/content/5e43492c-0802-11e7-97d1-5e720a26771b">Article 50</ft-content></p>
+		<div><ft-content type="http://www.ft.com/ontology/content/DynamicContent" url="http://api.ft.com/content/d02886fc-58ff-11e8-9859-6668838a4c10" data-embedded="true"></ft-content></div>
+		<p><ft-content type="http://www.ft.com/ontology/content/ImageSet" url="http://api.ft.com/content/639cd952-149f-11e7-2ea7-a07ecd9ac73f" data-embedded="true" data-alignment="left"></ft-content></p>
+	</body>`
+
+	emContent, err := getEmbedded(logger.NewUPPLogger("test-service", "Error"), body, []string{ImageSetType}, "", "")
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Embed{
+		{
+			UUID: "639cd952-149f-11e7-2ea7-a07ecd9ac73f",
+			Type: ImageSetType,
+			Attributes: map[string]string{
+				"type":              ImageSetType,
+				"url":               "http://api.ft.com/content/639cd952-149f-11e7-2ea7-a07ecd9ac73f",
+				"data-embedded":     "true",
+				"data-layout-width": "full-grid",
+			},
+			Position: 0,
+			Parent:   "body",
+		},
+		{
+			UUID: "639cd952-149f-11e7-2ea7-a07ecd9ac73f",
+			Type: ImageSetType,
+			Attributes: map[string]string{
+				"type":           ImageSetType,
+				"url":            "http://api.ft.com/content/639cd952-149f-11e7-2ea7-a07ecd9ac73f",
+				"data-embedded":  "true",
+				"data-alignment": "left",
+			},
+			Position:   2,
+			Occurrence: 1,
+			Parent:     "p",
+			Path:       "p",
+		},
+	}, emContent)
+}
+
+func TestGetEmbedded_ReportsTheAncestryOfEveryInstance(t *testing.T) {
+	emContent, err := getEmbedded(logger.NewUPPLogger("test-service", "Error"), loadBodyFromFile(t, "testdata/bodyXml.xml"), []string{ImageSetType}, "", "")
+
+	assert.NoError(t, err)
+	var paths []string
+	for _, e := range emContent {
+		paths = append(paths, e.Path)
+	}
+	assert.Equal(t, []string{"", "ft-related > media", ""}, paths)
+
+	body := `<body><scrollable-block><scrollable-section><ft-content type="http://www.ft.com/ontology/content/ImageSet" url="http://api.ft.com/content/639cd952-149f-11e7-2ea7-a07ecd9ac73f" data-embedded="true"></ft-content></scrollable-section></scrollable-block></body>`
+	emContent, err = getEmbedded(logger.NewUPPLogger("test-service", "Error"), body, []string{ImageSetType}, "", "")
+	assert.NoError(t, err)
+	assert.Len(t, emContent, 1)
+	assert.Equal(t, "scrollable-block > scrollable-section", emContent[0].Path)
+	assert.Equal(t, "scrollable-section", emContent[0].Parent)
+}
+
+func TestIndexEmbeds(t *testing.T) {
+	body := `<body><ft-content type="http://www.ft.com/ontology/content/ImageSet" url="http://api.ft.com/content/639cd952-149f-11e7-2ea7-a07ecd9ac73f" data-embedded="true"></ft-content>` +
+		`<p>Tom &amp; Jerry <ft-content type="http://www.ft.com/ontology/content/Article" url="http://api.ft.com/content/5e43492c-0802-11e7-97d1-5e720a26771b">Article 50</ft-content></p>` +
+		`<ft-content type="http://www.ft.com/ontology/content/DynamicContent" url="http://api.ft.com/content/d02886fc-58ff-11e8-9859-6668838a4c10" data-embedded="true" data-embed-index="7"/></body>`
+
+	indexed, err := indexEmbeds(body)
+
+	assert.NoError(t, err)
+	assert.Equal(t, `<body><ft-content type="http://www.ft.com/ontology/content/ImageSet" url="http://api.ft.com/content/639cd952-149f-11e7-2ea7-a07ecd9ac73f" data-embedded="true" data-embed-index="0"></ft-content>`+
+		`<p>Tom &amp; Jerry <ft-content type="http://www.ft.com/ontology/content/Article" url="http://api.ft.com/content/5e43492c-0802-11e7-97d1-5e720a26771b">Article 50</ft-content></p>`+
+		`<ft-content type="http://www.ft.com/ontology/content/DynamicContent" url="http://api.ft.com/content/d02886fc-58ff-11e8-9859-6668838a4c10" data-embedded="true" data-embed-index="1"/></body>`, indexed,
+		"Only the tags embedding content should be indexed, with their positions as embeds")
+}
+
+func TestGetEmbedded_SelfClosingTagsAreNotParents(t *testing.T) {
+	emContent, err := getEmbedded(logger.NewUPPLogger("test-service", "Error"), loadBodyFromFile(t, "testdata/scrollyBodyXml.xml"), []string{ImageSetType}, "", "")
+
+	assert.NoError(t, err)
+	assert.Len(t, emContent, 2)
+	assert.Equal(t, emContent[0].Parent, emContent[1].Parent)
+	assert.Equal(t, []int{0, 1}, []int{emContent[0].Position, emContent[1].Position})
+}
+
+func TestGetEmbedded_FindsTheSameEmbedsAsTheDocumentTree(t *testing.T) {
+	testLogger := logger.NewUPPLogger("test-service", "Error")
+	acceptedTypes := []string{ImageSetType, ClipSetType, DynamicContentType}
+	imageSetTag := `<ft-content type="http://www.ft.com/ontology/content/ImageSet" url="http://api.ft.com/content/639cd952-149f-11e7-2ea7-a07ecd9ac73f" data-embedded="true"`
+	bodies := map[string]string{
+		"bodyXml.xml":        loadBodyFromFile(t, "testdata/bodyXml.xml"),
+		"scrollyBodyXml.xml": loadBodyFromFile(t, "testdata/scrollyBodyXml.xml"),
+		"no body element":    `<p>` + imageSetTag + `/></p>`,
+		"unclosed paragraph": `<body><p>Text<div>` + imageSetTag + `/></div><ul><li>One<li>` + imageSetTag + `></ft-content></ul></body>`,
+		"nested elements":    `<body><div><div><br/></div>` + imageSetTag + `></ft-content></div><custom-block/>` + imageSetTag + `/></body>`,
+		"repeated attribute": `<body>` + imageSetTag + ` data-layout="one" data-layout="two"/></body>`,
+	}
+
+	for name, body := range bodies {
+		t.Run(name, func(t *testing.T) {
+			emContent, err := getEmbedded(testLogger, body, acceptedTypes, "", "")
+
+			assert.NoError(t, err)
+			assert.Equal(t, treeEmbeds(t, body, acceptedTypes), emContent)
+		})
+	}
+}
+
+func BenchmarkGetEmbedded(b *testing.B) {
+	testLogger := logger.NewUPPLogger("test-service", "Error")
+	body := loadBodyFromFile(b, "testdata/bodyXml.xml")
+	acceptedTypes := []string{ImageSetType, ClipSetType, DynamicContentType}
+
+	b.Run("tokenizer", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_, _ = getEmbedded(testLogger, body, acceptedTypes, "", "")
+		}
+	})
+	b.Run("document tree", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			treeEmbeds(b, body, acceptedTypes)
+		}
+	})
+}
+
+// treeEmbeds finds the embeds in the document tree built by the HTML parser, which getEmbedded must agree with.
+func treeEmbeds(t testing.TB, body string, acceptedTypes []string) []Embed {
+	t.Helper()
+	doc, err := html.Parse(strings.NewReader(body))
+	assert.NoError(t, err)
+
+	embeds := []Embed{}
+	position := 0
+	occurrences := map[string]int{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == ftContentTag {
+			attributes := map[string]string{}
+			for _, a := range n.Attr {
+				attributes[a.Key] = a.Val
+			}
+			if attributes["data-embedded"] == "true" {
+				u, err := extractUUIDFromString(attributes["url"])
+				if err == nil && slices.Contains(acceptedTypes, attributes["type"]) {
+					var path []string
+					for p := n.Parent; p.Data != "body"; p = p.Parent {
+						if p.Data != ftContentTag {
+							path = append([]string{p.Data}, path...)
+						}
+					}
+					parent := "body"
+					if len(path) > 0 {
+						parent = path[len(path)-1]
+					}
+					embeds = append(embeds, Embed{UUID: u, Type: attributes["type"], Attributes: attributes, Position: position,
+						Occurrence: occurrences[u], Parent: parent, Path: strings.Join(path, " > ")})
+				}
+				position++
+				occurrences[u]++
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return embeds
+}
+
+func loadBodyFromFile(t testing.TB, filePath string) string {
 	t.Helper()
 	data, err := os.ReadFile(filePath)
 	assert.NoError(t, err, "Cannot read test file")
@@ -0,0 +1,195 @@
+package content
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// inlineBodyHeader asks for the data of the expanded images and clips to be set on the tags embedding them in the
+// returned body.
+const inlineBodyHeader = "X-Unroll-Inline-Body"
+
+// Attributes set on the tags embedding images and clips in inlined bodies.
+const (
+	binaryURLAttr   = "data-binary-url"
+	pixelWidthAttr  = "data-pixel-width"
+	pixelHeightAttr = "data-pixel-height"
+	altTextAttr     = "data-alt-text"
+	posterURLAttr   = "data-poster-url"
+)
+
+// inlineEmbeds sets the data of the expanded embeds, found by the position of the tags embedding them, on the
+// ft-content tags of the body, and serializes the body again. Embeds which are not images or clips, or which were
+// not expanded, leave their attributes as they are, and the rest of the body is kept as it was sent.
+func inlineEmbeds(body string, expanded map[int]Content) (string, error) {
+	doc, err := parseEmbeds(body)
+	if err != nil {
+		return "", err
+	}
+
+	position := 0
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if attrs := inlinedAttributes(expanded[position]); len(attrs) > 0 {
+				n.Attr = slices.DeleteFunc(n.Attr, func(a html.Attribute) bool {
+					return slices.ContainsFunc(attrs, func(set html.Attribute) bool { return set.Key == a.Key })
+				})
+				n.Attr = append(n.Attr, attrs...)
+			}
+			position++
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	var inlined strings.Builder
+	for c := doc.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&inlined, c); err != nil {
+			return "", err
+		}
+	}
+	return inlined.String(), nil
+}
+
+// parseEmbeds parses the body into a tree where the tags embedding content are elements, holding what is between
+// their start and end tags, and the rest of the markup is kept in raw nodes as it was sent. Unlike the HTML parser,
+// it neither moves the markup around nor nests what follows a self-closing ft-content tag in it.
+func parseEmbeds(body string) (*html.Node, error) {
+	doc := &html.Node{Type: html.DocumentNode}
+	parent := doc
+	// the ft-content tags which are open, nil for the ones which don't embed content
+	var open []*html.Node
+	z := html.NewTokenizer(strings.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if errors.Is(z.Err(), io.EOF) {
+				return doc, nil
+			}
+			return nil, z.Err()
+		}
+		raw := string(z.Raw())
+		tok := z.Token()
+		if tok.Data != ftContentTag {
+			parent.AppendChild(&html.Node{Type: html.RawNode, Data: raw})
+			continue
+		}
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if !isEmbedTag(tok) {
+				parent.AppendChild(&html.Node{Type: html.RawNode, Data: raw})
+				if tt == html.StartTagToken {
+					open = append(open, nil)
+				}
+				continue
+			}
+			n := &html.Node{Type: html.ElementNode, Data: tok.Data, DataAtom: tok.DataAtom, Attr: tok.Attr}
+			parent.AppendChild(n)
+			if tt == html.StartTagToken {
+				open = append(open, n)
+				parent = n
+			}
+		case html.EndTagToken:
+			if len(open) == 0 || open[len(open)-1] == nil {
+				parent.AppendChild(&html.Node{Type: html.RawNode, Data: raw})
+			} else {
+				// the end tag of embeds is written by the serializer
+				parent = open[len(open)-1].Parent
+			}
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		}
+	}
+}
+
+// inlinedAttributes returns the attributes describing an expanded image set, clip set or clip: the binary, the size
+// and the alternative text of its first image or video, and the URL of the poster of clips.
+func inlinedAttributes(c Content) []html.Attribute {
+	var attrs []html.Attribute
+	switch {
+	case checkType(c, ImageSetType):
+		image, _ := c.field(membersField).index(0).object()
+		attrs = appendAttr(attrs, binaryURLAttr, image[binaryURLField])
+		attrs = appendAttr(attrs, pixelWidthAttr, image[pixelWidthField])
+		attrs = appendAttr(attrs, pixelHeightAttr, image[pixelHeightField])
+		attrs = appendAttr(attrs, altTextAttr, image["description"])
+	case checkType(c, ClipSetType):
+		clip, _ := c.field(membersField).index(0).object()
+		attrs = inlinedAttributes(clip)
+	case checkType(c, ClipType):
+		video, _ := c.field(dataSourceField).index(0).object()
+		attrs = appendAttr(attrs, binaryURLAttr, video[binaryURLField])
+		attrs = appendAttr(attrs, pixelWidthAttr, video[pixelWidthField])
+		attrs = appendAttr(attrs, pixelHeightAttr, video[pixelHeightField])
+		poster, _ := c.field(posterField).field(membersField).index(0).object()
+		attrs = appendAttr(attrs, posterURLAttr, poster[binaryURLField])
+	default:
+		return nil
+	}
+	if !slices.ContainsFunc(attrs, func(a html.Attribute) bool { return a.Key == altTextAttr }) {
+		attrs = appendAttr(attrs, altTextAttr, c["description"])
+	}
+	return attrs
+}
+
+// appendAttr appends the attribute set to a string or a number, leaving it out for any other value.
+func appendAttr(attrs []html.Attribute, key string, v interface{}) []html.Attribute {
+	switch val := v.(type) {
+	case string:
+		if val != "" {
+			return append(attrs, html.Attribute{Key: key, Val: val})
+		}
+	case float64:
+		return append(attrs, html.Attribute{Key: key, Val: strconv.FormatFloat(val, 'f', -1, 64)})
+	case int:
+		return append(attrs, html.Attribute{Key: key, Val: strconv.Itoa(val)})
+	}
+	return attrs
+}
+
+// expandedEmbeds returns the expanded content in the fields holding the content embedded in the body, by the
+// position of the tags embedding it.
+func expandedEmbeds(cc Content, rules ContentRules) map[int]Content {
+	expanded := map[int]Content{}
+	for _, rule := range rules.References {
+		if !rule.embedded() {
+			continue
+		}
+		embedded, _ := cc[rule.Field].([]Content)
+		for _, c := range embedded {
+			if _, isCut := c[cutoffField]; isCut {
+				continue
+			}
+			if e, isEmbed := c[embedField].(Content); isEmbed {
+				if position, isInt := e["position"].(int); isInt {
+					expanded[position] = c
+				}
+			}
+		}
+	}
+	return expanded
+}
+
+// inlineBody inlines the expanded images and clips in the body, when the request asks for it.
+func (u *DefaultUnroller) inlineBody(ctx context.Context, cc Content, rules ContentRules) error {
+	body, isString := cc[bodyXMLField].(string)
+	if !unrollStateFrom(ctx).inlineBody || !isString {
+		return nil
+	}
+	inlined, err := inlineEmbeds(body, expandedEmbeds(cc, rules))
+	if err != nil {
+		return &PathError{Path: bodyXMLField, Want: "XML", Got: body, Err: err}
+	}
+	cc[bodyXMLField] = inlined
+	return nil
+}
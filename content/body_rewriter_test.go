@@ -0,0 +1,111 @@
+package content
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInlineEmbeds(t *testing.T) {
+	imageSetTag := `<ft-content type="http://www.ft.com/ontology/content/ImageSet" url="http://api.ft.com/content/639cd952-149f-11e7-2ea7-a07ecd9ac73f" data-embedded="true"`
+	clipSetTag := `<ft-content type="http://www.ft.com/ontology/content/ClipSet" url="http://api.ft.com/content/f6074f3c-b331-4a89-963c-f72eaf3895ae" data-embedded="true"`
+	dynamicTag := `<ft-content type="http://www.ft.com/ontology/content/DynamicContent" url="http://api.ft.com/content/d02886fc-58ff-11e8-9859-6668838a4c10" data-embedded="true"`
+	expanded := map[int]Content{
+		0: {
+			typeField: ImageSetType,
+			membersField: []interface{}{map[string]interface{}{
+				typeField:        "http://www.ft.com/ontology/content/MediaResource",
+				binaryURLField:   "https://com.ft.imagepublish.upp-prod-eu.s3.amazonaws.com/639cd952-149f-11e7-2ea7-a07ecd9ac73f",
+				pixelWidthField:  float64(2048),
+				pixelHeightField: float64(1152),
+				"description":    `Tom & Jerry "at home"`,
+			}},
+		},
+		1: {
+			typeField:     ClipSetType,
+			"description": "A clip",
+			membersField: []Content{{
+				typeField: ClipType,
+				dataSourceField: []interface{}{map[string]interface{}{
+					binaryURLField:   "https://ft.com/video.mp4",
+					pixelWidthField:  1280,
+					pixelHeightField: 720,
+				}},
+				posterField: Content{membersField: []interface{}{map[string]interface{}{binaryURLField: "https://ft.com/poster.jpg"}}},
+			}},
+		},
+		2: {typeField: DynamicContentType, "description": "Not inlined"},
+	}
+	inlinedImageSet := imageSetTag + ` data-binary-url="https://com.ft.imagepublish.upp-prod-eu.s3.amazonaws.com/639cd952-149f-11e7-2ea7-a07ecd9ac73f"` +
+		` data-pixel-width="2048" data-pixel-height="1152" data-alt-text="Tom &amp; Jerry &#34;at home&#34;">`
+	inlinedClipSet := clipSetTag + ` data-layout="in-line" data-binary-url="https://ft.com/video.mp4" data-pixel-width="1280" data-pixel-height="720"` +
+		` data-poster-url="https://ft.com/poster.jpg" data-alt-text="A clip"></ft-content>`
+
+	tests := []struct {
+		name string
+		// the body, with {0}, {1} and {2} in place of the tags embedding the expanded content
+		body string
+		want string
+	}{
+		{
+			name: "self-closing tags",
+			body: `<body>{0}</ft-content><p>Tom &amp; Jerry<br/></p>{1}<p>After the clip</p>{2}</ft-content></body>`,
+			want: `<body>` + inlinedImageSet + `</ft-content><p>Tom &amp; Jerry<br/></p>` + inlinedClipSet + `<p>After the clip</p>{2}</ft-content></body>`,
+		},
+		{
+			name: "tables",
+			body: "<body><table>\n<tr><td>{0}</ft-content></td><td>Cell</td></tr>\n</table>{1}<table><tbody><tr><th>{2}</ft-content></th></tr></tbody></table></body>",
+			want: "<body><table>\n<tr><td>" + inlinedImageSet + "</ft-content></td><td>Cell</td></tr>\n</table>" + inlinedClipSet + "<table><tbody><tr><th>{2}</ft-content></th></tr></tbody></table></body>",
+		},
+		{
+			name: "div in paragraph",
+			body: `<body><p>Before<div>{0}</ft-content></div>After</p><p>{1}<div class="x">{2}</ft-content></div></p></body>`,
+			want: `<body><p>Before<div>` + inlinedImageSet + `</ft-content></div>After</p><p>` + inlinedClipSet + `<div class="x">{2}</ft-content></div></p></body>`,
+		},
+		{
+			name: "entities",
+			body: `<body><p>Caf&eacute;&nbsp;&#8212; &lt;b&gt; &#x2019;</p>{0}</ft-content><a href="?a=1&amp;b=2">Link</a>{1}<p>&copy</p>{2}</ft-content></body>`,
+			want: `<body><p>Caf&eacute;&nbsp;&#8212; &lt;b&gt; &#x2019;</p>` + inlinedImageSet + `</ft-content><a href="?a=1&amp;b=2">Link</a>` + inlinedClipSet + `<p>&copy</p>{2}</ft-content></body>`,
+		},
+		{
+			name: "markup in embeds and links",
+			body: `<body>{0}<span>Caption &amp; credit</span></ft-content><ft-content type="http://www.ft.com/ontology/content/Article" url="http://api.ft.com/content/4855afce-10a4-11e7-b030-768954394623">Link</ft-content>{1}{2}</ft-content></body>`,
+			want: `<body>` + inlinedImageSet + `<span>Caption &amp; credit</span></ft-content><ft-content type="http://www.ft.com/ontology/content/Article" url="http://api.ft.com/content/4855afce-10a4-11e7-b030-768954394623">Link</ft-content>` + inlinedClipSet + `{2}</ft-content></body>`,
+		},
+		{
+			name: "without body element",
+			body: `<p>Text</p>{0}</ft-content>{1}{2}</ft-content>`,
+			want: `<p>Text</p>` + inlinedImageSet + `</ft-content>` + inlinedClipSet + `{2}</ft-content>`,
+		},
+	}
+
+	tags := strings.NewReplacer("{0}", imageSetTag+">", "{1}", clipSetTag+` data-layout="in-line"/>`, "{2}", dynamicTag+">")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inlined, err := inlineEmbeds(tags.Replace(test.body), expanded)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tags.Replace(test.want), inlined, "Only the tags of the images and clips should be rewritten")
+		})
+	}
+}
+
+func TestInlineEmbeds_ReplacesInlinedAttributes(t *testing.T) {
+	tag := `<ft-content type="http://www.ft.com/ontology/content/Clip" url="http://api.ft.com/content/f6074f3c-b331-4a89-963c-f72eaf3895ae" data-embedded="true"`
+	expanded := map[int]Content{0: {typeField: ClipType, "description": "New"}}
+
+	inlined, err := inlineEmbeds(`<body>`+tag+` data-alt-text="Old"></ft-content></body>`, expanded)
+
+	assert.NoError(t, err)
+	assert.Equal(t, `<body>`+tag+` data-alt-text="New"></ft-content></body>`, inlined)
+}
+
+func TestInlineEmbeds_BodyWithoutEmbeds(t *testing.T) {
+	body := "<body><p>No embeds &amp; <b>bold</b><br></p>\n<ft-content type=\"http://www.ft.com/ontology/content/Article\" url=\"http://api.ft.com/content/4855afce-10a4-11e7-b030-768954394623\">Link</ft-content></body>"
+
+	inlined, err := inlineEmbeds(body, map[int]Content{0: {typeField: ImageSetType}})
+
+	assert.NoError(t, err)
+	assert.Equal(t, body, inlined)
+}
@@ -0,0 +1,132 @@
+package content
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBreakerFailures = 5
+	DefaultBreakerCooldown = 30 * time.Second
+
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// ErrCircuitOpen is returned for reads which are not attempted, as the content store is failing.
+var ErrCircuitOpen = errors.New("content store circuit breaker is open")
+
+// Breaker stops reading from the content store once consecutive reads keep failing. After the cooldown a single
+// read is let through: the breaker closes again when it succeeds and stays open for another cooldown when it fails.
+type Breaker struct {
+	failures int
+	cooldown time.Duration
+	now      func() time.Time
+
+	mu       sync.Mutex
+	state    string
+	failed   int
+	openedAt time.Time
+}
+
+// NewBreaker returns a closed breaker which opens after the given number of consecutive failed reads. Values which
+// are not positive are replaced by the defaults.
+func NewBreaker(failures int, cooldown time.Duration) *Breaker {
+	if failures <= 0 {
+		failures = DefaultBreakerFailures
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+	return &Breaker{failures: failures, cooldown: cooldown, now: time.Now, state: breakerClosed}
+}
+
+// State returns closed, open or half-open, the latter while the read probing the content store is in flight.
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Open reports whether reads are currently rejected without being attempted.
+func (b *Breaker) Open() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		return b.now().Sub(b.openedAt) < b.cooldown
+	case breakerHalfOpen:
+		return true
+	}
+	return false
+}
+
+// allow reports whether a read can be attempted. Once the cooldown is over, the first read asking is let through
+// as the probe.
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	case breakerHalfOpen:
+		return false
+	}
+	return true
+}
+
+// record updates the breaker with the outcome of a read. Reads abandoned because the request ended don't say
+// anything about the content store and are ignored, apart from releasing the probe.
+func (b *Breaker) record(ctx context.Context, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case err == nil:
+		b.state, b.failed = breakerClosed, 0
+	case ctx.Err() != nil || !errors.Is(err, ErrConnectingToAPI):
+		if b.state == breakerHalfOpen {
+			b.state = breakerOpen
+		}
+	default:
+		b.failed++
+		if b.state == breakerHalfOpen || b.failed >= b.failures {
+			b.state, b.openedAt = breakerOpen, b.now()
+		}
+	}
+}
+
+// breakingReader guards the reads of a Reader with a Breaker.
+type breakingReader struct {
+	reader  Reader
+	breaker *Breaker
+}
+
+// NewBreakingReader returns a Reader which stops calling r while the breaker is open. Rejected reads fail with
+// ErrCircuitOpen, which is reported like the content store being unavailable.
+func NewBreakingReader(r Reader, b *Breaker) Reader {
+	return &breakingReader{reader: r, breaker: b}
+}
+
+func (br *breakingReader) Get(ctx context.Context, uuids []string, tid string) (map[string]Content, error) {
+	return br.read(ctx, br.reader.Get, uuids, tid)
+}
+
+func (br *breakingReader) GetInternal(ctx context.Context, uuids []string, tid string) (map[string]Content, error) {
+	return br.read(ctx, br.reader.GetInternal, uuids, tid)
+}
+
+func (br *breakingReader) read(ctx context.Context, read ReaderFunc, uuids []string, tid string) (map[string]Content, error) {
+	if !br.breaker.allow() {
+		return nil, errors.Join(ErrConnectingToAPI, ErrCircuitOpen)
+	}
+	content, err := read(ctx, uuids, tid)
+	br.breaker.record(ctx, err)
+	return content, err
+}
@@ -0,0 +1,99 @@
+package content
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type breakerTestClock struct {
+	now time.Time
+}
+
+func (c *breakerTestClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func newBreakerTestReader(b *Breaker, err *error, calls *int) Reader {
+	read := func(_ []string, _ string) (map[string]Content, error) {
+		*calls++
+		return map[string]Content{}, *err
+	}
+	return NewBreakingReader(&ReaderMock{mockGet: read, mockGetInternal: read}, b)
+}
+
+func TestBreaker_OpensAfterConsecutiveFailures(t *testing.T) {
+	clock := &breakerTestClock{now: time.Now()}
+	b := NewBreaker(2, time.Minute)
+	b.now = func() time.Time { return clock.now }
+	readErr, calls := ErrConnectingToAPI, 0
+	r := newBreakerTestReader(b, &readErr, &calls)
+	ctx := context.Background()
+
+	_, err := r.Get(ctx, []string{"a"}, "tid")
+	assert.ErrorIs(t, err, ErrConnectingToAPI)
+	assert.Equal(t, breakerClosed, b.State())
+
+	_, err = r.GetInternal(ctx, []string{"a"}, "tid")
+	assert.ErrorIs(t, err, ErrConnectingToAPI)
+	assert.Equal(t, breakerOpen, b.State())
+	assert.True(t, b.Open())
+
+	_, err = r.Get(ctx, []string{"a"}, "tid")
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.ErrorIs(t, err, ErrConnectingToAPI, "Rejected reads should be reported as the content store being unavailable")
+	assert.Equal(t, 2, calls, "The content store should not be read while the breaker is open")
+
+	// the probe after the cooldown fails, so the breaker opens again straight away
+	clock.advance(time.Minute)
+	assert.False(t, b.Open())
+	_, err = r.Get(ctx, []string{"a"}, "tid")
+	assert.ErrorIs(t, err, ErrConnectingToAPI)
+	assert.Equal(t, 3, calls)
+	assert.True(t, b.Open())
+
+	// the next probe succeeds and closes it
+	clock.advance(time.Minute)
+	readErr = nil
+	_, err = r.Get(ctx, []string{"a"}, "tid")
+	assert.NoError(t, err)
+	assert.Equal(t, breakerClosed, b.State())
+	assert.False(t, b.Open())
+}
+
+func TestBreaker_SuccessResetsFailures(t *testing.T) {
+	b := NewBreaker(2, time.Minute)
+	ctx := context.Background()
+
+	b.record(ctx, ErrConnectingToAPI)
+	b.record(ctx, nil)
+	b.record(ctx, ErrConnectingToAPI)
+
+	assert.Equal(t, breakerClosed, b.State())
+}
+
+func TestBreaker_IgnoresFailuresNotCausedByTheContentStore(t *testing.T) {
+	b := NewBreaker(1, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	b.record(ctx, errors.Join(ErrConnectingToAPI, context.Canceled))
+	b.record(context.Background(), errors.New("malformed content"))
+
+	assert.Equal(t, breakerClosed, b.State())
+}
+
+func TestBreaker_LetsSingleProbeThrough(t *testing.T) {
+	clock := &breakerTestClock{now: time.Now()}
+	b := NewBreaker(1, time.Minute)
+	b.now = func() time.Time { return clock.now }
+	b.record(context.Background(), ErrConnectingToAPI)
+
+	clock.advance(time.Minute)
+	assert.True(t, b.allow(), "The first read after the cooldown should probe the content store")
+	assert.Equal(t, breakerHalfOpen, b.State())
+	assert.False(t, b.allow(), "Only one read should probe the content store")
+}
@@ -1,50 +1,146 @@
 package content
 
-func (u *UniversalUnroller) unrollClip(event UnrollEvent) (Content, error) {
-	if !validateClip(event.c) {
-		return nil, ErrValidating
-	}
+import "context"
 
-	p, ok := event.c[posterField]
-	if !ok {
-		return event.c, nil
-	}
+func (u *UniversalUnroller) unrollClip(ctx context.Context, event UnrollEvent) (Content, error) {
+	return u.unrollClipAt(ctx, event, "")
+}
 
-	posterMap, ok := p.(map[string]interface{})
-	if !ok {
-		return nil, ErrConverting
-	}
-	apiURL, ok := posterMap[apiURLField].(string)
-	if !ok {
-		return nil, ErrConverting
-	}
+// unrollClipAt unrolls a clip found at path inside the unrolled document.
+func (u *UniversalUnroller) unrollClipAt(ctx context.Context, event UnrollEvent, path string) (_ Content, err error) {
+	ctx, span := startSpan(ctx, "unrollClip", attrUUID.String(event.uuid))
+	defer func() { endSpan(span, err) }()
 
-	posterUUID, err := extractUUIDFromString(apiURL)
+	poster, err := clipPoster(event.c, path)
 	if err != nil {
 		return nil, err
 	}
+	if poster == nil {
+		return event.c, nil
+	}
 
-	posterContent, err := u.reader.Get([]string{posterUUID}, event.tid)
+	posterUUID, err := poster.UUID()
 	if err != nil {
 		return nil, err
 	}
+	unrollStateFrom(ctx).handledBy("clip")
+	unrollStateFrom(ctx).noteReference(referenceDiagnostic{Field: posterField, UUID: posterUUID, Parent: event.uuid})
 
-	unrolledPoster, err := u.unrollImageSet(
-		UnrollEvent{
-			c:    posterContent[posterUUID],
-			tid:  event.tid,
-			uuid: posterUUID,
-		},
-	)
+	posters, err := u.unrollPosters(ctx, []*Reference{poster}, 1, []string{event.uuid}, event.tid)
 	if err != nil {
 		return nil, err
 	}
 
 	returnContent := event.c.clone()
-	returnContent[posterField] = unrolledPoster
+	returnContent[posterField] = posters[posterUUID]
 	return returnContent, nil
 }
 
+// clipPoster validates the clip found at path and returns its poster, if it has one.
+func clipPoster(c Content, path string) (*Reference, error) {
+	if !validateClip(c) {
+		return nil, ErrValidating
+	}
+
+	var clip Clip
+	if err := clip.decode(c.root(path)); err != nil {
+		return nil, err
+	}
+	return clip.Poster, nil
+}
+
+// unrollPosters reads the image sets used as posters on the given level in a single call, then reads the members
+// of all of them in another one. The unrolled posters are returned by UUID, posters and members which can't be
+// expanded within the limits of the request are marked as cut off.
+func (u *UniversalUnroller) unrollPosters(ctx context.Context, posters []*Reference, depth int, ancestors []string, tid string) (_ map[string]Content, err error) {
+	ctx, span := startSpan(ctx, "unrollPosters", attrDepth.Int(depth))
+	defer func() { endSpan(span, err) }()
+
+	state := unrollStateFrom(ctx)
+	var posterUUIDs []string
+	posterRefs := map[string]*Reference{}
+	for _, p := range posters {
+		posterUUID, err := p.UUID()
+		if err != nil {
+			return nil, err
+		}
+		if _, found := posterRefs[posterUUID]; found {
+			continue
+		}
+		posterUUIDs = append(posterUUIDs, posterUUID)
+		posterRefs[posterUUID] = p
+	}
+	span.SetAttributes(attrUUIDCount.Int(len(posterUUIDs)))
+
+	unrolled := make(map[string]Content, len(posterUUIDs))
+	if state.exceedsDepth(depth) {
+		for _, posterUUID := range posterUUIDs {
+			state.noteStatus(posterUUID, referenceCutOff, cutoffMaxDepth)
+			unrolled[posterUUID] = state.cutoff(posterRefs[posterUUID].toContent(), cutoffMaxDepth)
+		}
+		return unrolled, nil
+	}
+
+	posterContent, cutoffs, err := readWithinLimits(ctx, u.reader.Get, posterUUIDs, ancestors, tid)
+	if err != nil {
+		return nil, err
+	}
+
+	var imageUUIDs []string
+	posterImages := map[string][]string{}
+	for _, posterUUID := range posterUUIDs {
+		if _, isCut := cutoffs[posterUUID]; isCut {
+			continue
+		}
+		if _, found := posterContent[posterUUID]; !found {
+			state.broken(referenceDiagnostic{Field: posterField, UUID: posterUUID})
+			continue
+		}
+		members, err := imageSetMemberUUIDs(posterContent[posterUUID], posterRefs[posterUUID].path)
+		if err != nil {
+			return nil, err
+		}
+		posterImages[posterUUID] = members
+		for _, imageUUID := range members {
+			state.noteReference(referenceDiagnostic{Field: membersField, UUID: imageUUID, Parent: posterUUID})
+		}
+		imageUUIDs = append(imageUUIDs, members...)
+	}
+
+	images := map[string]Content{}
+	imageCutoffs := map[string]string{}
+	switch {
+	case len(imageUUIDs) == 0:
+	case state.exceedsDepth(depth + 1):
+		for _, imageUUID := range imageUUIDs {
+			imageCutoffs[imageUUID] = cutoffMaxDepth
+			state.noteStatus(imageUUID, referenceCutOff, cutoffMaxDepth)
+		}
+	default:
+		images, imageCutoffs, err = readWithinLimits(ctx, u.reader.Get, imageUUIDs, ancestors, tid)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, posterUUID := range posterUUIDs {
+		if reason, isCut := cutoffs[posterUUID]; isCut {
+			unrolled[posterUUID] = state.cutoff(posterRefs[posterUUID].toContent(), reason)
+			continue
+		}
+		poster, found := posterContent[posterUUID]
+		switch {
+		case !found:
+			unrolled[posterUUID] = posterRefs[posterUUID].toContent()
+		case len(posterImages[posterUUID]) == 0:
+			unrolled[posterUUID] = poster
+		default:
+			unrolled[posterUUID] = u.withImageSetMembers(poster, posterUUID, posterImages[posterUUID], images, imageCutoffs, state)
+		}
+	}
+	return unrolled, nil
+}
+
 func validateClip(clip Content) bool {
 	return checkType(clip, ClipType)
 }
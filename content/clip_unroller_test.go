@@ -1,6 +1,7 @@
 package content
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -111,7 +112,7 @@ func TestClipUnroller_Unroll(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			u := NewUniversalUnroller(tt.fields.reader, testLogger, tt.fields.apiHost)
-			got, err := u.UnrollContent(tt.event)
+			got, err := u.UnrollContent(context.Background(), tt.event)
 			if !tt.wantErr(t, err, fmt.Sprintf("Unroll(%v)", tt.event)) {
 				return
 			}
@@ -1,58 +1,101 @@
 package content
 
 import (
-	"errors"
+	"context"
 	"fmt"
 )
 
-func (u *UniversalUnroller) unrollClipSet(event UnrollEvent) (Content, error) {
+func (u *UniversalUnroller) unrollClipSet(ctx context.Context, event UnrollEvent) (_ Content, err error) {
+	ctx, span := startSpan(ctx, "unrollClipSet", attrUUID.String(event.uuid))
+	defer func() { endSpan(span, err) }()
+
 	if !validateClipset(event.c) {
 		return nil, ErrValidating
 	}
 
-	members, ok := event.c[membersField].([]interface{})
-	if !ok {
-		return nil, ErrConverting
+	var clipSet ClipSet
+	if err := clipSet.decode(event.c.root("")); err != nil {
+		return nil, err
 	}
-	if len(members) == 0 {
+	if len(clipSet.Members) == 0 {
 		return event.c, nil
 	}
 
-	clipUUIDAndFormat := map[string]string{} //TODO: This solution should be optimised to avoid using a map. Maybe using a single for loop can fix this.
+	clipMembers := map[string]ClipSetMember{} //TODO: This solution should be optimised to avoid using a map. Maybe using a single for loop can fix this.
 	var clipUUIDs []string
-	for _, m := range members {
-		memberMap := m.(map[string]interface{})
-		memberID, ok := memberMap["id"].(string)
-		if !ok {
-			return nil, ErrConverting
-		}
-		uuid, err := extractUUIDFromString(memberID)
+	for _, m := range clipSet.Members {
+		uuid, err := m.UUID()
 		if err != nil {
 			return nil, err
 		}
-		clipUUIDs = append(clipUUIDs, uuid)
-		clipUUIDAndFormat[uuid], ok = memberMap[formatField].(string)
-		if !ok {
-			return nil, errors.Join(ErrConverting, fmt.Errorf("missing format field for clip %s", uuid))
+		if m.Format == nil {
+			return nil, fmt.Errorf("missing format field for clip %s: %w", uuid, &PathError{Path: joinPath(m.path, formatField), Want: "string"})
 		}
+		clipUUIDs = append(clipUUIDs, uuid)
+		clipMembers[uuid] = m
 	}
 
-	clips, err := u.reader.Get(clipUUIDs, event.tid)
+	span.SetAttributes(attrUUIDCount.Int(len(clipUUIDs)))
+	state := unrollStateFrom(ctx)
+	state.handledBy("clipset")
+	for i, clipUUID := range clipUUIDs {
+		state.noteReference(referenceDiagnostic{Field: fmt.Sprintf("%s[%d]", membersField, i), UUID: clipUUID, Parent: event.uuid})
+	}
+	ancestors := []string{event.uuid}
+	clips, cutoffs, err := readWithinLimits(ctx, u.reader.Get, clipUUIDs, ancestors, event.tid)
 	if err != nil {
 		return nil, err
 	}
 
-	var unrolledClips []Content
-	for _, clipUUID := range clipUUIDs {
-		unrolledClip, err := u.unrollClip(UnrollEvent{
-			c:    clips[clipUUID],
-			tid:  event.tid,
-			uuid: clipUUID,
-		})
+	clipPosters := map[string]*Reference{}
+	var posters []*Reference
+	for i, clipUUID := range clipUUIDs {
+		if _, isCut := cutoffs[clipUUID]; isCut {
+			continue
+		}
+		if _, found := clips[clipUUID]; !found {
+			state.broken(referenceDiagnostic{Field: fmt.Sprintf("%s[%d]", membersField, i), UUID: clipUUID, Parent: event.uuid})
+			continue
+		}
+		poster, err := clipPoster(clips[clipUUID], clipMembers[clipUUID].path)
+		if err != nil {
+			return nil, err
+		}
+		if poster != nil {
+			posterUUID, err := poster.UUID()
+			if err != nil {
+				return nil, err
+			}
+			state.noteReference(referenceDiagnostic{Field: posterField, UUID: posterUUID, Parent: clipUUID})
+			clipPosters[clipUUID] = poster
+			posters = append(posters, poster)
+		}
+	}
+
+	var unrolledPosters map[string]Content
+	if len(posters) > 0 {
+		// clips are on the first level below the clip set, so their posters are on the second one
+		unrolledPosters, err = u.unrollPosters(ctx, posters, 2, ancestors, event.tid)
 		if err != nil {
 			return nil, err
 		}
-		unrolledClip[formatField] = clipUUIDAndFormat[clipUUID] //TODO: Reformat this
+	}
+
+	var unrolledClips []Content
+	for _, clipUUID := range clipUUIDs {
+		var unrolledClip Content
+		if reason, isCut := cutoffs[clipUUID]; isCut {
+			unrolledClip = state.cutoff(clipMembers[clipUUID].toContent(), reason)
+		} else if clip, found := clips[clipUUID]; found {
+			unrolledClip = clip.clone()
+		} else {
+			unrolledClip = clipMembers[clipUUID].toContent()
+		}
+		if poster, found := clipPosters[clipUUID]; found {
+			posterUUID, _ := poster.UUID()
+			unrolledClip[posterField] = unrolledPosters[posterUUID]
+		}
+		unrolledClip[formatField] = *clipMembers[clipUUID].Format //TODO: Reformat this
 		unrolledClips = append(unrolledClips, unrolledClip)
 	}
 
@@ -1,6 +1,7 @@
 package content
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -12,14 +13,22 @@ type mockUnroller struct {
 	unrollFunc func(event UnrollEvent) (Content, error)
 }
 
-func (m mockUnroller) UnrollContent(event UnrollEvent) (Content, error) {
+func (m mockUnroller) UnrollContent(_ context.Context, event UnrollEvent) (Content, error) {
 	return m.unrollFunc(event)
 }
 
-func (m mockUnroller) UnrollInternalContent(event UnrollEvent) (Content, error) {
+func (m mockUnroller) UnrollInternalContent(_ context.Context, event UnrollEvent) (Content, error) {
 	return m.unrollFunc(event)
 }
 
+func (m mockUnroller) PlanContent(_ UnrollEvent) (Plan, error) {
+	return Plan{}, nil
+}
+
+func (m mockUnroller) PlanInternalContent(_ UnrollEvent) (Plan, error) {
+	return Plan{}, nil
+}
+
 func TestClipsetUnroller_Unroll(t *testing.T) {
 	testLogger := logger.NewUPPLogger("test-service", "Error")
 	defaultAPIHost := "test.api.ft.com"
@@ -123,7 +132,7 @@ func TestClipsetUnroller_Unroll(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			u := NewUniversalUnroller(tt.unrollerFields.reader, testLogger, tt.unrollerFields.apiHost)
-			got, err := u.UnrollContent(tt.event)
+			got, err := u.UnrollContent(context.Background(), tt.event)
 			if !tt.wantErr(t, err, fmt.Sprintf("Unroll(%v)", tt.event)) {
 				return
 			}
@@ -172,3 +181,129 @@ func Test_validateClipset(t *testing.T) {
 		})
 	}
 }
+
+func TestUnrollClipSet_MalformedMember(t *testing.T) {
+	unroller := UniversalUnroller{}
+	c := Content{
+		typeField: ClipSetType,
+		membersField: []interface{}{
+			map[string]interface{}{id: "http://www.ft.com/thing/f6074f3c-b331-4a89-963c-f72eaf3895ae", formatField: "standardInline"},
+			"http://www.ft.com/thing/f5e1294c-7a47-4107-a5c4-9b6bfeb9efed",
+		},
+	}
+
+	_, err := unroller.unrollClipSet(context.Background(), UnrollEvent{c, "tid_sample", "sample_uuid"})
+	path, found := malformedPath(err)
+	assert.True(t, found)
+	assert.Equal(t, "members[1]", path)
+}
+
+func TestUnrollClipSet_PostersAreReadInOneCall(t *testing.T) {
+	clipUUIDs := []string{"c96a594e-2466-422e-9aed-200abdc4de1c", "c96a594e-2466-422e-9aed-200abdc4de1d", "c96a594e-2466-422e-9aed-200abdc4de1e"}
+	imageUUID := "e37aa9c0-69bd-4bd0-8874-c90f0a265894"
+
+	var members []interface{}
+	readerContent := map[string]Content{
+		imageUUID: {id: "http://www.ft.com/thing/" + imageUUID, typeField: "http://www.ft.com/ontology/content/Image"},
+	}
+	for i, clipUUID := range clipUUIDs {
+		posterUUID := fmt.Sprintf("99d3c5f9-eeee-461f-a0d8-13f671fa17a%d", i)
+		members = append(members, map[string]interface{}{id: "http://www.ft.com/thing/" + clipUUID, formatField: "standardInline"})
+		readerContent[clipUUID] = Content{
+			id:          "http://www.ft.com/thing/" + clipUUID,
+			typeField:   ClipType,
+			posterField: map[string]interface{}{apiURLField: "https://api.ft.com/content/" + posterUUID},
+		}
+		readerContent[posterUUID] = Content{
+			id:           "http://www.ft.com/thing/" + posterUUID,
+			typeField:    ImageSetType,
+			membersField: []interface{}{map[string]interface{}{id: "http://www.ft.com/thing/" + imageUUID}},
+		}
+	}
+
+	calls := 0
+	u := NewUniversalUnroller(&ReaderMock{
+		mockGet: func(uuids []string, _ string) (map[string]Content, error) {
+			calls++
+			res := map[string]Content{}
+			for _, uuid := range uuids {
+				res[uuid] = readerContent[uuid]
+			}
+			return res, nil
+		},
+	}, logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com")
+
+	actual, err := u.UnrollContent(context.Background(), UnrollEvent{Content{typeField: ClipSetType, membersField: members}, "tid_sample", "sample_uuid"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls, "Clips, their posters and the poster images should be read with one call each")
+
+	for _, clip := range actual[membersField].([]Content) {
+		poster := clip[posterField].(Content)
+		assert.Equal(t, []Content{readerContent[imageUUID]}, poster[membersField])
+	}
+}
+
+func TestUnrollClipSet_MissingClipIsLeftAsReference(t *testing.T) {
+	clipUUID := "c96a594e-2466-422e-9aed-200abdc4de1c"
+	u := NewUniversalUnroller(&ReaderMock{
+		mockGet: func(_ []string, _ string) (map[string]Content, error) {
+			return map[string]Content{}, nil
+		},
+	}, logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com")
+	clipSet := Content{
+		id:           "http://www.ft.com/thing/3863a40b-0cee-4e5e-8396-8434f6eaf2aa",
+		typeField:    ClipSetType,
+		membersField: []interface{}{map[string]interface{}{id: "https://api-t.ft.com/content/" + clipUUID, formatField: "mobile"}},
+	}
+	event := UnrollEvent{c: clipSet, tid: "tid_sample", uuid: "3863a40b-0cee-4e5e-8396-8434f6eaf2aa"}
+
+	state := newUnrollState(Limits{})
+	actual, err := u.UnrollContent(withUnrollState(context.Background(), state), event)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []Content{{id: "https://api-t.ft.com/content/" + clipUUID, formatField: "mobile"}}, actual[membersField])
+	assert.Equal(t, []referenceDiagnostic{
+		{Field: "members[0]", UUID: clipUUID, Parent: event.uuid, Status: referenceMissing},
+	}, state.brokenReferences())
+
+	strict := newUnrollState(Limits{})
+	strict.mode = StrictMode
+	_, err = u.UnrollContent(withUnrollState(context.Background(), strict), event)
+	var ue *UnrollError
+	assert.ErrorAs(t, err, &ue)
+	assert.Equal(t, CodeBrokenReferences, ue.Code)
+}
+
+func TestUnrollClipSet_FailedClipRead(t *testing.T) {
+	clipUUID := "c96a594e-2466-422e-9aed-200abdc4de1c"
+	u := NewUniversalUnroller(&ReaderMock{
+		mockGet: func(_ []string, _ string) (map[string]Content, error) {
+			return nil, ErrConnectingToAPI
+		},
+	}, logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com")
+	clipSet := Content{
+		id:           "http://www.ft.com/thing/3863a40b-0cee-4e5e-8396-8434f6eaf2aa",
+		typeField:    ClipSetType,
+		membersField: []interface{}{map[string]interface{}{id: "https://api-t.ft.com/content/" + clipUUID, formatField: "mobile"}},
+	}
+	event := UnrollEvent{c: clipSet, tid: "tid_sample", uuid: "3863a40b-0cee-4e5e-8396-8434f6eaf2aa"}
+	failedRef := referenceDiagnostic{Field: "members[0]", UUID: clipUUID, Parent: event.uuid, Status: referenceFailed, Reason: ErrConnectingToAPI.Error()}
+
+	_, err := u.UnrollContent(context.Background(), event)
+	assert.ErrorIs(t, err, ErrConnectingToAPI, "The read error should fail the request by default")
+
+	lenient := newUnrollState(Limits{})
+	lenient.mode = LenientMode
+	actual, err := u.UnrollContent(withUnrollState(context.Background(), lenient), event)
+	assert.NoError(t, err)
+	assert.Equal(t, []Content{{id: "https://api-t.ft.com/content/" + clipUUID, formatField: "mobile"}}, actual[membersField])
+	assert.Equal(t, []referenceDiagnostic{failedRef}, lenient.brokenReferences())
+
+	strict := newUnrollState(Limits{})
+	strict.mode = StrictMode
+	_, err = u.UnrollContent(withUnrollState(context.Background(), strict), event)
+	var ue *UnrollError
+	assert.ErrorAs(t, err, &ue)
+	assert.Equal(t, CodeBrokenReferences, ue.Code)
+	assert.Equal(t, []referenceDiagnostic{failedRef}, ue.references)
+}
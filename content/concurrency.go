@@ -0,0 +1,52 @@
+package content
+
+import (
+	"slices"
+	"sync"
+)
+
+// maxConcurrentFetches bounds how many calls to the content store a single unroll request makes at the same time.
+const maxConcurrentFetches = 4
+
+// runConcurrently calls every task in its own goroutine, with at most maxConcurrentFetches of them running at the
+// same time, and waits for all of them to return.
+func runConcurrently(tasks ...func()) {
+	sem := make(chan struct{}, maxConcurrentFetches)
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(task func()) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			task()
+		}(task)
+	}
+	wg.Wait()
+}
+
+// fetchBatch reads a batch of related content. It returns the batches which depend on what it read, e.g. the
+// posters of the clips it read, which are read on the next level.
+type fetchBatch func() ([]fetchBatch, error)
+
+// runLevels reads the batches level by level. The batches of a level don't depend on each other, so they are read
+// at the same time through runConcurrently, and the batches they return make up the next level. The first error
+// stops the reads after the level it happened on.
+func runLevels(level []fetchBatch) error {
+	for len(level) > 0 {
+		next := make([][]fetchBatch, len(level))
+		errs := make([]error, len(level))
+		tasks := make([]func(), len(level))
+		for i, batch := range level {
+			tasks[i] = func() { next[i], errs[i] = batch() }
+		}
+		runConcurrently(tasks...)
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+		level = slices.Concat(next...)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package content
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunConcurrently(t *testing.T) {
+	var running, maxRunning, done int32
+	var mu sync.Mutex
+	task := func() {
+		n := atomic.AddInt32(&running, 1)
+		mu.Lock()
+		if n > maxRunning {
+			maxRunning = n
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&done, 1)
+	}
+
+	tasks := make([]func(), 3*maxConcurrentFetches)
+	for i := range tasks {
+		tasks[i] = task
+	}
+	runConcurrently(tasks...)
+
+	assert.Equal(t, int32(len(tasks)), done, "All tasks should complete before returning")
+	assert.Greater(t, maxRunning, int32(1), "Tasks should run concurrently")
+	assert.LessOrEqual(t, maxRunning, int32(maxConcurrentFetches), "At most maxConcurrentFetches tasks should run at the same time")
+}
+
+func TestRunLevels(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	batch := func(name string, next ...fetchBatch) fetchBatch {
+		return func() ([]fetchBatch, error) {
+			mu.Lock()
+			order = append(order, name)
+			mu.Unlock()
+			return next, nil
+		}
+	}
+
+	err := runLevels([]fetchBatch{
+		batch("a", batch("a.1"), batch("a.2", batch("a.2.1"))),
+		batch("b", batch("b.1")),
+	})
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"a", "b"}, order[:2], "The first level should be read first")
+	assert.ElementsMatch(t, []string{"a.1", "a.2", "b.1"}, order[2:5], "The batches depending on the first level should be read next")
+	assert.Equal(t, []string{"a.2.1"}, order[5:])
+}
+
+func TestRunLevels_StopsAfterTheLevelFailing(t *testing.T) {
+	readNext := false
+	err := runLevels([]fetchBatch{
+		func() ([]fetchBatch, error) { return nil, ErrConnectingToAPI },
+		func() ([]fetchBatch, error) {
+			return []fetchBatch{func() ([]fetchBatch, error) { readNext = true; return nil, nil }}, nil
+		},
+	})
+
+	assert.ErrorIs(t, err, ErrConnectingToAPI)
+	assert.False(t, readNext)
+}
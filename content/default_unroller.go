@@ -1,16 +1,27 @@
 package content
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
 
 	"github.com/Financial-Times/go-logger/v2"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// defaultRules are used by the unrollers created without rules.
+var defaultRules = DefaultRules()
+
 type DefaultUnroller struct {
 	reader  Reader
 	log     *logger.UPPLogger
 	apiHost string
+	// rules declare the references expanded, the default rules are used when they are not set.
+	rules []ContentRules
 }
 
 func NewDefaultUnroller(r Reader, log *logger.UPPLogger, apiHost string) *DefaultUnroller {
@@ -21,173 +32,585 @@ func NewDefaultUnroller(r Reader, log *logger.UPPLogger, apiHost string) *Defaul
 	}
 }
 
-func (u *DefaultUnroller) Unroll(req UnrollEvent) (Content, error) {
-	if !validateDefaultContent(req.c) {
-		return req.c, ErrValidating
+func (u *DefaultUnroller) Unroll(ctx context.Context, req UnrollEvent) (_ Content, err error) {
+	ctx, span := startSpan(ctx, "DefaultUnroller.Unroll", attrUUID.String(req.uuid))
+	defer func() { endSpan(span, err) }()
+
+	rules, err := selectRules(u.contentRules(), req.c)
+	if err != nil {
+		return req.c, err
 	}
 
-	cc := req.c.clone()
+	ctx = ensureUnrollState(ctx)
+	unrollStateFrom(ctx).handledBy("default")
+	return u.expand(ctx, req, rules)
+}
 
-	schema := u.createContentSchema(cc, []string{ImageSetType, DynamicContentType, ClipSetType}, req.tid, req.uuid)
-	if schema == nil {
-		return cc, nil
+func (u *DefaultUnroller) contentRules() []ContentRules {
+	if u.rules == nil {
+		return defaultRules.Content
 	}
+	return u.rules
+}
 
-	contentMap, err := u.reader.Get(schema.toArray(), req.tid)
-	if err != nil {
-		return req.c, errors.Join(err, fmt.Errorf("error while getting expanded content for uuid: %v", req.uuid))
+// selectRules returns the rules for the content, failing for content the rules don't accept.
+func selectRules(rules []ContentRules, c Content) (ContentRules, error) {
+	cr, found := match(rules, c)
+	if !found || !cr.accepts(c) {
+		return ContentRules{}, ErrValidating
 	}
-	u.resolveModelsForSetsMembers(schema, contentMap, req.tid, req.tid)
+	return cr, nil
+}
 
-	mainImageUUID := schema.get(mainImageField)
-	if mainImageUUID != "" {
-		cc[mainImageField] = contentMap[mainImageUUID]
+// expand reads the related content referenced as declared by the rules and sets it in place of the references.
+func (u *DefaultUnroller) expand(ctx context.Context, req UnrollEvent, rules ContentRules) (Content, error) {
+	cc := req.c.deepClone()
+	schema, err := u.createContentSchema(cc, rules, req.tid, req.uuid)
+	if err != nil {
+		return req.c, err
 	}
+	if err := u.indexBody(ctx, cc); err != nil {
+		return req.c, err
+	}
+	if len(schema.toArray()) == 0 {
+		u.log.WithUUID(req.uuid).WithTransactionID(req.tid).Debugf("No related content to expand for supplied content %s", req.uuid)
+		return cc, nil
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attrUUIDCount.Int(len(schema.toArray())))
 
-	embeddedContentUUIDs := schema.getAll(embeds)
-	if len(embeddedContentUUIDs) > 0 {
-		embedded := []Content{}
-		for _, emb := range embeddedContentUUIDs {
-			embedded = append(embedded, contentMap[emb])
+	// the references of every rule are read at the same time, and the posters of the members of the sets read are
+	// read on the following levels
+	var sets *setResolver
+	if slices.ContainsFunc(rules.References, func(rule ReferenceRule) bool { return rule.ExpandSets }) {
+		sets = u.newSetResolver(ctx, req.tid, req.uuid)
+	}
+	var mu sync.Mutex
+	byResolver := map[string]referenceRead{}
+	var batches []fetchBatch
+	for _, b := range schema.batches() {
+		read := u.reader.Get
+		if b.resolve == ResolveInternal {
+			read = u.reader.GetInternal
 		}
-		cc[embeds] = embedded
+		batches = append(batches, func() ([]fetchBatch, error) {
+			r := u.readReferences(ctx, read, b.uuids, req.tid, req.uuid)
+			if r.err != nil {
+				// reads only fail in the default mode, where the rule tells whether the request fails with them
+				if !b.rule.SkipFailedReads {
+					return nil, r.err
+				}
+				u.log.WithTransactionID(req.tid).WithUUID(req.uuid).WithError(r.err).Errorf("Skipping the expansion of %s", b.rule.Field)
+				unrollStateFrom(ctx).readFailed(b.uuids, r.err)
+				r = referenceRead{skipped: map[string]bool{}}
+				for _, uuid := range b.uuids {
+					r.skipped[uuid] = true
+				}
+			}
+			mu.Lock()
+			byResolver[b.resolve] = byResolver[b.resolve].merge(r)
+			mu.Unlock()
+			if sets == nil || b.resolve != ResolvePublic {
+				return nil, nil
+			}
+			sets.add(r.content)
+			return sets.posterBatches(schema.setUUIDs(b.uuids, r.cutoffs), 3), nil
+		})
+	}
+	if err := runLevels(batches); err != nil {
+		return req.c, err
 	}
 
-	promImgUUID := schema.get(promotionalImage)
-	if promImgUUID != "" {
-		pi, found := contentMap[promImgUUID]
-		if found {
-			cc[altImagesField].(map[string]interface{})[promotionalImage] = pi
+	if public, found := byResolver[ResolvePublic]; found && sets != nil {
+		public.resolved, err = sets.resolveModelsForSetsMembers(schema.setUUIDs(schema.toArray(), public.cutoffs))
+		if err != nil {
+			return req.c, err
 		}
+		byResolver[ResolvePublic] = public
 	}
 
+	// every UUID is read once and placed in all the places using it
+	state := unrollStateFrom(ctx)
+	for _, relatedUUID := range schema.toArray() {
+		for _, ref := range schema.refsTo(relatedUUID) {
+			diag := referenceDiagnostic{Field: ref.path, UUID: relatedUUID}
+			state.noteReference(diag)
+			read := byResolver[ref.rule.resolve()]
+			_, wasRead := read.content[relatedUUID]
+			reason, isCut := read.cutoffs[relatedUUID]
+			switch {
+			case isCut:
+				ref.place(state.cutoff(u.unexpanded(ref), reason))
+			case read.skipped[relatedUUID]:
+				state.broken(diag)
+			case !wasRead:
+				state.broken(diag)
+				// missing content is left as the reference to it, unless the rules keep the referencing object
+				if !ref.rule.KeepMissing && ref.rule.Into == "" {
+					ref.place(Content{id: createID(u.apiHost, "content", relatedUUID)})
+				}
+			case ref.rule.Into != "":
+				ref.holder[ref.rule.Into] = read.get(relatedUUID)
+			default:
+				ref.place(read.get(relatedUUID))
+			}
+		}
+	}
+	dropSkippedEmbeds(cc, rules)
+	if err := u.inlineBody(ctx, cc, rules); err != nil {
+		return req.c, err
+	}
 	return cc, nil
 }
 
-func (u *DefaultUnroller) createContentSchema(cc Content, acceptedTypes []string, tid string, uuid string) Schema {
-	schema := make(Schema)
+// indexBody indexes the tags embedding content in the body, when the request asks for it.
+func (u *DefaultUnroller) indexBody(ctx context.Context, cc Content) error {
+	body, isString := cc[bodyXMLField].(string)
+	if !unrollStateFrom(ctx).indexEmbeds || !isString {
+		return nil
+	}
+	indexed, err := indexEmbeds(body)
+	if err != nil {
+		return &PathError{Path: bodyXMLField, Want: "XML", Got: body, Err: err}
+	}
+	cc[bodyXMLField] = indexed
+	return nil
+}
+
+// dropSkippedEmbeds removes the embeds which were skipped from the fields of the embedded content, and the fields
+// left empty, so that skipped embeds are left out like they always were.
+func dropSkippedEmbeds(cc Content, rules ContentRules) {
+	for _, rule := range rules.References {
+		embedded, isSet := cc[rule.Field].([]Content)
+		if !rule.embedded() || !isSet {
+			continue
+		}
+		embedded = slices.DeleteFunc(embedded, func(c Content) bool { return c == nil })
+		if len(embedded) == 0 {
+			delete(cc, rule.Field)
+			continue
+		}
+		cc[rule.Field] = embedded
+	}
+}
+
+// referenceRead holds the related content read from one endpoint, the related content cut off by the limits, and
+// the related content left unexpanded as it could not be read.
+type referenceRead struct {
+	content  map[string]Content
+	resolved map[string]Content
+	cutoffs  map[string]string
+	skipped  map[string]bool
+	err      error
+}
+
+// merge returns the content read, cut off and skipped by both reads.
+func (r referenceRead) merge(other referenceRead) referenceRead {
+	if r.content == nil {
+		r.content, r.cutoffs, r.skipped = map[string]Content{}, map[string]string{}, map[string]bool{}
+	}
+	maps.Copy(r.content, other.content)
+	maps.Copy(r.cutoffs, other.cutoffs)
+	maps.Copy(r.skipped, other.skipped)
+	return r
+}
+
+// get returns the related content, with the members of sets expanded if they were.
+func (r referenceRead) get(uuid string) Content {
+	if c, found := r.resolved[uuid]; found {
+		return c
+	}
+	return r.content[uuid]
+}
 
-	localLog := u.log.WithUUID(uuid).WithTransactionID(tid)
+func (u *DefaultUnroller) readReferences(ctx context.Context, read ReaderFunc, uuids []string, tid string, uuid string) (r referenceRead) {
+	ctx, span := startSpan(ctx, "readReferences", attrUUIDCount.Int(len(uuids)))
+	defer func() { endSpan(span, r.err) }()
 
-	//mainImageField
-	mainImageUUID, foundMainImg := extractMainImageContentByType(cc, u.log, tid, uuid)
-	if foundMainImg {
-		schema.put(mainImageField, mainImageUUID)
+	r.content, r.cutoffs, r.err = readWithinLimits(ctx, read, uuids, []string{uuid}, tid)
+	if r.err != nil {
+		r.err = errors.Join(r.err, fmt.Errorf("error while getting expanded content for uuid: %v", uuid))
 	}
+	return r
+}
 
-	//embedded - images and dynamic content
-	emContentUUIDs, foundEmbedded := extractEmbeddedContentByType(cc, u.log, acceptedTypes, tid, uuid)
-	if foundEmbedded {
-		schema.putAll(embeds, emContentUUIDs)
+// unexpanded returns the reference as it was before being expanded.
+func (u *DefaultUnroller) unexpanded(ref schemaRef) Content {
+	if ref.holder != nil {
+		return fromMap(ref.holder)
 	}
+	return Content{id: createID(u.apiHost, "content", ref.uuid)}
+}
 
-	//promotional image
-	var foundPromImg bool
-	altImg, found := cc[altImagesField].(map[string]interface{})
-	if found {
-		var promImg map[string]interface{}
-		promImg, foundPromImg = altImg[promotionalImage].(map[string]interface{})
-		if foundPromImg {
-			if id, ok := promImg[id].(string); ok {
-				u, err := extractUUIDFromString(id)
-				if err != nil {
-					localLog.WithError(err).Errorf("Cannot find promotional image: %v. Skipping expanding promotional image", err.Error())
-					foundPromImg = false
-				} else {
-					schema.put(promotionalImage, u)
-				}
-			} else {
-				localLog.Debug("Promotional image is missing the id field. Skipping expanding promotional image")
-				foundPromImg = false
+// createContentSchema finds the references declared by the rules in cc. Arrays holding references are replaced by
+// lists of their objects, and the fields holding the content embedded in the body are set, so that the related
+// content can be placed in cc.
+func (u *DefaultUnroller) createContentSchema(cc Content, rules ContentRules, tid string, uuid string) (*Schema, error) {
+	schema := newSchema()
+
+	var article Article
+	if err := article.decode(cc.root("")); err != nil {
+		return nil, err
+	}
+
+	for i := range rules.References {
+		rule := &rules.References[i]
+		if rule.embedded() {
+			emContent, found := extractEmbeddedContentByType(article, u.log, rule.EmbeddedTypes, tid, uuid)
+			if !found {
+				continue
+			}
+			// every embed carries the attributes of its own instance, so the content read is copied for each of them
+			embedded := make([]Content, len(emContent))
+			cc[rule.Field] = embedded
+			for j, e := range emContent {
+				schema.add(e.UUID, schemaRef{
+					rule:  rule,
+					path:  fmt.Sprintf("%s[%d]", rule.Field, j),
+					place: func(c Content) { embedded[j] = withEmbed(c, e) },
+				})
 			}
-		} else {
-			localLog.Debug("Cannot find promotional image. Skipping expanding promotional image")
+			continue
+		}
+		f := referenceFinder{DefaultUnroller: u, schema: schema, rule: rule, tid: tid, uuid: uuid}
+		if err := f.find(cc, "", strings.Split(rule.Field, ".")); err != nil {
+			return nil, err
 		}
 	}
+	return schema, nil
+}
+
+// referenceFinder adds the references found in the field of a rule to the schema.
+type referenceFinder struct {
+	*DefaultUnroller
+	schema *Schema
+	rule   *ReferenceRule
+	tid    string
+	uuid   string
+}
 
-	if !foundMainImg && !foundEmbedded && !foundPromImg {
-		localLog.Debugf("No main image or promotional image or embedded content to expand for supplied content %s", uuid)
+// find walks the segments of the field starting from obj, found at path. Missing and null fields are skipped.
+func (f referenceFinder) find(obj Content, path string, segments []string) error {
+	name, isArray := strings.CutSuffix(segments[0], "[]")
+	v := obj.root(path).field(name)
+	if !v.exists() || v.v == nil {
 		return nil
 	}
+	if !isArray {
+		child, err := v.object()
+		if err != nil {
+			return err
+		}
+		return f.found(v, child, segments[1:], func(c Content) { obj[name] = c })
+	}
 
-	return schema
+	arr, err := v.array()
+	if err != nil {
+		return err
+	}
+	items := make([]Content, len(arr))
+	for i := range arr {
+		if items[i], err = v.index(i).object(); err != nil {
+			return err
+		}
+	}
+	obj[name] = items
+	for i := range items {
+		if err := f.found(v.index(i), items[i], segments[1:], func(c Content) { items[i] = c }); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (u *DefaultUnroller) resolveModelsForSetsMembers(b Schema, imgMap map[string]Content, tid string, uuid string) {
-	mainImageUUID := b.get(mainImageField)
-	u.resolveImageSet(mainImageUUID, imgMap, tid, uuid)
-	for _, embeddedImgSet := range b.getAll(embeds) {
-		u.resolveImageSet(embeddedImgSet, imgMap, tid, uuid)
+// found adds the reference held by obj, or carries on walking the remaining segments.
+func (f referenceFinder) found(v value, obj Content, segments []string, place func(Content)) error {
+	if len(segments) > 0 {
+		return f.find(obj, v.path, segments)
 	}
-}
 
-func (u *DefaultUnroller) resolveImageSet(imageSetUUID string, imgMap map[string]Content, tid string, uuid string) {
-	imageSet, found := resolveContent(imageSetUUID, imgMap)
-	if !found {
-		imgMap[imageSetUUID] = Content{id: createID(u.apiHost, "content", imageSetUUID)}
-		return
+	localLog := f.log.WithUUID(f.uuid).WithTransactionID(f.tid)
+	idValue := v.field(id)
+	if !idValue.exists() || idValue.v == "" {
+		if f.rule.Optional {
+			localLog.Debugf("%s is missing the id field. Skipping expanding it", v.path)
+			return nil
+		}
+		return &PathError{Path: idValue.path, Want: "string"}
 	}
+	rawID, err := idValue.str()
+	if err != nil {
+		return err
+	}
+	relatedUUID, err := extractUUIDFromString(rawID)
+	if err != nil {
+		localLog.WithError(err).Errorf("Cannot find the UUID of %s: %v. Skipping expanding it", v.path, err.Error())
+		return nil
+	}
+	f.schema.add(relatedUUID, schemaRef{rule: f.rule, path: v.path, holder: obj, place: place})
+	return nil
+}
 
-	localLog := u.log.WithUUID(uuid).WithTransactionID(tid)
+// setResolver expands the members and the posters of the sets read for a single request.
+type setResolver struct {
+	*DefaultUnroller
+	ctx   context.Context
+	state *unrollState
+	tid   string
+	uuid  string
 
-	rawMembers, found := imageSet[membersField]
-	if found {
-		membList, ok := rawMembers.([]interface{})
-		if !ok {
-			return
+	// mu guards the content read while the posters are read at the same time as other related content
+	mu         sync.Mutex
+	imgMap     map[string]Content
+	requested  map[string]bool
+	posters    map[string]bool
+	cutPosters map[string]string
+}
+
+func (u *DefaultUnroller) newSetResolver(ctx context.Context, tid string, uuid string) *setResolver {
+	return &setResolver{
+		DefaultUnroller: u,
+		ctx:             ctx,
+		state:           unrollStateFrom(ctx),
+		tid:             tid,
+		uuid:            uuid,
+		imgMap:          map[string]Content{},
+		requested:       map[string]bool{},
+		posters:         map[string]bool{},
+		cutPosters:      map[string]string{},
+	}
+}
+
+// add keeps the content read, the content read first is kept for UUIDs read more than once.
+func (r *setResolver) add(content map[string]Content) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, v := range content {
+		if _, found := r.imgMap[k]; !found {
+			r.imgMap[k] = v
 		}
+	}
+}
 
-		expMembers := []Content{}
-		for _, m := range membList {
-			mData := fromMap(m.(map[string]interface{}))
-			mID := mData[id].(string)
-			mUUID, err := extractUUIDFromString(mID)
-			if err != nil {
-				localLog.WithError(err).Errorf("Error while extracting UUID from %s: %v", mID, err.Error())
-				continue
-			}
-			mContent, found := resolveContent(mUUID, imgMap)
-			if !found {
-				expMembers = append(expMembers, mData)
-				continue
-			}
-			if _, isPoster := mContent["poster"]; isPoster {
-				resolvedPoster, err := u.resolvePoster(mContent["poster"], tid, uuid)
-				if err != nil {
-					localLog.WithError(err).Errorf("Error while getting expanded content for uuid: %s: %v", uuid, err.Error())
-				} else {
-					mContent["poster"] = resolvedPoster
-				}
+// posterBatches returns the read of the posters of the members of the sets on the given level which were not
+// requested yet, in a single call. Posters too deep to be expanded are not read.
+func (r *setResolver) posterBatches(setUUIDs []string, depth int) []fetchBatch {
+	if len(setUUIDs) == 0 || r.state.exceedsDepth(depth) {
+		return nil
+	}
+	r.mu.Lock()
+	var posterUUIDs []string
+	for _, setUUID := range setUUIDs {
+		for _, pUUID := range memberPosterUUIDs(setUUID, r.imgMap) {
+			if !r.requested[pUUID] {
+				r.requested[pUUID] = true
+				posterUUIDs = append(posterUUIDs, pUUID)
 			}
-			mData.merge(mContent)
-			expMembers = append(expMembers, mData)
 		}
-		imageSet[membersField] = expMembers
 	}
+	r.mu.Unlock()
+	if len(posterUUIDs) == 0 {
+		return nil
+	}
+	return []fetchBatch{func() ([]fetchBatch, error) {
+		return r.fetchPosters(posterUUIDs, depth)
+	}}
+}
+
+// fetchPosters reads the posters and returns the read of the posters of the members of those used as sets.
+func (r *setResolver) fetchPosters(posterUUIDs []string, depth int) (_ []fetchBatch, err error) {
+	ctx, span := startSpan(r.ctx, "fetchPosters", attrDepth.Int(depth), attrUUIDCount.Int(len(posterUUIDs)))
+	defer func() { endSpan(span, err) }()
+
+	posterContent, cut, err := readWithinLimits(ctx, r.reader.Get, posterUUIDs, nil, r.tid)
+	if err != nil {
+		// only reads in the default mode fail, where posters which could not be read are left unexpanded
+		r.log.WithTransactionID(r.tid).WithUUID(r.uuid).WithError(err).Error("Error while getting posters, leaving them unexpanded")
+		r.state.readFailed(posterUUIDs, err)
+		return nil, nil
+	}
+	r.add(posterContent)
+
+	r.mu.Lock()
+	var read []string
+	for _, pUUID := range posterUUIDs {
+		if reason, isCut := cut[pUUID]; isCut {
+			r.cutPosters[pUUID] = reason
+			continue
+		}
+		r.posters[pUUID] = true
+		read = append(read, pUUID)
+	}
+	r.mu.Unlock()
+	// the members of the posters are one level below them, and their posters another one
+	return r.posterBatches(read, depth+2), nil
 }
 
-func (u *DefaultUnroller) resolvePoster(poster interface{}, tid, uuid string) (Content, error) {
-	posterData, found := poster.(map[string]interface{})
+// resolveModelsForSetsMembers expands the members of the sets, once all the related content is read. The content
+// read is left untouched, the expanded sets are returned in a new map.
+func (r *setResolver) resolveModelsForSetsMembers(setUUIDs []string) (_ map[string]Content, err error) {
+	_, span := startSpan(r.ctx, "resolveModelsForSetsMembers", attrUUIDCount.Int(len(setUUIDs)))
+	defer func() { endSpan(span, err) }()
+
+	resolved := copyContentMap(r.imgMap)
+	for _, setUUID := range setUUIDs {
+		expanded, err := r.resolveImageSet(setUUID, 1, []string{r.uuid})
+		if err != nil {
+			return nil, err
+		}
+		resolved[setUUID] = expanded
+	}
+	return resolved, nil
+}
+
+// memberPosterUUIDs returns the UUIDs of the posters of the set members found in imgMap. Malformed members are
+// skipped here and reported while the set is resolved.
+func memberPosterUUIDs(setUUID string, imgMap map[string]Content) []string {
+	set, found := imgMap[setUUID]
 	if !found {
-		return Content{}, errors.New("problem in poster field")
+		return nil
 	}
-	papiurl := posterData[apiURLField].(string)
-	pUUID, err := extractUUIDFromString(papiurl)
+	members, err := set.field(membersField).array()
 	if err != nil {
-		return Content{}, err
+		return nil
+	}
+
+	var posterUUIDs []string
+	for _, m := range members {
+		mObj, ok := asObject(m)
+		if !ok {
+			continue
+		}
+		mID, _ := mObj[id].(string)
+		mUUID, err := extractUUIDFromString(mID)
+		if err != nil {
+			continue
+		}
+		mContent, found := imgMap[mUUID]
+		if !found {
+			continue
+		}
+		if pUUID, err := mContent.field(posterField).field(apiURLField).uuid(); err == nil {
+			posterUUIDs = append(posterUUIDs, pUUID)
+		}
+	}
+	return posterUUIDs
+}
+
+// resolveImageSet returns a copy of the set on the given level having its members expanded with the content
+// in imgMap. Members which are one of their ancestors or are too deep are marked as cut off instead.
+func (r *setResolver) resolveImageSet(imageSetUUID string, depth int, ancestors []string) (_ Content, err error) {
+	_, span := startSpan(r.ctx, "resolveImageSet", attrUUID.String(imageSetUUID), attrDepth.Int(depth))
+	defer func() { endSpan(span, err) }()
+
+	imageSet, found := resolveContent(imageSetUUID, r.imgMap)
+	if !found {
+		return Content{id: createID(r.apiHost, "content", imageSetUUID)}, nil
+	}
+
+	localLog := r.log.WithUUID(r.uuid).WithTransactionID(r.tid)
+
+	members := imageSet.root(imageSetUUID).field(membersField)
+	if !members.exists() {
+		return imageSet, nil
+	}
+	if _, err := members.array(); err != nil {
+		return imageSet, nil
 	}
-	posterContent, err := u.reader.Get([]string{pUUID}, tid)
+
+	ancestors = append(slices.Clip(ancestors), imageSetUUID)
+	expMembers := []Content{}
+	err = members.each(func(_ int, m value) error {
+		mObj, err := m.object()
+		if err != nil {
+			return err
+		}
+		mData := fromMap(mObj)
+		mID, err := m.field(id).str()
+		if err != nil {
+			return err
+		}
+		mUUID, err := extractUUIDFromString(mID)
+		if err != nil {
+			localLog.WithError(err).Errorf("Error while extracting UUID from %s: %v", mID, err.Error())
+			return nil
+		}
+		ref := referenceDiagnostic{Field: membersField, UUID: mUUID, Parent: imageSetUUID}
+		if slices.Contains(ancestors, mUUID) {
+			r.noteCutoff(ref, cutoffCycle)
+			expMembers = append(expMembers, r.state.cutoff(mData, cutoffCycle))
+			return nil
+		}
+		if r.state.exceedsDepth(depth + 1) {
+			r.noteCutoff(ref, cutoffMaxDepth)
+			expMembers = append(expMembers, r.state.cutoff(mData, cutoffMaxDepth))
+			return nil
+		}
+		r.state.noteReference(ref)
+		mContent, found := resolveContent(mUUID, r.imgMap)
+		if !found {
+			r.state.broken(ref)
+			expMembers = append(expMembers, mData)
+			return nil
+		}
+		if _, isPoster := mContent[posterField]; isPoster {
+			resolvedPoster, err := r.resolvePoster(mContent.root(mUUID).field(posterField), depth+2, append(slices.Clip(ancestors), mUUID))
+			if err != nil {
+				localLog.WithError(err).Errorf("Error while getting expanded content for uuid: %s: %v", r.uuid, err.Error())
+			} else if resolvedPoster != nil {
+				mContent = mContent.clone()
+				mContent[posterField] = resolvedPoster
+			}
+		}
+		mData.merge(mContent)
+		expMembers = append(expMembers, mData)
+		return nil
+	})
 	if err != nil {
-		return Content{}, err
+		return nil, err
 	}
-	u.resolveImageSet(pUUID, posterContent, tid, uuid)
-	return posterContent[pUUID], nil
+	expanded := imageSet.clone()
+	expanded[membersField] = expMembers
+	return expanded, nil
 }
 
-func validateDefaultContent(content Content) bool {
-	_, hasMainImage := content[mainImageField]
-	_, hasBody := content[bodyXMLField]
-	_, hasAltImg := content[altImagesField].(map[string]interface{})
+// resolvePoster expands a poster read by fetchPosters. Nil is returned for posters which could not be read.
+func (r *setResolver) resolvePoster(poster value, depth int, ancestors []string) (_ Content, err error) {
+	_, span := startSpan(r.ctx, "resolvePoster", attrDepth.Int(depth))
+	defer func() { endSpan(span, err) }()
+
+	pUUID, err := poster.field(apiURLField).uuid()
+	if err != nil {
+		return nil, err
+	}
+	posterRef, err := poster.object()
+	if err != nil {
+		return nil, err
+	}
+
+	ref := referenceDiagnostic{Field: posterField, UUID: pUUID, Parent: ancestors[len(ancestors)-1]}
+	switch {
+	case slices.Contains(ancestors, pUUID):
+		r.noteCutoff(ref, cutoffCycle)
+		return r.state.cutoff(posterRef, cutoffCycle), nil
+	case r.state.exceedsDepth(depth):
+		r.noteCutoff(ref, cutoffMaxDepth)
+		return r.state.cutoff(posterRef, cutoffMaxDepth), nil
+	}
+	r.state.noteReference(ref)
+	switch {
+	case r.cutPosters[pUUID] != "":
+		return r.state.cutoff(posterRef, r.cutPosters[pUUID]), nil
+	case !r.posters[pUUID]:
+		return nil, nil
+	}
+	if _, found := r.imgMap[pUUID]; !found {
+		r.state.broken(ref)
+		return nil, nil
+	}
+	return r.resolveImageSet(pUUID, depth, ancestors)
+}
 
-	return hasMainImage || hasBody || hasAltImg
+func (r *setResolver) noteCutoff(ref referenceDiagnostic, reason string) {
+	ref.Status, ref.Reason = referenceCutOff, reason
+	r.state.noteReference(ref)
 }
@@ -1,10 +1,14 @@
 package content
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
 	"github.com/stretchr/testify/assert"
@@ -35,7 +39,7 @@ func TestUnrollContent(t *testing.T) {
 	err = json.Unmarshal(fileBytes, &c)
 	assert.NoError(t, err, "Cannot build json body")
 	req := UnrollEvent{c, "tid_sample", "sample_uuid"}
-	actual, actualErr := cu.Unroll(req)
+	actual, actualErr := cu.Unroll(context.Background(), req)
 	assert.NoError(t, actualErr, "Should not get an error when expanding images")
 
 	actualJSON, err := json.Marshal(actual)
@@ -50,7 +54,7 @@ func TestUnrollContent_NilSchema(t *testing.T) {
 	assert.NoError(t, err, "Cannot build json body")
 
 	req := UnrollEvent{c, "tid_sample", "sample_uuid"}
-	actual, _ := cu.Unroll(req)
+	actual, _ := cu.Unroll(context.Background(), req)
 	actualJSON, err := json.Marshal(actual)
 	assert.NoError(t, err, "Expected to marshall correctly")
 
@@ -74,7 +78,7 @@ func TestUnrollContent_ErrorExpandingFromContentStore(t *testing.T) {
 	err = json.Unmarshal(fileBytes, &c)
 	assert.NoError(t, err, "Cannot build json body")
 	req := UnrollEvent{c, "tid_sample", "sample_uuid"}
-	actual, actualErr := cu.Unroll(req)
+	actual, actualErr := cu.Unroll(context.Background(), req)
 
 	actualJSON, err := json.Marshal(actual)
 	assert.NoError(t, err, "Expected to marshall correctly")
@@ -82,6 +86,66 @@ func TestUnrollContent_ErrorExpandingFromContentStore(t *testing.T) {
 	assert.Error(t, actualErr, "Expected to return error when cannot read from content store")
 }
 
+func TestUnrollContent_ReferencesAreStubbedWhenContentStoreFailsInLenientMode(t *testing.T) {
+	cu := DefaultUnroller{
+		reader: &ReaderMock{
+			mockGet: func(_ []string, _ string) (map[string]Content, error) {
+				return nil, errors.New("Cannot expand content from content store")
+			},
+		},
+		log:     logger.NewUPPLogger("test-service", "Error"),
+		apiHost: "test.api.ft.com",
+	}
+
+	var c Content
+	fileBytes, err := os.ReadFile("testdata/content-valid-request.json")
+	assert.NoError(t, err, "Cannot read necessary test file")
+	err = json.Unmarshal(fileBytes, &c)
+	assert.NoError(t, err, "Cannot build json body")
+	state := newUnrollState(Limits{})
+	state.mode = LenientMode
+	actual, err := cu.Unroll(withUnrollState(context.Background(), state), UnrollEvent{c, "tid_sample", "sample_uuid"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, Content{id: "http://test.api.ft.com/content/639cd952-149f-11e7-2ea7-a07ecd9ac73f"}, actual[mainImageField])
+	assert.Equal(t, c[altImagesField], actual[altImagesField], "The promotional image should be kept as is")
+	assert.Len(t, actual[embeds], 4)
+	warnings := state.brokenReferences()
+	assert.Len(t, warnings, 6)
+	for _, w := range warnings {
+		assert.Equal(t, referenceFailed, w.Status)
+		assert.Equal(t, "Cannot expand content from content store", w.Reason)
+	}
+	assert.NoError(t, state.checkMode())
+}
+
+func TestUnrollContent_MissingReferencesFailStrictMode(t *testing.T) {
+	imageUUID := "4723cb4e-027c-11e7-ace0-1ce02ef0def9"
+	dynamicUUID := "d02886fc-58ff-11e8-9859-6668838a4c10"
+	u := NewUniversalUnroller(&ReaderMock{
+		mockGet: func(_ []string, _ string) (map[string]Content, error) {
+			return map[string]Content{imageUUID: {id: "http://www.ft.com/thing/" + imageUUID, typeField: ImageSetType}}, nil
+		},
+	}, logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com")
+	c := Content{
+		id:             "http://www.ft.com/thing/22c0d426-1466-11e7-b0c1-37e417ee6c76",
+		typeField:      ArticleType,
+		mainImageField: map[string]interface{}{id: "http://test.api.ft.com/content/" + imageUUID},
+		bodyXMLField:   `<body><ft-content type="http://www.ft.com/ontology/content/DynamicContent" url="http://api.ft.com/content/` + dynamicUUID + `" data-embedded="true"></ft-content></body>`,
+	}
+	state := newUnrollState(Limits{})
+	state.mode = StrictMode
+
+	_, err := u.UnrollContent(withUnrollState(context.Background(), state), UnrollEvent{c, "tid_sample", "22c0d426-1466-11e7-b0c1-37e417ee6c76"})
+
+	var ue *UnrollError
+	assert.ErrorAs(t, err, &ue)
+	assert.Equal(t, CodeBrokenReferences, ue.Code)
+	assert.Equal(t, []referenceDiagnostic{
+		{Field: "embeds[0]", UUID: dynamicUUID, Status: referenceMissing},
+	}, ue.references)
+}
+
 func TestUnrollContent_SkipPromotionalImageWhenIdIsMissing(t *testing.T) {
 	expectedAltImages := map[string]interface{}{
 		"promotionalImage": map[string]interface{}{
@@ -110,7 +174,7 @@ func TestUnrollContent_SkipPromotionalImageWhenIdIsMissing(t *testing.T) {
 	err = json.Unmarshal(fileBytes, &c)
 	assert.NoError(t, err, "Cannot build json body")
 	req := UnrollEvent{c, "tid_sample", "sample_uuid"}
-	actual, actualErr := cu.Unroll(req)
+	actual, actualErr := cu.Unroll(context.Background(), req)
 
 	assert.NoError(t, actualErr, "Should not get an error when expanding images")
 	assert.Equal(t, expectedAltImages, actual[altImagesField])
@@ -144,7 +208,7 @@ func TestUnrollContent_SkipPromotionalImageWhenUUIDIsInvalid(t *testing.T) {
 	err = json.Unmarshal(fileBytes, &c)
 	assert.NoError(t, err, "Cannot build json body")
 	req := UnrollEvent{c, "tid_sample", "sample_uuid"}
-	actual, actualErr := cu.Unroll(req)
+	actual, actualErr := cu.Unroll(context.Background(), req)
 
 	assert.NoError(t, actualErr, "Should not get an error when expanding images")
 	assert.Equal(t, expectedAltImages, actual[altImagesField])
@@ -174,7 +238,210 @@ func TestUnrollContent_EmbeddedContentSkippedWhenMissingBodyXML(t *testing.T) {
 	c[bodyXMLField] = "invalid body"
 
 	req := UnrollEvent{c, "tid_sample", "sample_uuid"}
-	res, resErr := cu.Unroll(req)
+	res, resErr := cu.Unroll(context.Background(), req)
 	assert.NoError(t, resErr, "Should not receive error when body cannot be parsed.")
 	assert.Nil(t, res["embeds"], "Response should not contain embeds field")
 }
+
+func TestUnrollContent_DoesNotMutateInputOrReaderContent(t *testing.T) {
+	var readerContent map[string]Content
+	b, err := os.ReadFile("testdata/reader-content-valid-response.json")
+	assert.NoError(t, err, "Cannot open file necessary for test case")
+	assert.NoError(t, json.Unmarshal(b, &readerContent), "Cannot build reader response")
+
+	var c Content
+	fileBytes, err := os.ReadFile("testdata/content-valid-request.json")
+	assert.NoError(t, err, "Cannot read necessary test file")
+	assert.NoError(t, json.Unmarshal(fileBytes, &c), "Cannot build json body")
+
+	expected, err := os.ReadFile("testdata/content-valid-response.json")
+	assert.NoError(t, err, "Cannot read necessary test file")
+
+	cu := DefaultUnroller{
+		reader: &ReaderMock{
+			mockGet: func(_ []string, _ string) (map[string]Content, error) {
+				return readerContent, nil
+			},
+		},
+		log:     logger.NewUPPLogger("test-service", "Error"),
+		apiHost: "test.api.ft.com",
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			actual, err := cu.Unroll(context.Background(), UnrollEvent{c, "tid_sample", "sample_uuid"})
+			assert.NoError(t, err, "Should not get an error when expanding images")
+			actualJSON, err := json.Marshal(actual)
+			assert.NoError(t, err, "Expected to marshall correctly")
+			assert.JSONEq(t, string(expected), string(actualJSON))
+		}()
+	}
+	wg.Wait()
+
+	actualInput, err := json.Marshal(c)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(fileBytes), string(actualInput), "Input content should not be changed")
+	actualReaderContent, err := json.Marshal(readerContent)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(b), string(actualReaderContent), "Content returned by the reader should not be changed")
+}
+
+func TestUnrollContent_ClipPostersAreReadInOneCall(t *testing.T) {
+	clipSetUUID := "f6074f3c-b331-4a89-963c-f72eaf3895ae"
+	clipUUIDs := []string{"c96a594e-2466-422e-9aed-200abdc4de1c", "c96a594e-2466-422e-9aed-200abdc4de1d", "c96a594e-2466-422e-9aed-200abdc4de1e"}
+	posterUUIDs := []string{"99d3c5f9-eeee-461f-a0d8-13f671fa17ae", "99d3c5f9-eeee-461f-a0d8-13f671fa17af", "99d3c5f9-eeee-461f-a0d8-13f671fa17b0"}
+
+	var members []interface{}
+	readerContent := map[string]Content{}
+	for i, clipUUID := range clipUUIDs {
+		members = append(members, map[string]interface{}{id: "http://www.ft.com/thing/" + clipUUID, formatField: "standardInline"})
+		readerContent[clipUUID] = Content{
+			id:        "http://www.ft.com/thing/" + clipUUID,
+			typeField: ClipType,
+			posterField: map[string]interface{}{
+				apiURLField: "https://api.ft.com/content/" + posterUUIDs[i],
+				typeField:   ImageSetType,
+			},
+		}
+	}
+	readerContent[clipSetUUID] = Content{id: "http://www.ft.com/thing/" + clipSetUUID, typeField: ClipSetType, membersField: members}
+
+	var mu sync.Mutex
+	var calls [][]string
+	cu := DefaultUnroller{
+		reader: &ReaderMock{
+			mockGet: func(uuids []string, _ string) (map[string]Content, error) {
+				mu.Lock()
+				calls = append(calls, uuids)
+				mu.Unlock()
+				// like ContentReader, members of the sets are read together with the sets
+				res := map[string]Content{}
+				for _, u := range uuids {
+					if c, found := readerContent[u]; found {
+						res[u] = c
+						for _, memberUUID := range c.getMembersUUID() {
+							res[memberUUID] = readerContent[memberUUID]
+						}
+						continue
+					}
+					res[u] = Content{id: "http://www.ft.com/thing/" + u, typeField: ImageSetType, membersField: []interface{}{}}
+				}
+				return res, nil
+			},
+		},
+		log:     logger.NewUPPLogger("test-service", "Error"),
+		apiHost: "test.api.ft.com",
+	}
+
+	c := Content{
+		bodyXMLField: `<body><ft-content type="http://www.ft.com/ontology/content/ClipSet" url="http://api.ft.com/content/` + clipSetUUID + `" data-embedded="true"></ft-content></body>`,
+	}
+	actual, err := cu.Unroll(context.Background(), UnrollEvent{c, "tid_sample", "sample_uuid"})
+	assert.NoError(t, err)
+
+	assert.Len(t, calls, 2, "Posters of all the clips should be read in a single call")
+	assert.ElementsMatch(t, posterUUIDs, calls[1])
+
+	clipSet := actual[embeds].([]Content)[0]
+	for i, m := range clipSet[membersField].([]Content) {
+		poster := m[posterField].(Content)
+		assert.Equal(t, "http://www.ft.com/thing/"+posterUUIDs[i], poster[id])
+	}
+}
+
+func TestUnrollContent_DuplicateUUIDsAreReadOnce(t *testing.T) {
+	imgUUID := "639cd952-149f-11e7-2ea7-a07ecd9ac73f"
+	embUUID := "d6c3a1d6-9b08-11e7-8cf8-1a0da58f8a2a"
+	readerContent := map[string]Content{
+		imgUUID: {id: "http://www.ft.com/thing/" + imgUUID, typeField: ImageSetType, membersField: []interface{}{}},
+		embUUID: {id: "http://www.ft.com/thing/" + embUUID, typeField: DynamicContentType},
+	}
+
+	var mu sync.Mutex
+	var calls [][]string
+	cu := DefaultUnroller{
+		reader: &ReaderMock{
+			mockGet: func(uuids []string, _ string) (map[string]Content, error) {
+				mu.Lock()
+				calls = append(calls, uuids)
+				mu.Unlock()
+				res := map[string]Content{}
+				for _, u := range uuids {
+					res[u] = readerContent[u]
+				}
+				return res, nil
+			},
+		},
+		log:     logger.NewUPPLogger("test-service", "Error"),
+		apiHost: "test.api.ft.com",
+	}
+
+	embed := `<ft-content type="http://www.ft.com/ontology/content/DynamicContent" url="http://api.ft.com/content/` + embUUID + `" data-embedded="true"></ft-content>`
+	c := Content{
+		mainImageField: map[string]interface{}{id: "http://api.ft.com/content/" + imgUUID},
+		altImagesField: map[string]interface{}{
+			promotionalImage: map[string]interface{}{id: "http://api.ft.com/content/" + imgUUID},
+		},
+		bodyXMLField: "<body>" + embed + "<p>text</p>" + embed + "</body>",
+	}
+	actual, err := cu.Unroll(context.Background(), UnrollEvent{c, "tid_sample", "sample_uuid"})
+	assert.NoError(t, err)
+
+	assert.ElementsMatch(t, [][]string{{imgUUID}, {embUUID}}, calls, "Every UUID should be read once, with the references of every rule read apart")
+
+	expectedImg := Content{id: "http://www.ft.com/thing/" + imgUUID, typeField: ImageSetType, membersField: []Content{}}
+	assert.Equal(t, expectedImg, actual[mainImageField])
+	assert.Equal(t, expectedImg, actual[altImagesField].(map[string]interface{})[promotionalImage])
+	embedAt := func(position int) Embed {
+		return Embed{
+			UUID:       embUUID,
+			Type:       DynamicContentType,
+			Attributes: map[string]string{"type": DynamicContentType, "url": "http://api.ft.com/content/" + embUUID, "data-embedded": "true"},
+			Position:   position,
+			Occurrence: position,
+			Parent:     "body",
+		}
+	}
+	assert.Equal(t, []Content{withEmbed(readerContent[embUUID], embedAt(0)), withEmbed(readerContent[embUUID], embedAt(1))}, actual[embeds],
+		"Every embed should carry the attributes of its own instance")
+}
+
+func TestUnrollContent_ReferencesOfEveryRuleAreReadAtTheSameTime(t *testing.T) {
+	imgUUID := "639cd952-149f-11e7-2ea7-a07ecd9ac73f"
+	embUUID := "d6c3a1d6-9b08-11e7-8cf8-1a0da58f8a2a"
+
+	var inFlight, maxInFlight int32
+	both := make(chan struct{})
+	var once sync.Once
+	cu := DefaultUnroller{
+		reader: &ReaderMock{
+			mockGet: func(uuids []string, _ string) (map[string]Content, error) {
+				if n := atomic.AddInt32(&inFlight, 1); n == 2 {
+					atomic.StoreInt32(&maxInFlight, n)
+					once.Do(func() { close(both) })
+				}
+				defer atomic.AddInt32(&inFlight, -1)
+				// every read waits for the other one, and gives up if they are read one after the other
+				select {
+				case <-both:
+				case <-time.After(time.Second):
+				}
+				return map[string]Content{uuids[0]: {id: "http://www.ft.com/thing/" + uuids[0]}}, nil
+			},
+		},
+		log:     logger.NewUPPLogger("test-service", "Error"),
+		apiHost: "test.api.ft.com",
+	}
+
+	c := Content{
+		mainImageField: map[string]interface{}{id: "http://api.ft.com/content/" + imgUUID},
+		bodyXMLField:   `<body><ft-content type="http://www.ft.com/ontology/content/DynamicContent" url="http://api.ft.com/content/` + embUUID + `" data-embedded="true"></ft-content></body>`,
+	}
+	_, err := cu.Unroll(context.Background(), UnrollEvent{c, "tid_sample", "sample_uuid"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&maxInFlight), "The main image and the embeds should be read at the same time")
+}
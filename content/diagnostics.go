@@ -0,0 +1,130 @@
+package content
+
+import (
+	"time"
+)
+
+// debugHeader enables the diagnostics block in the response of a request.
+const debugHeader = "X-Unroll-Debug"
+
+const (
+	referenceFetched = "fetched"
+	referenceMissing = "missing"
+	referenceFailed  = "failed"
+	referenceCutOff  = "cutoff"
+)
+
+// diagnostics records what was attempted while unrolling a request. It is counted in the metrics of every request,
+// and reported in the response of requests asking for it with the debug header.
+type diagnostics struct {
+	unroller   string
+	references []referenceDiagnostic
+	statuses   map[string]referenceDiagnostic
+	batches    []batchDiagnostic
+}
+
+// referenceDiagnostic describes a reference to related content found in a field of the content or of its parent.
+type referenceDiagnostic struct {
+	Field  string `json:"field"`
+	UUID   string `json:"uuid"`
+	Parent string `json:"parent,omitempty"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// batchDiagnostic describes a single read from the content store.
+type batchDiagnostic struct {
+	UUIDs     []string `json:"uuids"`
+	LatencyMs int64    `json:"latencyMs"`
+	Error     string   `json:"error,omitempty"`
+}
+
+func newDiagnostics() *diagnostics {
+	return &diagnostics{statuses: map[string]referenceDiagnostic{}}
+}
+
+// handledBy records the unroller the content was dispatched to. Only the first one is kept, as unrollers can
+// delegate to each other.
+func (s *unrollState) handledBy(unroller string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.diag != nil && s.diag.unroller == "" {
+		s.diag.unroller = unroller
+	}
+}
+
+// noteReference records a reference found while unrolling. References without a status get the status of the
+// read of their UUID when the diagnostics are reported.
+func (s *unrollState) noteReference(ref referenceDiagnostic) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.diag != nil {
+		s.diag.references = append(s.diag.references, ref)
+	}
+}
+
+// noteStatus records the outcome of reading a UUID.
+func (s *unrollState) noteStatus(uuid string, status string, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.diag != nil {
+		s.diag.statuses[uuid] = referenceDiagnostic{Status: status, Reason: reason}
+	}
+}
+
+// noteBatch records a read from the content store together with how long it took.
+func (s *unrollState) noteBatch(uuids []string, latency time.Duration, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.diag == nil {
+		return
+	}
+	batch := batchDiagnostic{UUIDs: uuids, LatencyMs: latency.Milliseconds()}
+	if err != nil {
+		batch.Error = err.Error()
+	}
+	s.diag.batches = append(s.diag.batches, batch)
+}
+
+// debugging reports whether diagnostics are reported in the response of the request.
+func (s *unrollState) debugging() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.debug && s.diag != nil
+}
+
+// references returns the references found while unrolling, with the status of the read of their UUID.
+func (s *unrollState) references() []referenceDiagnostic {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.diag == nil {
+		return nil
+	}
+	return s.diag.resolvedReferences()
+}
+
+func (d *diagnostics) resolvedReferences() []referenceDiagnostic {
+	references := make([]referenceDiagnostic, 0, len(d.references))
+	for _, ref := range d.references {
+		if ref.Status == "" {
+			ref.Status, ref.Reason = referenceMissing, ""
+			if read, found := d.statuses[ref.UUID]; found {
+				ref.Status, ref.Reason = read.Status, read.Reason
+			}
+		}
+		references = append(references, ref)
+	}
+	return references
+}
+
+func (d *diagnostics) report() map[string]interface{} {
+	batches := d.batches
+	if batches == nil {
+		batches = []batchDiagnostic{}
+	}
+	return map[string]interface{}{
+		"unroller":   d.unroller,
+		"references": d.resolvedReferences(),
+		"batches":    batches,
+	}
+}
@@ -0,0 +1,169 @@
+package content
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/Financial-Times/go-logger/v2"
+)
+
+const problemContentType = "application/problem+json"
+
+// ErrorCode is a stable, machine readable identifier of an error returned by the unroll endpoints.
+type ErrorCode string
+
+const (
+	CodeInvalidJSON         ErrorCode = "invalid_json"
+	CodeRequestTooLarge     ErrorCode = "request_too_large"
+	CodeUnsupportedMedia    ErrorCode = "unsupported_media_type"
+	CodeMissingID           ErrorCode = "missing_id"
+	CodeUnsupportedType     ErrorCode = "unsupported_type"
+	CodeValidationFailed    ErrorCode = "validation_failed"
+	CodeMalformedContent    ErrorCode = "malformed_content"
+	CodeUnsupportedMode     ErrorCode = "unsupported_mode"
+	CodeBrokenReferences    ErrorCode = "broken_references"
+	CodeUpstreamUnavailable ErrorCode = "upstream_unavailable"
+	CodeUpstreamTimeout     ErrorCode = "upstream_timeout"
+	CodeOverloaded          ErrorCode = "overloaded"
+	CodeRateLimited         ErrorCode = "rate_limited"
+	CodeUnauthenticated     ErrorCode = "unauthenticated"
+	CodeForbidden           ErrorCode = "forbidden"
+	CodeInternal            ErrorCode = "internal_error"
+)
+
+type errorCodeInfo struct {
+	status int
+	title  string
+}
+
+var errorCodes = map[ErrorCode]errorCodeInfo{
+	CodeInvalidJSON:         {http.StatusBadRequest, "Request body is not valid JSON"},
+	CodeRequestTooLarge:     {http.StatusRequestEntityTooLarge, "Request body is too large"},
+	CodeUnsupportedMedia:    {http.StatusUnsupportedMediaType, "Request body must be JSON"},
+	CodeMissingID:           {http.StatusBadRequest, "Missing or invalid id field"},
+	CodeUnsupportedType:     {http.StatusBadRequest, "Unsupported content type"},
+	CodeValidationFailed:    {http.StatusBadRequest, "Content failed validation"},
+	CodeMalformedContent:    {http.StatusBadRequest, "Content has an unexpected structure"},
+	CodeUnsupportedMode:     {http.StatusBadRequest, "Unsupported unroll mode"},
+	CodeBrokenReferences:    {http.StatusUnprocessableEntity, "Content has broken references"},
+	CodeUpstreamUnavailable: {http.StatusInternalServerError, "Content store is unavailable"},
+	CodeUpstreamTimeout:     {http.StatusGatewayTimeout, "Content store timed out"},
+	CodeOverloaded:          {http.StatusServiceUnavailable, "Too many requests in flight"},
+	CodeRateLimited:         {http.StatusTooManyRequests, "Client is over its rate limit"},
+	CodeUnauthenticated:     {http.StatusUnauthorized, "Missing or invalid credentials"},
+	CodeForbidden:           {http.StatusForbidden, "Client may not call the endpoint"},
+	CodeInternal:            {http.StatusInternalServerError, "Error expanding content"},
+}
+
+// UnrollError describes a failed unroll request together with the UUID and field it relates to.
+type UnrollError struct {
+	Code  ErrorCode
+	UUID  string
+	Field string
+	Err   error
+
+	// references lists the broken references failing a request in strict mode.
+	references []referenceDiagnostic
+}
+
+func (e *UnrollError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UnrollError) Unwrap() error {
+	return e.Err
+}
+
+// Status returns the HTTP status code the error is reported with.
+func (e *UnrollError) Status() int {
+	if info, found := errorCodes[e.Code]; found {
+		return info.status
+	}
+	return http.StatusInternalServerError
+}
+
+func newUnrollError(code ErrorCode, field string, err error) *UnrollError {
+	return &UnrollError{Code: code, Field: field, Err: err}
+}
+
+// classifyError maps any error returned while serving a request onto the error taxonomy.
+func classifyError(err error, uuid string) *UnrollError {
+	var ue *UnrollError
+	if errors.As(err, &ue) {
+		classified := *ue
+		if classified.UUID == "" {
+			classified.UUID = uuid
+		}
+		return &classified
+	}
+
+	if path, found := malformedPath(err); found {
+		return &UnrollError{Code: CodeMalformedContent, UUID: uuid, Field: path, Err: err}
+	}
+
+	code := CodeInternal
+	switch {
+	case errors.Is(err, ErrUpstreamTimeout):
+		code = CodeUpstreamTimeout
+	case errors.Is(err, ErrConnectingToAPI):
+		code = CodeUpstreamUnavailable
+	case errors.Is(err, ErrValidating):
+		code = CodeValidationFailed
+	case errors.Is(err, ErrConverting):
+		code = CodeMalformedContent
+	}
+	return &UnrollError{Code: code, UUID: uuid, Err: err}
+}
+
+// problem is the application/problem+json (RFC 7807) representation of an UnrollError.
+type problem struct {
+	Type          string    `json:"type"`
+	Title         string    `json:"title"`
+	Status        int       `json:"status"`
+	Detail        string    `json:"detail"`
+	Instance      string    `json:"instance,omitempty"`
+	Code          ErrorCode `json:"code"`
+	TransactionID string    `json:"transactionId"`
+	UUID          string    `json:"uuid,omitempty"`
+	Field         string    `json:"field,omitempty"`
+
+	BrokenReferences []referenceDiagnostic `json:"brokenReferences,omitempty"`
+}
+
+func newProblem(e *UnrollError, tid string, instance string) problem {
+	title := errorCodes[CodeInternal].title
+	if info, found := errorCodes[e.Code]; found {
+		title = info.title
+	}
+	return problem{
+		Type:          "about:blank",
+		Title:         title,
+		Status:        e.Status(),
+		Detail:        e.Error(),
+		Instance:      instance,
+		Code:          e.Code,
+		TransactionID: tid,
+		UUID:          e.UUID,
+		Field:         e.Field,
+
+		BrokenReferences: e.references,
+	}
+}
+
+func writeProblem(w http.ResponseWriter, p problem) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		http.Error(w, p.Detail, p.Status)
+		return
+	}
+	w.Header().Set("Content-Type", problemContentType)
+	w.WriteHeader(p.Status)
+	w.Write(body)
+}
+
+func handleError(r *http.Request, log *logger.UPPLogger, tid string, uuid string, w http.ResponseWriter, err error) {
+	ue := classifyError(err, uuid)
+	transactionFinishedEvent(log, r.RequestURI, tid, ue.Status(), ue.UUID, err.Error())
+	writeProblem(w, newProblem(ue, tid, r.URL.Path))
+}
@@ -0,0 +1,58 @@
+package content
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		expectedCode   ErrorCode
+		expectedStatus int
+	}{
+		{
+			name:           "upstream unavailable",
+			err:            errors.Join(ErrConnectingToAPI, fmt.Errorf("request failed")),
+			expectedCode:   CodeUpstreamUnavailable,
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "upstream timeout",
+			err:            errors.Join(ErrConnectingToAPI, ErrUpstreamTimeout),
+			expectedCode:   CodeUpstreamTimeout,
+			expectedStatus: http.StatusGatewayTimeout,
+		},
+		{
+			name:           "validation failure",
+			err:            ErrValidating,
+			expectedCode:   CodeValidationFailed,
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown error",
+			err:            errors.New("boom"),
+			expectedCode:   CodeInternal,
+			expectedStatus: http.StatusInternalServerError,
+		},
+		{
+			name:           "wrapped unroll error",
+			err:            fmt.Errorf("wrapped: %w", newUnrollError(CodeMissingID, "id", errors.New("missing"))),
+			expectedCode:   CodeMissingID,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ue := classifyError(tt.err, "sample_uuid")
+			assert.Equal(t, tt.expectedCode, ue.Code)
+			assert.Equal(t, tt.expectedStatus, ue.Status())
+			assert.Equal(t, "sample_uuid", ue.UUID)
+		})
+	}
+}
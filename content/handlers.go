@@ -1,28 +1,96 @@
 package content
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
 
 	"github.com/Financial-Times/go-logger/v2"
 	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
 )
 
+const (
+	// partialHeader is set on responses which could not be fully unrolled within the limits of the request.
+	partialHeader = "X-Unroll-Partial"
+	// degradedHeader is set on responses returning the content without unrolling it, as the content store is
+	// unavailable.
+	degradedHeader = "X-Unroll-Degraded"
+)
+
 type Unroller interface {
-	UnrollContent(event UnrollEvent) (Content, error)
-	UnrollInternalContent(event UnrollEvent) (Content, error)
+	UnrollContent(ctx context.Context, event UnrollEvent) (Content, error)
+	UnrollInternalContent(ctx context.Context, event UnrollEvent) (Content, error)
+	PlanContent(event UnrollEvent) (Plan, error)
+	PlanInternalContent(event UnrollEvent) (Plan, error)
 }
 
 type Handler struct {
 	Unroller Unroller
 	log      *logger.UPPLogger
+	limits   atomic.Pointer[Limits]
+
+	degraded *atomic.Bool
+	breaker  *Breaker
+	metrics  Metrics
+	limiters map[View]*Limiter
 }
 
-func NewHandler(u Unroller, l *logger.UPPLogger) *Handler {
-	return &Handler{Unroller: u, log: l}
+// HandlerOption configures optional behaviour of a Handler.
+type HandlerOption func(*Handler)
+
+// WithDegradedMode returns the content without unrolling it, instead of failing, when the content store is
+// unavailable. Requests don't try to unroll while the breaker, if any, is open.
+func WithDegradedMode(b *Breaker) HandlerOption {
+	on := &atomic.Bool{}
+	on.Store(true)
+	return WithDegradedModeSwitch(b, on)
+}
+
+// WithDegradedModeSwitch runs the handler in degraded mode while on is set, so that it can be turned on and off
+// without restarting the service.
+func WithDegradedModeSwitch(b *Breaker, on *atomic.Bool) HandlerOption {
+	return func(hh *Handler) {
+		hh.degraded = on
+		hh.breaker = b
+	}
+}
+
+// WithMetrics counts the related content expanded and the references missing for every request unrolled.
+func WithMetrics(m Metrics) HandlerOption {
+	return func(hh *Handler) {
+		hh.metrics = m
+	}
+}
+
+func NewHandler(u Unroller, l *logger.UPPLogger, limits Limits, opts ...HandlerOption) *Handler {
+	hh := &Handler{Unroller: u, log: l, metrics: noopMetrics{}}
+	hh.SetLimits(limits)
+	for _, opt := range opts {
+		opt(hh)
+	}
+	return hh
+}
+
+// SetLimits replaces the limits of the requests unrolled from now on.
+func (hh *Handler) SetLimits(limits Limits) {
+	hh.limits.Store(&limits)
+}
+
+func (hh *Handler) currentLimits() Limits {
+	if limits := hh.limits.Load(); limits != nil {
+		return *limits
+	}
+	return Limits{}
+}
+
+func (hh *Handler) degradedMode() bool {
+	return hh.degraded != nil && hh.degraded.Load()
 }
 
 type UnrollEvent struct {
@@ -31,107 +99,257 @@ type UnrollEvent struct {
 	uuid string
 }
 
+// View selects which representation of the content is unrolled.
+type View string
+
+const (
+	PublicView   View = "content"
+	InternalView View = "internalcontent"
+)
+
 func (hh *Handler) GetContent(w http.ResponseWriter, r *http.Request) {
+	hh.serveUnroll(w, r, PublicView)
+}
+
+func (hh *Handler) GetInternalContent(w http.ResponseWriter, r *http.Request) {
+	hh.serveUnroll(w, r, InternalView)
+}
+
+func (hh *Handler) GetContentPlan(w http.ResponseWriter, r *http.Request) {
+	hh.servePlan(w, r, PublicView)
+}
+
+func (hh *Handler) GetInternalContentPlan(w http.ResponseWriter, r *http.Request) {
+	hh.servePlan(w, r, InternalView)
+}
+
+// serveUnroll is the request pipeline shared by all unroll endpoints: admit, decode, validate, unroll and encode.
+// Any error on the way is mapped to a problem response by handleError.
+func (hh *Handler) serveUnroll(w http.ResponseWriter, r *http.Request, view View) {
 	tid := transactionidutils.GetTransactionIDFromRequest(r)
+	release, admitted := hh.admit(w, r, view, tid)
+	if !admitted {
+		return
+	}
+	defer release()
+
 	event, err := createUnrollEvent(r, tid)
 	if err != nil {
-		handleError(r, hh.log, tid, "", w, err, http.StatusBadRequest)
+		handleError(r, hh.log, tid, "", w, err)
 		return
 	}
+	setContentTypeLabel(r, event.c)
+	traceEvent(r.Context(), event)
 
-	transactionStartedEvent(hh.log, r.RequestURI, tid, event.uuid)
-
-	res, err := hh.Unroller.UnrollContent(event)
-	if errors.Is(err, ErrConnectingToAPI) {
-		handleError(r, hh.log, tid, event.uuid, w, err, http.StatusInternalServerError)
+	if err = validateUnrollEvent(event); err != nil {
+		handleError(r, hh.log, tid, event.uuid, w, err)
 		return
-	} else if errors.Is(err, ErrValidating) {
-		handleError(r, hh.log, tid, event.uuid, w, err, http.StatusBadRequest)
+	}
+
+	mode, err := parseMode(r.Header.Get(modeHeader))
+	if err != nil {
+		handleError(r, hh.log, tid, event.uuid, w, err)
 		return
-	} else if err != nil {
-		handleError(r, hh.log, tid, event.uuid, w, err, http.StatusInternalServerError)
+	}
+
+	transactionStartedEvent(hh.log, r.RequestURI, tid, event.uuid)
+
+	// the state and the deadline are shared by all the expansions made for the request
+	state := newUnrollState(hh.currentLimits())
+	state.mode = mode
+	state.debug = headerEnabled(r, debugHeader)
+	state.indexEmbeds = headerEnabled(r, embedIndexHeader)
+	state.inlineBody = headerEnabled(r, inlineBodyHeader)
+	ctx, cancel := context.WithTimeout(r.Context(), state.limits.Timeout)
+	defer cancel()
+
+	if hh.degradedMode() && hh.breaker != nil && hh.breaker.Open() {
+		hh.serveDegraded(w, r, view, event, errors.Join(ErrConnectingToAPI, ErrCircuitOpen))
 		return
 	}
 
-	jsonRes, err := json.Marshal(res)
+	res, err := hh.unroll(withUnrollState(ctx, state), view, event)
+	state.countReferences(hh.metrics)
+	if hh.degradedMode() {
+		if cause := upstreamCause(err, state); cause != nil {
+			hh.serveDegraded(w, r, view, event, cause)
+			return
+		}
+	}
 	if err != nil {
-		handleError(r, hh.log, tid, event.uuid, w, err, http.StatusInternalServerError)
+		handleError(r, hh.log, tid, event.uuid, w, err)
 		return
 	}
+	if partial := state.truncated(); partial || state.debugging() || (state.mode == LenientMode && len(state.brokenReferences()) > 0) {
+		res = res.clone()
+		res[unrollField] = state.metadata()
+		if partial {
+			w.Header().Set(partialHeader, "true")
+		}
+	}
 
-	transactionFinishedEvent(hh.log, r.RequestURI, tid, http.StatusOK, event.uuid, "success")
-	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-	w.Write(jsonRes)
+	writeJSON(w, r, hh.log, tid, event.uuid, res, "success")
 }
 
-func (hh *Handler) GetInternalContent(w http.ResponseWriter, r *http.Request) {
+// serveDegraded returns the content as it was sent, with the expansions which were skipped listed in the
+// metadata block.
+func (hh *Handler) serveDegraded(w http.ResponseWriter, r *http.Request, view View, event UnrollEvent, cause error) {
+	hh.log.WithTransactionID(event.tid).WithUUID(event.uuid).WithError(cause).
+		Warn("Returning the content without unrolling it, the content store is unavailable")
+
+	skipped := []PlanGroup{}
+	if plan, err := hh.plan(view, event); err == nil {
+		skipped = plan.References
+	}
+	res := event.c.clone()
+	res[unrollField] = map[string]interface{}{
+		"degraded": true,
+		"reason":   classifyError(cause, event.uuid).Code,
+		"skipped":  skipped,
+	}
+	w.Header().Set(degradedHeader, "true")
+	writeJSON(w, r, hh.log, event.tid, event.uuid, res, "degraded")
+}
+
+// headerEnabled reports whether the request turns on the option of the header, with a value like true or 1.
+func headerEnabled(r *http.Request, name string) bool {
+	enabled, err := strconv.ParseBool(r.Header.Get(name))
+	return err == nil && enabled
+}
+
+// upstreamCause returns the failure of the content store unrolling ran into, whether it failed the request or, in
+// lenient and strict mode, the references it was reading were reported as broken. It returns nil for any other
+// outcome.
+func upstreamCause(err error, state *unrollState) error {
+	if err != nil && isUpstreamFailure(err) {
+		return err
+	}
+	return state.upstreamFailure()
+}
+
+// isUpstreamFailure reports whether err was caused by the content store being unavailable.
+func isUpstreamFailure(err error) bool {
+	code := classifyError(err, "").Code
+	return code == CodeUpstreamUnavailable || code == CodeUpstreamTimeout
+}
+
+// servePlan decodes and validates the request like serveUnroll, then returns what unrolling it would expand
+// without reading anything from the content store.
+func (hh *Handler) servePlan(w http.ResponseWriter, r *http.Request, view View) {
 	tid := transactionidutils.GetTransactionIDFromRequest(r)
 	event, err := createUnrollEvent(r, tid)
 	if err != nil {
-		handleError(r, hh.log, tid, "", w, err, http.StatusBadRequest)
+		handleError(r, hh.log, tid, "", w, err)
+		return
+	}
+	setContentTypeLabel(r, event.c)
+	traceEvent(r.Context(), event)
+
+	if err = validateUnrollEvent(event); err != nil {
+		handleError(r, hh.log, tid, event.uuid, w, err)
+		return
 	}
 
 	transactionStartedEvent(hh.log, r.RequestURI, tid, event.uuid)
 
-	res, err := hh.Unroller.UnrollInternalContent(event)
-	if errors.Is(err, ErrConnectingToAPI) {
-		handleError(r, hh.log, tid, event.uuid, w, err, http.StatusInternalServerError)
-		return
-	} else if errors.Is(err, ErrValidating) {
-		handleError(r, hh.log, tid, event.uuid, w, err, http.StatusBadRequest)
-		return
-	} else if err != nil {
-		handleError(r, hh.log, tid, event.uuid, w, err, http.StatusInternalServerError)
+	plan, err := hh.plan(view, event)
+	if err != nil {
+		handleError(r, hh.log, tid, event.uuid, w, err)
 		return
 	}
 
-	jsonRes, err := json.Marshal(res)
+	writeJSON(w, r, hh.log, tid, event.uuid, plan, "success")
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, log *logger.UPPLogger, tid string, uuid string, v interface{}, message string) {
+	jsonRes, err := json.Marshal(v)
 	if err != nil {
-		handleError(r, hh.log, tid, event.uuid, w, err, http.StatusInternalServerError)
+		handleError(r, log, tid, uuid, w, err)
 		return
 	}
 
-	transactionFinishedEvent(hh.log, r.RequestURI, tid, http.StatusOK, event.uuid, "success")
+	transactionFinishedEvent(log, r.RequestURI, tid, http.StatusOK, uuid, message)
 	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
 	w.Write(jsonRes)
 }
 
+func (hh *Handler) plan(view View, event UnrollEvent) (Plan, error) {
+	switch view {
+	case InternalView:
+		return hh.Unroller.PlanInternalContent(event)
+	default:
+		return hh.Unroller.PlanContent(event)
+	}
+}
+
+func (hh *Handler) unroll(ctx context.Context, view View, event UnrollEvent) (Content, error) {
+	switch view {
+	case InternalView:
+		return hh.Unroller.UnrollInternalContent(ctx, event)
+	default:
+		return hh.Unroller.UnrollContent(ctx, event)
+	}
+}
+
 func createUnrollEvent(r *http.Request, tid string) (UnrollEvent, error) {
 	var unrollEvent UnrollEvent
 	b, err := io.ReadAll(r.Body)
 	if err != nil {
-		return unrollEvent, err
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return unrollEvent, newUnrollError(CodeRequestTooLarge, "", err)
+		}
+		return unrollEvent, newUnrollError(CodeInvalidJSON, "", err)
 	}
 
 	var content Content
 	err = json.Unmarshal(b, &content)
 	if err != nil {
-		return unrollEvent, err
+		return unrollEvent, newUnrollError(CodeInvalidJSON, "", err)
 	}
 
 	//TODO: This may need to be moved to a validation function in the unroller in case `id` is not present in any of the unrollable content
 	id, ok := content[id].(string)
 	if !ok {
-		return unrollEvent, errors.New("Missing or invalid id field")
+		return unrollEvent, newUnrollError(CodeMissingID, "id", errors.New("Missing or invalid id field"))
 	}
 	uuid, err := extractUUIDFromString(id)
 	if err != nil {
-		return unrollEvent, err
+		return unrollEvent, newUnrollError(CodeMissingID, "id", err)
 	}
 	unrollEvent = UnrollEvent{content, tid, uuid}
 
 	return unrollEvent, nil
 }
 
-func handleError(r *http.Request, log *logger.UPPLogger, tid string, uuid string, w http.ResponseWriter, err error, statusCode int) {
-	var errMsg string
-	if statusCode >= 400 && statusCode < 500 {
-		errMsg = fmt.Sprintf("Error expanding content, supplied UUID is invalid: %s", err.Error())
-		transactionFinishedEvent(log, r.RequestURI, tid, statusCode, uuid, err.Error())
-	} else if statusCode >= 500 {
-		errMsg = fmt.Sprintf("Error expanding content for: %v: %v", uuid, err.Error())
-		transactionFinishedEvent(log, r.RequestURI, tid, statusCode, uuid, err.Error())
+func validateUnrollEvent(event UnrollEvent) error {
+	if err := validateContentType(event.c); err != nil {
+		err.UUID = event.uuid
+		return err
+	}
+	return nil
+}
+
+// validateContentType rejects content whose type or types fields are present but are not FT ontology types.
+func validateContentType(content Content) *UnrollError {
+	if rawTypes, found := content[typesField]; found {
+		types, ok := rawTypes.([]interface{})
+		if !ok {
+			return newUnrollError(CodeUnsupportedType, typesField, fmt.Errorf("%s field must be an array of types", typesField))
+		}
+		for i, t := range types {
+			if !isOntologyType(t) {
+				return newUnrollError(CodeUnsupportedType, fmt.Sprintf("%s[%d]", typesField, i), fmt.Errorf("unsupported content type %v", t))
+			}
+		}
+	}
+	if rawType, found := content[typeField]; found && !isOntologyType(rawType) {
+		return newUnrollError(CodeUnsupportedType, typeField, fmt.Errorf("unsupported content type %v", rawType))
 	}
-	w.WriteHeader(statusCode)
-	w.Write([]byte(errMsg))
+	return nil
+}
+
+func isOntologyType(t interface{}) bool {
+	s, ok := t.(string)
+	return ok && strings.HasPrefix(s, ontologyTypePrefix)
 }
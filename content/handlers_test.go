@@ -2,13 +2,17 @@ package content
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"slices"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"errors"
 
@@ -23,16 +27,25 @@ const (
 
 type ContentUnrollerMock struct {
 	mockUnrollContent func(UnrollEvent) (Content, error)
+	mockPlanContent   func(UnrollEvent) (Plan, error)
 }
 
-func (cu *ContentUnrollerMock) UnrollContent(event UnrollEvent) (Content, error) {
+func (cu *ContentUnrollerMock) UnrollContent(_ context.Context, event UnrollEvent) (Content, error) {
 	return cu.mockUnrollContent(event)
 }
 
-func (cu *ContentUnrollerMock) UnrollInternalContent(event UnrollEvent) (Content, error) {
+func (cu *ContentUnrollerMock) UnrollInternalContent(_ context.Context, event UnrollEvent) (Content, error) {
 	return cu.mockUnrollContent(event)
 }
 
+func (cu *ContentUnrollerMock) PlanContent(event UnrollEvent) (Plan, error) {
+	return cu.mockPlanContent(event)
+}
+
+func (cu *ContentUnrollerMock) PlanInternalContent(event UnrollEvent) (Plan, error) {
+	return cu.mockPlanContent(event)
+}
+
 func TestGetContentReturns200(t *testing.T) {
 	cu := ContentUnrollerMock{
 		mockUnrollContent: func(_ UnrollEvent) (Content, error) {
@@ -242,3 +255,621 @@ func TestGetInternalContent_UnrollingError(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 	assert.Contains(t, rr.Body.String(), "error while unrolling content")
 }
+
+func TestGetContent_ErrorResponseIsProblemJSON(t *testing.T) {
+	tests := []struct {
+		name         string
+		body         string
+		expectedCode ErrorCode
+		expectedUUID string
+		expectedFld  string
+	}{
+		{
+			name:         "invalid json",
+			body:         "sample body",
+			expectedCode: CodeInvalidJSON,
+		},
+		{
+			name:         "missing id",
+			body:         invalidBodyMissingID,
+			expectedCode: CodeMissingID,
+			expectedFld:  "id",
+		},
+		{
+			name:         "unsupported type",
+			body:         `{"id": "d02886fc-58ff-11e8-9859-6668838a4c10", "type": "Article"}`,
+			expectedCode: CodeUnsupportedType,
+			expectedUUID: "d02886fc-58ff-11e8-9859-6668838a4c10",
+			expectedFld:  "type",
+		},
+		{
+			name:         "unsupported type in types array",
+			body:         `{"id": "d02886fc-58ff-11e8-9859-6668838a4c10", "types": ["http://www.ft.com/ontology/content/Article", 5]}`,
+			expectedCode: CodeUnsupportedType,
+			expectedUUID: "d02886fc-58ff-11e8-9859-6668838a4c10",
+			expectedFld:  "types[1]",
+		},
+		{
+			name:         "validation failure",
+			body:         InvalidBodyRequest,
+			expectedCode: CodeValidationFailed,
+			expectedUUID: "d02886fc-58ff-11e8-9859-6668838a4c10",
+		},
+	}
+
+	h := Handler{
+		Unroller: &UniversalUnroller{},
+		log:      logger.NewUPPLogger("test-service", "Error"),
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodPost, "/content", strings.NewReader(tt.body))
+			assert.NoError(t, err, "Cannot create request necessary for test")
+			req.Header.Set("X-Request-Id", "tid_test")
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.GetContent).ServeHTTP(rr, req)
+
+			assert.Equal(t, http.StatusBadRequest, rr.Code)
+			assert.Equal(t, problemContentType, rr.Header().Get("Content-Type"))
+
+			var p problem
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+			assert.Equal(t, tt.expectedCode, p.Code)
+			assert.Equal(t, http.StatusBadRequest, p.Status)
+			assert.Equal(t, "tid_test", p.TransactionID)
+			assert.Equal(t, tt.expectedUUID, p.UUID)
+			assert.Equal(t, tt.expectedFld, p.Field)
+		})
+	}
+}
+
+func TestGetContent_MalformedContentReturns400WithPath(t *testing.T) {
+	h := Handler{
+		Unroller: &UniversalUnroller{log: logger.NewUPPLogger("test-service", "Error")},
+		log:      logger.NewUPPLogger("test-service", "Error"),
+	}
+	body := `{"id": "d02886fc-58ff-11e8-9859-6668838a4c10", "mainImage": {"id": 5}}`
+	req, err := http.NewRequest(http.MethodPost, "/content", strings.NewReader(body))
+	assert.NoError(t, err, "Cannot create request necessary for test")
+
+	rr := httptest.NewRecorder()
+	assert.NotPanics(t, func() { http.HandlerFunc(h.GetContent).ServeHTTP(rr, req) })
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	var p problem
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+	assert.Equal(t, CodeMalformedContent, p.Code)
+	assert.Equal(t, "mainImage.id", p.Field)
+}
+
+// handlersTestEmbed returns the attributes of the first dynamic content embedded in a body, as found in a response.
+func handlersTestEmbed(uuid string) map[string]interface{} {
+	return map[string]interface{}{
+		"position":   float64(0),
+		"occurrence": float64(0),
+		"parent":     "body",
+		"path":       "",
+		"attributes": map[string]interface{}{
+			"type":          DynamicContentType,
+			"url":           "http://api.ft.com/content/" + uuid,
+			"data-embedded": "true",
+		},
+	}
+}
+
+// slowReader doesn't answer until the request runs out of time.
+type slowReader struct{}
+
+func (slowReader) Get(ctx context.Context, _ []string, _ string) (map[string]Content, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (slowReader) GetInternal(ctx context.Context, _ []string, _ string) (map[string]Content, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestGetContent_PartialResponseWhenOutOfTime(t *testing.T) {
+	dynamicUUID := "d6c3a1d6-9b08-11e7-8cf8-1a0da58f8a2a"
+	h := NewHandler(
+		NewUniversalUnroller(slowReader{}, logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com"),
+		logger.NewUPPLogger("test-service", "Error"),
+		Limits{Timeout: 20 * time.Millisecond},
+	)
+
+	body, err := json.Marshal(Content{
+		id:           "http://www.ft.com/thing/22c0d426-1466-11e7-b0c1-37e417ee6c76",
+		typeField:    ArticleType,
+		bodyXMLField: `<body><ft-content type="http://www.ft.com/ontology/content/DynamicContent" url="http://api.ft.com/content/` + dynamicUUID + `" data-embedded="true"></ft-content></body>`,
+	})
+	assert.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, "/content", bytes.NewReader(body))
+	assert.NoError(t, err, "Cannot create request necessary for test")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.GetContent).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "true", rr.Header().Get(partialHeader))
+
+	var actual map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &actual))
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{id: "http://test.api.ft.com/content/" + dynamicUUID, cutoffField: cutoffDeadline, embedField: handlersTestEmbed(dynamicUUID)},
+	}, actual[embeds])
+	assert.Equal(t, map[string]interface{}{
+		"partial": true,
+		"cutoffs": map[string]interface{}{cutoffDeadline: float64(1)},
+	}, actual[unrollField])
+}
+
+func TestGetContent_CompleteResponseIsNotMarkedPartial(t *testing.T) {
+	cu := ContentUnrollerMock{
+		mockUnrollContent: func(event UnrollEvent) (Content, error) {
+			return event.c, nil
+		},
+	}
+	h := NewHandler(&cu, logger.NewUPPLogger("test-service", "Error"), Limits{})
+
+	body, err := os.ReadFile("testdata/content-valid-request.json")
+	assert.NoError(t, err, "Cannot read test file")
+	req, err := http.NewRequest(http.MethodPost, "/content", bytes.NewReader(body))
+	assert.NoError(t, err, "Cannot create request necessary for test")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.GetContent).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get(partialHeader))
+	assert.NotContains(t, rr.Body.String(), unrollField)
+}
+
+func TestGetContent_DiagnosticsWhenDebugging(t *testing.T) {
+	imageUUID := "4723cb4e-027c-11e7-ace0-1ce02ef0def9"
+	dynamicUUID := "d6c3a1d6-9b08-11e7-8cf8-1a0da58f8a2a"
+	reader := &ReaderMock{
+		mockGet: func(_ []string, _ string) (map[string]Content, error) {
+			return map[string]Content{
+				imageUUID: {id: "http://www.ft.com/thing/" + imageUUID, typeField: ImageSetType},
+			}, nil
+		},
+	}
+	h := NewHandler(
+		NewUniversalUnroller(reader, logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com"),
+		logger.NewUPPLogger("test-service", "Error"),
+		Limits{},
+	)
+
+	body, err := json.Marshal(Content{
+		id:             "http://www.ft.com/thing/22c0d426-1466-11e7-b0c1-37e417ee6c76",
+		typeField:      ArticleType,
+		mainImageField: map[string]interface{}{id: "http://test.api.ft.com/content/" + imageUUID},
+		bodyXMLField:   `<body><ft-content type="http://www.ft.com/ontology/content/DynamicContent" url="http://api.ft.com/content/` + dynamicUUID + `" data-embedded="true"></ft-content></body>`,
+	})
+	assert.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, "/content", bytes.NewReader(body))
+	assert.NoError(t, err, "Cannot create request necessary for test")
+	req.Header.Set(debugHeader, "true")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.GetContent).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get(partialHeader))
+
+	var actual map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &actual))
+	meta, ok := actual[unrollField].(map[string]interface{})
+	assert.True(t, ok, "Expected the diagnostics block in the response")
+	assert.Equal(t, false, meta["partial"])
+	assert.Equal(t, "default", meta["unroller"])
+	assert.ElementsMatch(t, []interface{}{
+		map[string]interface{}{"field": mainImageField, "uuid": imageUUID, "status": referenceFetched},
+		map[string]interface{}{"field": "embeds[0]", "uuid": dynamicUUID, "status": referenceMissing},
+	}, meta["references"])
+	batches, ok := meta["batches"].([]interface{})
+	assert.True(t, ok)
+	assert.Len(t, batches, 2, "The references of every rule should be read in their own batch")
+	var uuids []interface{}
+	for _, b := range batches {
+		batch := b.(map[string]interface{})
+		uuids = append(uuids, batch["uuids"].([]interface{})...)
+		assert.Contains(t, batch, "latencyMs")
+	}
+	assert.ElementsMatch(t, []interface{}{imageUUID, dynamicUUID}, uuids)
+}
+
+func TestHeaderEnabled(t *testing.T) {
+	tests := map[string]bool{"true": true, "1": true, "TRUE": true, "": false, "false": false, "yes please": false}
+	for value, want := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/content", nil)
+		if value != "" {
+			r.Header.Set(debugHeader, value)
+		}
+		assert.Equal(t, want, headerEnabled(r, debugHeader), "value %q", value)
+	}
+}
+
+func TestGetContentPlan(t *testing.T) {
+	cu := ContentUnrollerMock{
+		mockPlanContent: func(event UnrollEvent) (Plan, error) {
+			p := newPlan("default")
+			p.add(mainImageField, ImageSetType, "639cd952-149f-11e7-2ea7-a07ecd9ac73f")
+			p.read([]string{"639cd952-149f-11e7-2ea7-a07ecd9ac73f"})
+			return p, nil
+		},
+	}
+	h := NewHandler(&cu, logger.NewUPPLogger("test-service", "Error"), Limits{})
+
+	body, err := os.ReadFile("testdata/content-valid-request.json")
+	assert.NoError(t, err, "Cannot read test file")
+	req, err := http.NewRequest(http.MethodPost, "/content/plan", bytes.NewReader(body))
+	assert.NoError(t, err, "Cannot create request necessary for test")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.GetContentPlan).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{
+		"unroller": "default",
+		"references": [{"field": "mainImage", "type": "http://www.ft.com/ontology/content/ImageSet", "uuids": ["639cd952-149f-11e7-2ea7-a07ecd9ac73f"]}],
+		"reads": [["639cd952-149f-11e7-2ea7-a07ecd9ac73f"]]
+	}`, rr.Body.String())
+}
+
+func TestGetInternalContentPlan_ValidationError(t *testing.T) {
+	cu := ContentUnrollerMock{
+		mockPlanContent: func(_ UnrollEvent) (Plan, error) {
+			return Plan{}, ErrValidating
+		},
+	}
+	h := NewHandler(&cu, logger.NewUPPLogger("test-service", "Error"), Limits{})
+
+	req, err := http.NewRequest(http.MethodPost, "/internalcontent/plan", strings.NewReader(InvalidBodyRequest))
+	assert.NoError(t, err, "Cannot create request necessary for test")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.GetInternalContentPlan).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), string(CodeValidationFailed))
+}
+
+func TestGetContent_Modes(t *testing.T) {
+	dynamicUUID := "d6c3a1d6-9b08-11e7-8cf8-1a0da58f8a2a"
+	body, err := json.Marshal(Content{
+		id:           "http://www.ft.com/thing/22c0d426-1466-11e7-b0c1-37e417ee6c76",
+		typeField:    ArticleType,
+		bodyXMLField: `<body><ft-content type="http://www.ft.com/ontology/content/DynamicContent" url="http://api.ft.com/content/` + dynamicUUID + `" data-embedded="true"></ft-content></body>`,
+	})
+	assert.NoError(t, err)
+	missingRef := map[string]interface{}{"field": "embeds[0]", "uuid": dynamicUUID, "status": referenceMissing}
+
+	tests := []struct {
+		name       string
+		mode       string
+		wantStatus int
+		assertBody func(t *testing.T, body map[string]interface{})
+	}{
+		{
+			name:       "default",
+			wantStatus: http.StatusOK,
+			assertBody: func(t *testing.T, body map[string]interface{}) {
+				assert.Equal(t, []interface{}{map[string]interface{}{id: "http://test.api.ft.com/content/" + dynamicUUID, embedField: handlersTestEmbed(dynamicUUID)}}, body[embeds])
+				assert.NotContains(t, body, unrollField, "Broken references should only be reported when asked for")
+			},
+		},
+		{
+			name:       "lenient",
+			mode:       "lenient",
+			wantStatus: http.StatusOK,
+			assertBody: func(t *testing.T, body map[string]interface{}) {
+				assert.Equal(t, []interface{}{map[string]interface{}{id: "http://test.api.ft.com/content/" + dynamicUUID, embedField: handlersTestEmbed(dynamicUUID)}}, body[embeds])
+				assert.Equal(t, map[string]interface{}{
+					"partial":  false,
+					"cutoffs":  map[string]interface{}{},
+					"warnings": []interface{}{missingRef},
+				}, body[unrollField])
+			},
+		},
+		{
+			name:       "strict",
+			mode:       "strict",
+			wantStatus: http.StatusUnprocessableEntity,
+			assertBody: func(t *testing.T, body map[string]interface{}) {
+				assert.Equal(t, string(CodeBrokenReferences), body["code"])
+				assert.Equal(t, []interface{}{missingRef}, body["brokenReferences"])
+			},
+		},
+		{
+			name:       "unsupported",
+			mode:       "sloppy",
+			wantStatus: http.StatusBadRequest,
+			assertBody: func(t *testing.T, body map[string]interface{}) {
+				assert.Equal(t, string(CodeUnsupportedMode), body["code"])
+				assert.Equal(t, modeHeader, body["field"])
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reader := &ReaderMock{
+				mockGet: func(_ []string, _ string) (map[string]Content, error) {
+					return map[string]Content{}, nil
+				},
+			}
+			h := NewHandler(
+				NewUniversalUnroller(reader, logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com"),
+				logger.NewUPPLogger("test-service", "Error"),
+				Limits{},
+			)
+			req, err := http.NewRequest(http.MethodPost, "/content", bytes.NewReader(body))
+			assert.NoError(t, err, "Cannot create request necessary for test")
+			if test.mode != "" {
+				req.Header.Set(modeHeader, test.mode)
+			}
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.GetContent).ServeHTTP(rr, req)
+
+			assert.Equal(t, test.wantStatus, rr.Code)
+			var actual map[string]interface{}
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &actual))
+			test.assertBody(t, actual)
+		})
+	}
+}
+
+func TestGetContent_IndexesEmbedsWhenAskedFor(t *testing.T) {
+	dynamicUUID := "d6c3a1d6-9b08-11e7-8cf8-1a0da58f8a2a"
+	tag := `<ft-content type="http://www.ft.com/ontology/content/DynamicContent" url="http://api.ft.com/content/` + dynamicUUID + `" data-embedded="true"`
+	body, err := json.Marshal(Content{
+		id:           "http://www.ft.com/thing/22c0d426-1466-11e7-b0c1-37e417ee6c76",
+		typeField:    ArticleType,
+		bodyXMLField: "<body>" + tag + "></ft-content><p>" + tag + "></ft-content></p></body>",
+	})
+	assert.NoError(t, err)
+	reader := &ReaderMock{
+		mockGet: func(_ []string, _ string) (map[string]Content, error) {
+			return map[string]Content{dynamicUUID: {id: "http://www.ft.com/thing/" + dynamicUUID}}, nil
+		},
+	}
+	h := NewHandler(
+		NewUniversalUnroller(reader, logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com"),
+		logger.NewUPPLogger("test-service", "Error"),
+		Limits{},
+	)
+
+	for header, expectedBody := range map[string]string{
+		"":     "<body>" + tag + "></ft-content><p>" + tag + "></ft-content></p></body>",
+		"true": "<body>" + tag + ` data-embed-index="0"></ft-content><p>` + tag + ` data-embed-index="1"></ft-content></p></body>`,
+	} {
+		req, err := http.NewRequest(http.MethodPost, "/content", bytes.NewReader(body))
+		assert.NoError(t, err, "Cannot create request necessary for test")
+		req.Header.Set(embedIndexHeader, header)
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.GetContent).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var actual map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &actual))
+		assert.Equal(t, expectedBody, actual[bodyXMLField])
+		var positions []interface{}
+		for _, e := range actual[embeds].([]interface{}) {
+			embed := e.(map[string]interface{})[embedField].(map[string]interface{})
+			positions = append(positions, []interface{}{embed["position"], embed["occurrence"], embed["path"]})
+		}
+		assert.Equal(t, []interface{}{
+			[]interface{}{float64(0), float64(0), ""},
+			[]interface{}{float64(1), float64(1), "p"},
+		}, positions)
+	}
+}
+
+func TestGetContent_DegradedMode(t *testing.T) {
+	imageUUID := "639cd952-149f-11e7-2ea7-a07ecd9ac73f"
+	article := Content{
+		id:             "http://www.ft.com/thing/22c0d426-1466-11e7-b0c1-37e417ee6c76",
+		typeField:      ArticleType,
+		mainImageField: map[string]interface{}{id: "http://api.ft.com/content/" + imageUUID},
+	}
+	body, err := json.Marshal(article)
+	assert.NoError(t, err)
+	expected := map[string]interface{}{
+		id:             article[id],
+		typeField:      article[typeField],
+		mainImageField: article[mainImageField],
+		unrollField: map[string]interface{}{
+			"degraded": true,
+			"reason":   string(CodeUpstreamUnavailable),
+			"skipped":  []interface{}{map[string]interface{}{"field": mainImageField, "uuids": []interface{}{imageUUID}}},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		breaker    *Breaker
+		opts       func(b *Breaker) []HandlerOption
+		mode       string
+		wantStatus int
+		wantCalls  int
+	}{
+		{
+			name:       "breaker open",
+			breaker:    NewBreaker(1, time.Minute),
+			opts:       func(b *Breaker) []HandlerOption { return []HandlerOption{WithDegradedMode(b)} },
+			wantStatus: http.StatusOK,
+			wantCalls:  0,
+		},
+		{
+			name:       "upstream failure",
+			opts:       func(_ *Breaker) []HandlerOption { return []HandlerOption{WithDegradedMode(nil)} },
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+		},
+		{
+			name:       "upstream failure in lenient mode",
+			opts:       func(_ *Breaker) []HandlerOption { return []HandlerOption{WithDegradedMode(nil)} },
+			mode:       "lenient",
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+		},
+		{
+			name:       "upstream failure in strict mode",
+			opts:       func(_ *Breaker) []HandlerOption { return []HandlerOption{WithDegradedMode(nil)} },
+			mode:       "strict",
+			wantStatus: http.StatusOK,
+			wantCalls:  1,
+		},
+		{
+			name:       "switched off",
+			opts:       func(_ *Breaker) []HandlerOption { return []HandlerOption{WithDegradedModeSwitch(nil, &atomic.Bool{})} },
+			wantStatus: http.StatusInternalServerError,
+			wantCalls:  1,
+		},
+		{
+			name:       "disabled",
+			opts:       func(_ *Breaker) []HandlerOption { return nil },
+			wantStatus: http.StatusInternalServerError,
+			wantCalls:  1,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			reader := &ReaderMock{
+				mockGet: func(_ []string, _ string) (map[string]Content, error) {
+					calls++
+					return nil, ErrConnectingToAPI
+				},
+			}
+			if test.breaker != nil {
+				test.breaker.record(context.Background(), ErrConnectingToAPI)
+			}
+			h := NewHandler(
+				NewUniversalUnroller(reader, logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com"),
+				logger.NewUPPLogger("test-service", "Error"),
+				Limits{},
+				test.opts(test.breaker)...,
+			)
+			req, err := http.NewRequest(http.MethodPost, "/content", bytes.NewReader(body))
+			assert.NoError(t, err, "Cannot create request necessary for test")
+			req.Header.Set(modeHeader, test.mode)
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(h.GetContent).ServeHTTP(rr, req)
+
+			assert.Equal(t, test.wantStatus, rr.Code)
+			assert.Equal(t, test.wantCalls, calls)
+			if test.wantStatus != http.StatusOK {
+				assert.Empty(t, rr.Header().Get(degradedHeader))
+				return
+			}
+			assert.Equal(t, "true", rr.Header().Get(degradedHeader))
+			var actual map[string]interface{}
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &actual))
+			assert.Equal(t, expected, actual)
+		})
+	}
+}
+
+func TestGetContent_InlinesEmbedsWhenAskedFor(t *testing.T) {
+	imageSetUUID := "639cd952-149f-11e7-2ea7-a07ecd9ac73f"
+	imageUUID := "71231d3a-13c7-11e7-2ea7-a07ecd9ac73f"
+	tag := `<ft-content type="http://www.ft.com/ontology/content/ImageSet" url="http://api.ft.com/content/` + imageSetUUID + `" data-embedded="true"`
+	body, err := json.Marshal(Content{
+		id:           "http://www.ft.com/thing/22c0d426-1466-11e7-b0c1-37e417ee6c76",
+		typeField:    ArticleType,
+		bodyXMLField: "<body>" + tag + "></ft-content><p>Text</p></body>",
+	})
+	assert.NoError(t, err)
+	reader := &ReaderMock{
+		mockGet: func(_ []string, _ string) (map[string]Content, error) {
+			return map[string]Content{
+				imageSetUUID: {
+					id:           "http://www.ft.com/thing/" + imageSetUUID,
+					typeField:    ImageSetType,
+					membersField: []interface{}{map[string]interface{}{id: "http://www.ft.com/thing/" + imageUUID}},
+				},
+				imageUUID: {
+					id:               "http://www.ft.com/thing/" + imageUUID,
+					typeField:        "http://www.ft.com/ontology/content/MediaResource",
+					binaryURLField:   "https://ft.com/image.jpg",
+					pixelWidthField:  float64(640),
+					pixelHeightField: float64(360),
+					"description":    "An image",
+				},
+			}, nil
+		},
+	}
+	h := NewHandler(
+		NewUniversalUnroller(reader, logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com"),
+		logger.NewUPPLogger("test-service", "Error"),
+		Limits{},
+	)
+
+	for header, expectedBody := range map[string]string{
+		"": "<body>" + tag + "></ft-content><p>Text</p></body>",
+		"true": "<body>" + tag + ` data-binary-url="https://ft.com/image.jpg" data-pixel-width="640" data-pixel-height="360"` +
+			` data-alt-text="An image"></ft-content><p>Text</p></body>`,
+	} {
+		req, err := http.NewRequest(http.MethodPost, "/content", bytes.NewReader(body))
+		assert.NoError(t, err, "Cannot create request necessary for test")
+		req.Header.Set(inlineBodyHeader, header)
+
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(h.GetContent).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var actual map[string]interface{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &actual))
+		assert.Equal(t, expectedBody, actual[bodyXMLField])
+		assert.Len(t, actual[embeds], 1, "The embeds should still be returned")
+	}
+}
+
+func TestGetContent_PostersWhichFailToBeReadAreLeftUnexpanded(t *testing.T) {
+	clipSetUUID := "f6074f3c-b331-4a89-963c-f72eaf3895ae"
+	clipUUID := "c96a594e-2466-422e-9aed-200abdc4de1c"
+	posterUUID := "99d3c5f9-eeee-461f-a0d8-13f671fa17a0"
+	body, err := json.Marshal(Content{
+		id:           "http://www.ft.com/thing/22c0d426-1466-11e7-b0c1-37e417ee6c76",
+		typeField:    ArticleType,
+		bodyXMLField: `<body><ft-content type="http://www.ft.com/ontology/content/ClipSet" url="http://api.ft.com/content/` + clipSetUUID + `" data-embedded="true"></ft-content></body>`,
+	})
+	assert.NoError(t, err)
+	reader := &ReaderMock{
+		mockGet: func(uuids []string, _ string) (map[string]Content, error) {
+			if slices.Contains(uuids, posterUUID) {
+				return nil, ErrConnectingToAPI
+			}
+			return map[string]Content{
+				clipSetUUID: {id: "http://www.ft.com/thing/" + clipSetUUID, typeField: ClipSetType, membersField: []interface{}{map[string]interface{}{id: "http://www.ft.com/thing/" + clipUUID}}},
+				clipUUID:    {id: "http://www.ft.com/thing/" + clipUUID, typeField: ClipType, posterField: map[string]interface{}{apiURLField: "https://api.ft.com/content/" + posterUUID}},
+			}, nil
+		},
+	}
+	h := NewHandler(
+		NewUniversalUnroller(reader, logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com"),
+		logger.NewUPPLogger("test-service", "Error"),
+		Limits{},
+	)
+	req, err := http.NewRequest(http.MethodPost, "/content", bytes.NewReader(body))
+	assert.NoError(t, err, "Cannot create request necessary for test")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.GetContent).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "A poster which can't be read should not fail the request")
+	var actual map[string]interface{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &actual))
+	assert.NotContains(t, actual, unrollField)
+	clipSet := actual[embeds].([]interface{})[0].(map[string]interface{})
+	clip := clipSet[membersField].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{apiURLField: "https://api.ft.com/content/" + posterUUID}, clip[posterField])
+}
@@ -3,6 +3,7 @@ package content
 import (
 	"fmt"
 	"net/http"
+	"sync/atomic"
 
 	fthealth "github.com/Financial-Times/go-fthealth/v1_1"
 	"github.com/Financial-Times/service-status-go/gtg"
@@ -12,9 +13,23 @@ type ServiceConfig struct {
 	ContentStoreAppName      string
 	ContentStoreAppHealthURI string
 	HTTPClient               *http.Client
+	// Breaker guards the reads from the content store, if set.
+	Breaker *Breaker
+	// DegradedMode is set when content is returned without being unrolled while the content store is unavailable.
+	DegradedMode *atomic.Bool
+	// Draining is set once the service is shutting down, while the requests in flight complete.
+	Draining *atomic.Bool
 }
 
+// GtgCheck fails while the service is shutting down, so that it stops getting new requests, and while the content
+// store is unavailable, unless the service runs in degraded mode and can still answer requests without it.
 func (sc *ServiceConfig) GtgCheck() gtg.Status {
+	if sc.Draining != nil && sc.Draining.Load() {
+		return gtg.Status{GoodToGo: false, Message: "Service is shutting down"}
+	}
+	if sc.degradedMode() {
+		return gtg.Status{GoodToGo: true}
+	}
 	contentStoreCheck := func() gtg.Status {
 		msg, err := sc.checkServiceAvailability(sc.ContentStoreAppName, sc.ContentStoreAppHealthURI)
 		if err != nil {
@@ -41,6 +56,42 @@ func (sc *ServiceConfig) ContentStoreCheck() fthealth.Check {
 	}
 }
 
+// Checks returns the health checks of the service. The checks describe the current settings of the service, like
+// whether it runs in degraded mode, which can change while it runs, so they are meant to be built for every run.
+func (sc *ServiceConfig) Checks() []fthealth.Check {
+	checks := []fthealth.Check{sc.ContentStoreCheck()}
+	if sc.Breaker != nil {
+		checks = append(checks, sc.BreakerCheck())
+	}
+	return checks
+}
+
+func (sc *ServiceConfig) degradedMode() bool {
+	return sc.DegradedMode != nil && sc.DegradedMode.Load()
+}
+
+// BreakerCheck fails while the breaker stops the reads from the content store.
+func (sc *ServiceConfig) BreakerCheck() fthealth.Check {
+	impact := "Unroll requests fail without trying to read from the content store"
+	if sc.degradedMode() {
+		impact = "Content is returned without unrolled images and dynamic content"
+	}
+	return fthealth.Check{
+		ID:               fmt.Sprintf("check-breaker-%s", sc.ContentStoreAppName),
+		Name:             fmt.Sprintf("Check circuit breaker to %s", sc.ContentStoreAppName),
+		Severity:         2,
+		BusinessImpact:   impact,
+		TechnicalSummary: fmt.Sprintf("Reads from %v failed repeatedly, the circuit breaker stopped reading from it until it recovers.", sc.ContentStoreAppName),
+		PanicGuide:       "https://dewey.in.ft.com/runbooks/contentreadapi",
+		Checker: func() (string, error) {
+			if sc.Breaker.Open() {
+				return "Error", fmt.Errorf("circuit breaker to %s is %s", sc.ContentStoreAppName, sc.Breaker.State())
+			}
+			return "Ok", nil
+		},
+	}
+}
+
 func (sc *ServiceConfig) checkServiceAvailability(serviceName string, healthURI string) (string, error) {
 	req, err := http.NewRequest(http.MethodGet, healthURI, nil)
 	resp, err := sc.HTTPClient.Do(req)
@@ -1,9 +1,12 @@
 package content
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -74,3 +77,54 @@ func TestServiceConfig_GtgCheck_NotGtg(t *testing.T) {
 	status := sc.GtgCheck()
 	assert.Equal(t, false, status.GoodToGo)
 }
+
+func TestServiceConfig_BreakerCheck(t *testing.T) {
+	sc := initTestServiceConfig("http://sampleHost:8080")
+	sc.Breaker = NewBreaker(1, time.Minute)
+
+	out, err := sc.BreakerCheck().Checker()
+	assert.NoError(t, err)
+	assert.Equal(t, "Ok", out)
+
+	sc.Breaker.record(context.Background(), ErrConnectingToAPI)
+	_, err = sc.BreakerCheck().Checker()
+	assert.EqualError(t, err, "circuit breaker to content-source-app is open")
+}
+
+func TestServiceConfig_Checks_FollowDegradedMode(t *testing.T) {
+	sc := initTestServiceConfig("http://sampleHost:8080")
+	sc.Breaker = NewBreaker(1, time.Minute)
+	sc.DegradedMode = &atomic.Bool{}
+
+	checks := sc.Checks()
+	assert.Len(t, checks, 2)
+	assert.Equal(t, "Unroll requests fail without trying to read from the content store", checks[1].BusinessImpact)
+
+	sc.DegradedMode.Store(true)
+	checks = sc.Checks()
+	assert.Equal(t, "Content is returned without unrolled images and dynamic content", checks[1].BusinessImpact)
+}
+
+func TestServiceConfig_GtgCheck_DegradedMode(t *testing.T) {
+	contentStoreTestService := startNotFunctionalService()
+	defer contentStoreTestService.Close()
+	sc := initTestServiceConfig(contentStoreTestService.URL)
+	sc.DegradedMode = &atomic.Bool{}
+	sc.DegradedMode.Store(true)
+
+	assert.True(t, sc.GtgCheck().GoodToGo, "Degraded mode should answer requests without the content store")
+}
+
+func TestServiceConfig_GtgCheck_Draining(t *testing.T) {
+	contentStoreTestService := startFunctionalService()
+	defer contentStoreTestService.Close()
+	sc := initTestServiceConfig(contentStoreTestService.URL)
+	sc.Draining = &atomic.Bool{}
+
+	assert.True(t, sc.GtgCheck().GoodToGo)
+
+	sc.Draining.Store(true)
+	status := sc.GtgCheck()
+	assert.False(t, status.GoodToGo, "The service should not be good to go while shutting down")
+	assert.Equal(t, "Service is shutting down", status.Message)
+}
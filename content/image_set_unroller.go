@@ -1,44 +1,81 @@
 package content
 
-func (u *UniversalUnroller) unrollImageSet(event UnrollEvent) (Content, error) {
-	if !validateImageSet(event.c) {
-		return nil, ErrValidating
-	}
+import "context"
+
+func (u *UniversalUnroller) unrollImageSet(ctx context.Context, event UnrollEvent) (Content, error) {
+	return u.unrollImageSetAt(ctx, event, "")
+}
 
-	members, ok := event.c[membersField].([]interface{})
-	if !ok {
-		return nil, ErrConverting
+// unrollImageSetAt unrolls an image set found at path inside the unrolled document.
+func (u *UniversalUnroller) unrollImageSetAt(ctx context.Context, event UnrollEvent, path string) (_ Content, err error) {
+	ctx, span := startSpan(ctx, "unrollImageSet", attrUUID.String(event.uuid))
+	defer func() { endSpan(span, err) }()
+
+	imageUUIDs, err := imageSetMemberUUIDs(event.c, path)
+	if err != nil {
+		return nil, err
 	}
-	if len(members) == 0 {
+	if len(imageUUIDs) == 0 {
 		return event.c, nil
 	}
 
+	span.SetAttributes(attrUUIDCount.Int(len(imageUUIDs)))
+	state := unrollStateFrom(ctx)
+	state.handledBy("imageset")
+	for _, imageUUID := range imageUUIDs {
+		state.noteReference(referenceDiagnostic{Field: membersField, UUID: imageUUID, Parent: event.uuid})
+	}
+	images, cutoffs, err := readWithinLimits(ctx, u.reader.Get, imageUUIDs, []string{event.uuid}, event.tid)
+	if err != nil {
+		return nil, err
+	}
+
+	return u.withImageSetMembers(event.c, event.uuid, imageUUIDs, images, cutoffs, state), nil
+}
+
+// imageSetMemberUUIDs validates the image set found at path and returns the UUIDs of its members.
+func imageSetMemberUUIDs(c Content, path string) ([]string, error) {
+	if !validateImageSet(c) {
+		return nil, ErrValidating
+	}
+
+	var imageSet ImageSet
+	if err := imageSet.decode(c.root(path)); err != nil {
+		return nil, err
+	}
+
 	var imageUUIDs []string
-	for _, m := range members {
-		memberID, ok := m.(map[string]interface{})["id"].(string)
-		if !ok {
-			return nil, ErrConverting
-		}
-		uuid, err := extractUUIDFromString(memberID)
+	for _, m := range imageSet.Members {
+		uuid, err := m.UUID()
 		if err != nil {
 			return nil, err
 		}
 		imageUUIDs = append(imageUUIDs, uuid)
 	}
+	return imageUUIDs, nil
+}
 
-	images, err := u.reader.Get(imageUUIDs, event.tid)
-	if err != nil {
-		return nil, err
-	}
-
+// withImageSetMembers returns a copy of the image set having its members replaced by the images read for them.
+// Images which were cut off are replaced by a marked reference, missing images by a plain one.
+func (u *UniversalUnroller) withImageSetMembers(c Content, setUUID string, imageUUIDs []string, images map[string]Content, cutoffs map[string]string, state *unrollState) Content {
 	unrolledImages := []Content{}
 	for _, imageUUID := range imageUUIDs {
-		unrolledImages = append(unrolledImages, images[imageUUID])
+		ref := Content{id: createID(u.apiHost, "content", imageUUID)}
+		if reason, isCut := cutoffs[imageUUID]; isCut {
+			unrolledImages = append(unrolledImages, state.cutoff(ref, reason))
+			continue
+		}
+		image, found := images[imageUUID]
+		if !found {
+			state.broken(referenceDiagnostic{Field: membersField, UUID: imageUUID, Parent: setUUID})
+			image = ref
+		}
+		unrolledImages = append(unrolledImages, image)
 	}
 
-	returnContent := event.c.clone()
+	returnContent := c.clone()
 	returnContent[membersField] = unrolledImages
-	return returnContent, nil
+	return returnContent
 }
 
 func validateImageSet(c Content) bool {
@@ -1,6 +1,7 @@
 package content
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -108,7 +109,7 @@ func TestUniversalUnroller_unrollImageSet(t *testing.T) {
 				log:     tt.unrollerFields.log,
 				apiHost: tt.unrollerFields.apiHost,
 			}
-			got, err := u.unrollImageSet(tt.event)
+			got, err := u.unrollImageSet(context.Background(), tt.event)
 			if !tt.wantErr(t, err, fmt.Sprintf("unrollImageSet(%v)", tt.event)) {
 				return
 			}
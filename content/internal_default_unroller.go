@@ -1,6 +1,10 @@
 package content
 
-import "github.com/Financial-Times/go-logger/v2"
+import (
+	"context"
+
+	"github.com/Financial-Times/go-logger/v2"
+)
 
 type DefaultInternalUnroller DefaultUnroller
 
@@ -8,28 +12,24 @@ func NewDefaultInternalUnroller(r Reader, log *logger.UPPLogger, apiHost string)
 	return (*DefaultInternalUnroller)(NewDefaultUnroller(r, log, apiHost))
 }
 
-func (u *DefaultInternalUnroller) Unroll(req UnrollEvent) (Content, error) {
-	if !validateInternalDefaultContent(req.c) {
-		return req.c, ErrValidating
-	}
-
-	cc := req.c.clone()
-	expLeadImages, foundImages := unrollLeadImages(cc, u.reader, u.log, req.tid, req.uuid)
-	if foundImages {
-		cc[leadImages] = expLeadImages
-	}
+func (u *DefaultInternalUnroller) Unroll(ctx context.Context, req UnrollEvent) (_ Content, err error) {
+	ctx, span := startSpan(ctx, "DefaultInternalUnroller.Unroll", attrUUID.String(req.uuid))
+	defer func() { endSpan(span, err) }()
 
-	dynContents, foundDyn := unrollDynamicContent(cc, u.log, req.tid, req.uuid, u.reader.GetInternal)
-	if foundDyn {
-		cc[embeds] = dynContents
+	rules, err := selectRules(u.contentRules(), req.c)
+	if err != nil {
+		return req.c, err
 	}
 
-	return cc, nil
+	ctx = ensureUnrollState(ctx)
+	unrollStateFrom(ctx).handledBy("internal")
+	// the lead images and the dynamic content are declared by different rules, so they are read at the same time
+	return (*DefaultUnroller)(u).expand(ctx, req, rules)
 }
 
-func validateInternalDefaultContent(content Content) bool {
-	_, hasLeadImages := content[leadImages]
-	_, hasBody := content[bodyXMLField]
-
-	return hasLeadImages || hasBody
+func (u *DefaultInternalUnroller) contentRules() []ContentRules {
+	if u.rules == nil {
+		return defaultRules.InternalContent
+	}
+	return u.rules
 }
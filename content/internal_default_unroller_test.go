@@ -1,10 +1,14 @@
 package content
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/Financial-Times/go-logger/v2"
 	"github.com/stretchr/testify/assert"
@@ -44,7 +48,7 @@ func TestUnrollInternalContent(t *testing.T) {
 	assert.NoError(t, err, "Cannot read necessary test file")
 
 	req := UnrollEvent{c, "tid_sample", "sample_uuid"}
-	actual, actualErr := cu.Unroll(req)
+	actual, actualErr := cu.Unroll(context.Background(), req)
 	assert.NoError(t, actualErr, "Should not receive error for expanding internal content")
 
 	actualJSON, err := json.Marshal(actual)
@@ -81,7 +85,7 @@ func TestUnrollInternalContent_LeadImagesSkippedWhenReadingError(t *testing.T) {
 	assert.NoError(t, err, "Cannot read necessary test file")
 
 	req := UnrollEvent{c, "tid_sample", "sample_uuid"}
-	actual, actualErr := cu.Unroll(req)
+	actual, actualErr := cu.Unroll(context.Background(), req)
 	assert.NoError(t, actualErr, "Should not receive error for expanding internal content")
 
 	actualJSON, err := json.Marshal(actual)
@@ -118,10 +122,145 @@ func TestUnrollInternalContent_DynamicContentSkippedWhenReadingError(t *testing.
 	assert.NoError(t, err, "Cannot read necessary test file")
 
 	req := UnrollEvent{c, "tid_sample", "sample_uuid"}
-	actual, actualErr := cu.Unroll(req)
+	actual, actualErr := cu.Unroll(context.Background(), req)
 	assert.NoError(t, actualErr, "Should not receive error for expanding internal content")
 
 	actualJSON, err := json.Marshal(actual)
 	assert.NoError(t, err, "Expected to marshall correctly")
 	assert.JSONEq(t, string(actualJSON), string(expected))
+
+	state := newUnrollState(Limits{})
+	state.mode = LenientMode
+	actual, actualErr = cu.Unroll(withUnrollState(context.Background(), state), req)
+	assert.NoError(t, actualErr)
+	assert.Equal(t, []Content{withEmbed(Content{id: "http://test.api.ft.com/content/d02886fc-58ff-11e8-9859-6668838a4c10"}, Embed{
+		UUID: "d02886fc-58ff-11e8-9859-6668838a4c10",
+		Type: DynamicContentType,
+		Attributes: map[string]string{
+			"data-embedded": "true",
+			"type":          DynamicContentType,
+			"url":           "http://test.api.ft.com/content/d02886fc-58ff-11e8-9859-6668838a4c10",
+		},
+		Position: 4,
+		Parent:   "body",
+	})}, actual[embeds])
+	assert.Equal(t, []referenceDiagnostic{
+		{Field: "embeds[0]", UUID: "d02886fc-58ff-11e8-9859-6668838a4c10", Status: referenceFailed, Reason: "Error retrieving content"},
+	}, state.brokenReferences())
+	delete(actual, embeds)
+	actualJSON, err = json.Marshal(actual)
+	assert.NoError(t, err, "Expected to marshall correctly")
+	assert.JSONEq(t, string(actualJSON), string(expected))
+
+	strict := newUnrollState(Limits{})
+	strict.mode = StrictMode
+	_, actualErr = cu.Unroll(withUnrollState(context.Background(), strict), req)
+	assert.NoError(t, actualErr)
+	var unrollErr *UnrollError
+	assert.ErrorAs(t, strict.checkMode(), &unrollErr, "Expected the failed read to fail strict mode")
+	assert.Equal(t, CodeBrokenReferences, unrollErr.Code)
+	assert.Equal(t, strict.brokenReferences(), unrollErr.references)
+}
+
+func TestUnrollInternalContent_DoesNotMutateInputOrReaderContent(t *testing.T) {
+	var readerContent, dynamicContent map[string]Content
+	b, err := os.ReadFile("testdata/reader-internalcontent-valid-response.json")
+	assert.NoError(t, err, "Cannot open file necessary for test case")
+	assert.NoError(t, json.Unmarshal(b, &readerContent), "Cannot build reader response")
+	db, err := os.ReadFile("testdata/reader-internalcontent-dynamic-valid-response.json")
+	assert.NoError(t, err, "Cannot open file necessary for test case")
+	assert.NoError(t, json.Unmarshal(db, &dynamicContent), "Cannot build reader response")
+
+	var c Content
+	fileBytes, err := os.ReadFile("testdata/internalcontent-valid-request.json")
+	assert.NoError(t, err, "File necessary for building request body nod found")
+	assert.NoError(t, json.Unmarshal(fileBytes, &c), "Expected to build json body")
+
+	expected, err := os.ReadFile("testdata/internalcontent-valid-response.json")
+	assert.NoError(t, err, "Cannot read necessary test file")
+
+	cu := DefaultInternalUnroller{
+		reader: &ReaderMock{
+			mockGet: func(_ []string, _ string) (map[string]Content, error) {
+				return readerContent, nil
+			},
+			mockGetInternal: func(_ []string, _ string) (map[string]Content, error) {
+				return dynamicContent, nil
+			},
+		},
+		log:     logger.NewUPPLogger("test-service", "Error"),
+		apiHost: "test.api.ft.com",
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			actual, err := cu.Unroll(context.Background(), UnrollEvent{c, "tid_sample", "sample_uuid"})
+			assert.NoError(t, err, "Should not receive error for expanding internal content")
+			actualJSON, err := json.Marshal(actual)
+			assert.NoError(t, err, "Expected to marshall correctly")
+			assert.JSONEq(t, string(expected), string(actualJSON))
+		}()
+	}
+	wg.Wait()
+
+	actualInput, err := json.Marshal(c)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(fileBytes), string(actualInput), "Input content should not be changed")
+	actualReaderContent, err := json.Marshal(readerContent)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(b), string(actualReaderContent), "Content returned by the reader should not be changed")
+	actualDynamicContent, err := json.Marshal(dynamicContent)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(db), string(actualDynamicContent), "Content returned by the reader should not be changed")
+}
+
+func TestUnrollInternalContent_LeadImagesAndDynamicContentAreReadConcurrently(t *testing.T) {
+	var bothCalled sync.WaitGroup
+	bothCalled.Add(2)
+	var sequential atomic.Bool
+	waitForOther := func() error {
+		bothCalled.Done()
+		done := make(chan struct{})
+		go func() {
+			bothCalled.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil
+		case <-time.After(time.Second):
+			sequential.Store(true)
+			return errors.New("reads were not made concurrently")
+		}
+	}
+
+	cu := DefaultInternalUnroller{
+		reader: &ReaderMock{
+			mockGet: func(_ []string, _ string) (map[string]Content, error) {
+				return map[string]Content{}, waitForOther()
+			},
+			mockGetInternal: func(_ []string, _ string) (map[string]Content, error) {
+				return map[string]Content{}, waitForOther()
+			},
+		},
+		log:     logger.NewUPPLogger("test-service", "Error"),
+		apiHost: "test.api.ft.com",
+	}
+
+	var c Content
+	fileBytes, err := os.ReadFile("testdata/internalcontent-valid-request.json")
+	assert.NoError(t, err, "File necessary for building request body nod found")
+	assert.NoError(t, json.Unmarshal(fileBytes, &c), "Expected to build json body")
+
+	actual, err := cu.Unroll(context.Background(), UnrollEvent{c, "tid_sample", "sample_uuid"})
+	assert.NoError(t, err)
+	// failed reads are stubbed in lenient mode, so whether they waited for each other is checked on its own
+	assert.False(t, sequential.Load(), "Lead images and dynamic content should be read at the same time")
+	_, foundLeadImages := actual[leadImages].([]Content)
+	assert.True(t, foundLeadImages, "Lead images should be expanded when both reads succeed")
+	_, foundEmbeds := actual[embeds].([]Content)
+	assert.True(t, foundEmbeds, "Dynamic content should be expanded when both reads succeed")
 }
@@ -0,0 +1,286 @@
+package content
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxDepth   = 4
+	DefaultMaxItems   = 200
+	DefaultMaxFetches = 50
+	DefaultTimeout    = 10 * time.Second
+
+	// cutoffField marks related content which was left unexpanded because a limit was reached.
+	cutoffField = "_unrollCutoff"
+	// unrollField holds the metadata added to responses which could not be fully unrolled.
+	unrollField = "_unroll"
+
+	cutoffCycle      = "cycle"
+	cutoffMaxDepth   = "max_depth"
+	cutoffMaxItems   = "max_items"
+	cutoffMaxFetches = "max_fetches"
+	cutoffDeadline   = "deadline"
+)
+
+// Limits bound how much related content a single request can expand. Zero values are replaced by the defaults.
+type Limits struct {
+	// MaxDepth is the number of levels of related content expanded below the unrolled content,
+	// e.g. a clip set embedded in an article is on level 1, its clips on level 2 and their posters on level 3.
+	MaxDepth int `yaml:"maxDepth"`
+	// MaxItems is the number of distinct content items read from the content store. It is checked before every
+	// read, a read which returns set members together with the sets can go over it.
+	MaxItems int `yaml:"maxItems"`
+	// MaxFetches is the number of reads made from the content store.
+	MaxFetches int `yaml:"maxFetches"`
+	// Timeout is the time a request has to be unrolled in. Content not read by then is left unexpanded.
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+func (l Limits) withDefaults() Limits {
+	if l.MaxDepth <= 0 {
+		l.MaxDepth = DefaultMaxDepth
+	}
+	if l.MaxItems <= 0 {
+		l.MaxItems = DefaultMaxItems
+	}
+	if l.MaxFetches <= 0 {
+		l.MaxFetches = DefaultMaxFetches
+	}
+	if l.Timeout <= 0 {
+		l.Timeout = DefaultTimeout
+	}
+	return l
+}
+
+// unrollState keeps track of the content read while unrolling a single request, so that the limits are enforced
+// across all the expansions made for it.
+type unrollState struct {
+	limits Limits
+
+	mu      sync.Mutex
+	visited map[string]bool
+	fetches int
+	cutoffs map[string]int
+	diag    *diagnostics
+	debug   bool
+	// indexEmbeds sets the data-embed-index attribute of the tags embedding content in the returned body.
+	indexEmbeds bool
+	// inlineBody sets the data of the expanded images and clips on the tags embedding them in the returned body.
+	inlineBody bool
+
+	mode     Mode
+	failed   map[string]string
+	warnings []referenceDiagnostic
+	// upstreamErr is the first failed read caused by the content store being unavailable.
+	upstreamErr error
+}
+
+func newUnrollState(limits Limits) *unrollState {
+	return &unrollState{
+		limits:  limits.withDefaults(),
+		visited: map[string]bool{},
+		cutoffs: map[string]int{},
+		diag:    newDiagnostics(),
+		mode:    DefaultMode,
+		failed:  map[string]string{},
+	}
+}
+
+type unrollStateKey struct{}
+
+// withUnrollState returns a context carrying the state of the request being unrolled.
+func withUnrollState(ctx context.Context, state *unrollState) context.Context {
+	return context.WithValue(ctx, unrollStateKey{}, state)
+}
+
+// unrollStateFrom returns the state of the request being unrolled. Unrolling outside of a request, e.g. when an
+// unroller is used directly, gets a new state with the default limits.
+func unrollStateFrom(ctx context.Context) *unrollState {
+	if state, ok := ctx.Value(unrollStateKey{}).(*unrollState); ok {
+		return state
+	}
+	return newUnrollState(Limits{})
+}
+
+// ensureUnrollState returns ctx if it already carries the state of the request being unrolled, otherwise it
+// returns a context carrying a new state with the default limits.
+func ensureUnrollState(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(unrollStateKey{}).(*unrollState); ok {
+		return ctx
+	}
+	return withUnrollState(ctx, newUnrollState(Limits{}))
+}
+
+// reserve splits uuids into the ones which can be read within the item budget and the ones which are cut off.
+// UUIDs already read for the request don't count against the budget again.
+func (s *unrollState) reserve(uuids []string) (allowed []string, cut []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, uuid := range uuids {
+		switch {
+		case s.visited[uuid]:
+			allowed = append(allowed, uuid)
+		case len(s.visited) < s.limits.MaxItems:
+			s.visited[uuid] = true
+			allowed = append(allowed, uuid)
+		default:
+			cut = append(cut, uuid)
+		}
+	}
+	return allowed, cut
+}
+
+// reserveFetch reports whether one more read from the content store fits in the fetch budget.
+func (s *unrollState) reserveFetch() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fetches >= s.limits.MaxFetches {
+		return false
+	}
+	s.fetches++
+	return true
+}
+
+// record marks content read together with the requested UUIDs, like the members of sets, as visited.
+func (s *unrollState) record(content map[string]Content) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for uuid := range content {
+		s.visited[uuid] = true
+	}
+}
+
+// exceedsDepth reports whether content on the given level is too deep to be expanded.
+func (s *unrollState) exceedsDepth(depth int) bool {
+	return depth > s.limits.MaxDepth
+}
+
+// cutoff returns a copy of the unexpanded reference marked with the reason it was not expanded.
+func (s *unrollState) cutoff(ref Content, reason string) Content {
+	s.mu.Lock()
+	s.cutoffs[reason]++
+	s.mu.Unlock()
+
+	marked := ref.clone()
+	marked[cutoffField] = reason
+	return marked
+}
+
+// truncated reports whether any content was left unexpanded because of a limit. Cycles are not counted, as
+// content closing a cycle is already expanded elsewhere in the response.
+func (s *unrollState) truncated() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for reason, n := range s.cutoffs {
+		if reason != cutoffCycle && n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// metadata returns the block added to the response: whether it is partial, the number of references cut off for
+// each reason, the broken references, if any, and, for requests asking for them, the diagnostics.
+func (s *unrollState) metadata() map[string]interface{} {
+	partial := s.truncated()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoffs := make(map[string]interface{}, len(s.cutoffs))
+	for reason, n := range s.cutoffs {
+		cutoffs[reason] = n
+	}
+	meta := map[string]interface{}{
+		"partial": partial,
+		"cutoffs": cutoffs,
+	}
+	if len(s.warnings) > 0 && s.reportsWarnings() {
+		meta["warnings"] = slices.Clone(s.warnings)
+	}
+	if s.debug && s.diag != nil {
+		for k, v := range s.diag.report() {
+			meta[k] = v
+		}
+	}
+	return meta
+}
+
+// readWithinLimits reads the related content using read, skipping UUIDs which would close a cycle with one of the
+// ancestors and UUIDs over the budgets of the request. Once the request runs out of time, the UUIDs not read yet
+// are cut off instead of failing the request. The reason each skipped UUID was cut off for is returned by UUID.
+// A failed read fails requests in strict mode only, in lenient mode its UUIDs are recorded as failed and treated
+// as missing.
+func readWithinLimits(ctx context.Context, read ReaderFunc, uuids []string, ancestors []string, tid string) (map[string]Content, map[string]string, error) {
+	state := unrollStateFrom(ctx)
+	cut := map[string]string{}
+	var toRead []string
+	for _, uuid := range uniqueUUIDs(uuids) {
+		if slices.Contains(ancestors, uuid) {
+			cut[uuid] = cutoffCycle
+			continue
+		}
+		toRead = append(toRead, uuid)
+	}
+
+	toRead, overBudget := state.reserve(toRead)
+	for _, uuid := range overBudget {
+		cut[uuid] = cutoffMaxItems
+	}
+	defer func() {
+		for uuid, reason := range cut {
+			state.noteStatus(uuid, referenceCutOff, reason)
+		}
+	}()
+	if len(toRead) == 0 {
+		return map[string]Content{}, cut, nil
+	}
+
+	cutAll := func(reason string) {
+		for _, uuid := range toRead {
+			cut[uuid] = reason
+		}
+	}
+	if ctx.Err() != nil {
+		cutAll(cutoffDeadline)
+		return map[string]Content{}, cut, nil
+	}
+	if !state.reserveFetch() {
+		cutAll(cutoffMaxFetches)
+		return map[string]Content{}, cut, nil
+	}
+
+	start := time.Now()
+	content, err := read(ctx, toRead, tid)
+	state.noteBatch(toRead, time.Since(start), err)
+	if err != nil && ctx.Err() == nil {
+		for _, uuid := range toRead {
+			state.noteStatus(uuid, referenceFailed, "")
+		}
+		if state.mode == DefaultMode {
+			return nil, nil, err
+		}
+		state.readFailed(toRead, err)
+		return map[string]Content{}, cut, nil
+	}
+	if content == nil {
+		content = map[string]Content{}
+	}
+	state.record(content)
+	for _, uuid := range toRead {
+		state.noteStatus(uuid, referenceMissing, "")
+	}
+	for uuid := range content {
+		state.noteStatus(uuid, referenceFetched, "")
+	}
+	if err != nil {
+		// the request ran out of time while reading, what was read until then is still used
+		for _, uuid := range toRead {
+			if _, found := content[uuid]; !found {
+				cut[uuid] = cutoffDeadline
+			}
+		}
+	}
+	return content, cut, nil
+}
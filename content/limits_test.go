@@ -0,0 +1,232 @@
+package content
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	limitsTestArticleUUID = "a3b1f7c4-8a3f-4b3a-9c47-1e2d3f4a5b6c"
+	limitsTestClipSetUUID = "f6074f3c-b331-4a89-963c-f72eaf3895ae"
+	limitsTestClipUUID    = "c96a594e-2466-422e-9aed-200abdc4de1c"
+	limitsTestPosterUUID  = "99d3c5f9-eeee-461f-a0d8-13f671fa17ae"
+	limitsTestImageUUID   = "e37aa9c0-69bd-4bd0-8874-c90f0a265894"
+)
+
+// limitsTestReader reads content like ContentReader, together with the members of the sets, and records the UUIDs
+// requested in every call.
+func limitsTestReader(content map[string]Content, calls *[][]string) *ReaderMock {
+	var mu sync.Mutex
+	return &ReaderMock{
+		mockGet: func(uuids []string, _ string) (map[string]Content, error) {
+			mu.Lock()
+			*calls = append(*calls, uuids)
+			mu.Unlock()
+			res := map[string]Content{}
+			for _, u := range uuids {
+				c, found := content[u]
+				if !found {
+					continue
+				}
+				res[u] = c
+				for _, memberUUID := range c.getMembersUUID() {
+					if member, found := content[memberUUID]; found {
+						res[memberUUID] = member
+					}
+				}
+			}
+			return res, nil
+		},
+	}
+}
+
+func limitsTestContent(posterMembers ...string) map[string]Content {
+	var members []interface{}
+	for _, m := range posterMembers {
+		members = append(members, map[string]interface{}{id: "http://www.ft.com/thing/" + m})
+	}
+	return map[string]Content{
+		limitsTestClipSetUUID: {
+			id:           "http://www.ft.com/thing/" + limitsTestClipSetUUID,
+			typeField:    ClipSetType,
+			membersField: []interface{}{map[string]interface{}{id: "http://www.ft.com/thing/" + limitsTestClipUUID, formatField: ""}},
+		},
+		limitsTestClipUUID: {
+			id:          "http://www.ft.com/thing/" + limitsTestClipUUID,
+			typeField:   ClipType,
+			posterField: map[string]interface{}{apiURLField: "https://api.ft.com/content/" + limitsTestPosterUUID},
+		},
+		limitsTestPosterUUID: {
+			id:           "http://www.ft.com/thing/" + limitsTestPosterUUID,
+			typeField:    ImageSetType,
+			membersField: members,
+		},
+		limitsTestImageUUID: {
+			id:        "http://www.ft.com/thing/" + limitsTestImageUUID,
+			typeField: "http://www.ft.com/ontology/content/Image",
+		},
+	}
+}
+
+func limitsTestEmbed(uuid string, contentType string) string {
+	return `<ft-content type="` + contentType + `" url="http://api.ft.com/content/` + uuid + `" data-embedded="true"></ft-content>`
+}
+
+// limitsTestEmbedded returns the content expanded for the embed at the position of a body built with limitsTestEmbed.
+func limitsTestEmbedded(c Content, uuid string, contentType string, position int) Content {
+	return withEmbed(c, Embed{
+		UUID:       uuid,
+		Type:       contentType,
+		Attributes: map[string]string{"type": contentType, "url": "http://api.ft.com/content/" + uuid, "data-embedded": "true"},
+		Position:   position,
+		Parent:     "body",
+	})
+}
+
+func TestUnrollState_Reserve(t *testing.T) {
+	state := newUnrollState(Limits{MaxItems: 2})
+
+	allowed, cut := state.reserve([]string{"a", "b", "c"})
+	assert.Equal(t, []string{"a", "b"}, allowed)
+	assert.Equal(t, []string{"c"}, cut)
+
+	allowed, cut = state.reserve([]string{"b", "d"})
+	assert.Equal(t, []string{"b"}, allowed, "Content already read should not count against the budget again")
+	assert.Equal(t, []string{"d"}, cut)
+
+	assert.False(t, state.truncated())
+	marked := state.cutoff(Content{id: "d"}, cutoffMaxItems)
+	assert.Equal(t, Content{id: "d", cutoffField: cutoffMaxItems}, marked)
+	assert.True(t, state.truncated())
+}
+
+func TestLimits_withDefaults(t *testing.T) {
+	assert.Equal(t, Limits{MaxDepth: DefaultMaxDepth, MaxItems: DefaultMaxItems, MaxFetches: DefaultMaxFetches, Timeout: DefaultTimeout}, Limits{}.withDefaults())
+	assert.Equal(t, Limits{MaxDepth: 1, MaxItems: 2, MaxFetches: 3, Timeout: time.Second}, Limits{MaxDepth: 1, MaxItems: 2, MaxFetches: 3, Timeout: time.Second}.withDefaults())
+}
+
+func TestUnrollContent_PosterCycleIsCutOff(t *testing.T) {
+	// the poster of the clip has the clip itself as a member
+	var calls [][]string
+	ctx := withUnrollState(context.Background(), newUnrollState(Limits{MaxDepth: 10}))
+	cu := NewDefaultUnroller(limitsTestReader(limitsTestContent(limitsTestClipUUID), &calls), logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com")
+
+	c := Content{bodyXMLField: "<body>" + limitsTestEmbed(limitsTestClipSetUUID, ClipSetType) + "</body>"}
+	actual, err := cu.Unroll(ctx, UnrollEvent{c, "tid_sample", limitsTestArticleUUID})
+	assert.NoError(t, err)
+	assert.Len(t, calls, 2)
+
+	clip := actual[embeds].([]Content)[0][membersField].([]Content)[0]
+	poster := clip[posterField].(Content)
+	assert.Equal(t, []Content{{id: "http://www.ft.com/thing/" + limitsTestClipUUID, cutoffField: cutoffCycle}}, poster[membersField])
+}
+
+func TestUnrollContent_SelfEmbeddingIsCutOff(t *testing.T) {
+	var calls [][]string
+	cu := NewDefaultUnroller(limitsTestReader(limitsTestContent(), &calls), logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com")
+
+	c := Content{bodyXMLField: "<body>" + limitsTestEmbed(limitsTestArticleUUID, DynamicContentType) + "</body>"}
+	actual, err := cu.Unroll(context.Background(), UnrollEvent{c, "tid_sample", limitsTestArticleUUID})
+	assert.NoError(t, err)
+	assert.Empty(t, calls, "Content should not be read to expand itself")
+	assert.Equal(t, []Content{
+		limitsTestEmbedded(Content{id: "http://test.api.ft.com/content/" + limitsTestArticleUUID, cutoffField: cutoffCycle}, limitsTestArticleUUID, DynamicContentType, 0),
+	}, actual[embeds])
+}
+
+func TestUnrollContent_MaxDepthCutsOffPosters(t *testing.T) {
+	var calls [][]string
+	ctx := withUnrollState(context.Background(), newUnrollState(Limits{MaxDepth: 2}))
+	cu := NewDefaultUnroller(limitsTestReader(limitsTestContent(limitsTestImageUUID), &calls), logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com")
+
+	c := Content{bodyXMLField: "<body>" + limitsTestEmbed(limitsTestClipSetUUID, ClipSetType) + "</body>"}
+	actual, err := cu.Unroll(ctx, UnrollEvent{c, "tid_sample", limitsTestArticleUUID})
+	assert.NoError(t, err)
+	assert.Len(t, calls, 1, "Posters over the maximum depth should not be read")
+
+	clip := actual[embeds].([]Content)[0][membersField].([]Content)[0]
+	assert.Equal(t, ClipType, clip[typeField])
+	assert.Equal(t, Content{apiURLField: "https://api.ft.com/content/" + limitsTestPosterUUID, cutoffField: cutoffMaxDepth}, clip[posterField])
+}
+
+func TestUnrollContent_MaxItemsCutsOffEmbeds(t *testing.T) {
+	dynamicUUIDs := []string{"d6c3a1d6-9b08-11e7-8cf8-1a0da58f8a2a", "d6c3a1d6-9b08-11e7-8cf8-1a0da58f8a2b"}
+	readerContent := map[string]Content{}
+	body := "<body>"
+	for _, u := range dynamicUUIDs {
+		readerContent[u] = Content{id: "http://www.ft.com/thing/" + u, typeField: DynamicContentType}
+		body += limitsTestEmbed(u, DynamicContentType)
+	}
+	body += "</body>"
+
+	var calls [][]string
+	ctx := withUnrollState(context.Background(), newUnrollState(Limits{MaxItems: 1}))
+	cu := NewDefaultUnroller(limitsTestReader(readerContent, &calls), logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com")
+
+	actual, err := cu.Unroll(ctx, UnrollEvent{Content{bodyXMLField: body}, "tid_sample", limitsTestArticleUUID})
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{dynamicUUIDs[:1]}, calls)
+	assert.Equal(t, []Content{
+		limitsTestEmbedded(readerContent[dynamicUUIDs[0]], dynamicUUIDs[0], DynamicContentType, 0),
+		limitsTestEmbedded(Content{id: "http://test.api.ft.com/content/" + dynamicUUIDs[1], cutoffField: cutoffMaxItems}, dynamicUUIDs[1], DynamicContentType, 1),
+	}, actual[embeds])
+}
+
+func TestUnrollClipSet_MaxDepthCutsOffPosterImages(t *testing.T) {
+	var calls [][]string
+	ctx := withUnrollState(context.Background(), newUnrollState(Limits{MaxDepth: 2}))
+	u := NewUniversalUnroller(limitsTestReader(limitsTestContent(limitsTestImageUUID), &calls), logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com")
+
+	clipSet := limitsTestContent()[limitsTestClipSetUUID]
+	actual, err := u.UnrollContent(ctx, UnrollEvent{clipSet, "tid_sample", limitsTestClipSetUUID})
+	assert.NoError(t, err)
+	assert.Len(t, calls, 2, "Poster images over the maximum depth should not be read")
+
+	poster := actual[membersField].([]Content)[0][posterField].(Content)
+	assert.Equal(t, []Content{{id: "http://test.api.ft.com/content/" + limitsTestImageUUID, cutoffField: cutoffMaxDepth}}, poster[membersField])
+}
+
+func TestReadWithinLimits_CutsOffWhenOutOfTimeOrFetches(t *testing.T) {
+	uuids := []string{"d6c3a1d6-9b08-11e7-8cf8-1a0da58f8a2a"}
+	reads := 0
+	read := func(_ context.Context, uuids []string, _ string) (map[string]Content, error) {
+		reads++
+		return map[string]Content{uuids[0]: {id: uuids[0]}}, nil
+	}
+
+	ctx := withUnrollState(context.Background(), newUnrollState(Limits{MaxFetches: 1}))
+	content, cut, err := readWithinLimits(ctx, read, uuids, nil, "tid_sample")
+	assert.NoError(t, err)
+	assert.Len(t, content, 1)
+	assert.Empty(t, cut)
+
+	_, cut, err = readWithinLimits(ctx, read, []string{"d6c3a1d6-9b08-11e7-8cf8-1a0da58f8a2b"}, nil, "tid_sample")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"d6c3a1d6-9b08-11e7-8cf8-1a0da58f8a2b": cutoffMaxFetches}, cut)
+
+	expired, cancel := context.WithCancel(withUnrollState(context.Background(), newUnrollState(Limits{})))
+	cancel()
+	_, cut, err = readWithinLimits(expired, read, uuids, nil, "tid_sample")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{uuids[0]: cutoffDeadline}, cut)
+	assert.Equal(t, 1, reads, "Nothing should be read over the fetch budget or after the deadline")
+}
+
+func TestReadWithinLimits_KeepsContentReadBeforeTheDeadline(t *testing.T) {
+	uuids := []string{"d6c3a1d6-9b08-11e7-8cf8-1a0da58f8a2a", "d6c3a1d6-9b08-11e7-8cf8-1a0da58f8a2b"}
+	ctx, cancel := context.WithCancel(withUnrollState(context.Background(), newUnrollState(Limits{})))
+	read := func(_ context.Context, uuids []string, _ string) (map[string]Content, error) {
+		cancel()
+		return map[string]Content{uuids[0]: {id: uuids[0]}}, context.Canceled
+	}
+
+	content, cut, err := readWithinLimits(ctx, read, uuids, nil, "tid_sample")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Content{uuids[0]: {id: uuids[0]}}, content)
+	assert.Equal(t, map[string]string{uuids[1]: cutoffDeadline}, cut)
+}
@@ -0,0 +1,207 @@
+package content
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	metricsNamespace = "content_unroller"
+
+	// unknownLabel is used for requests whose content type is not known, e.g. as the body could not be decoded.
+	unknownLabel = "unknown"
+	// upstreamError and upstreamTimeout are the statuses of reads from the content store which got no response.
+	upstreamError   = "error"
+	upstreamTimeout = "timeout"
+)
+
+// Metrics records what the service does. Implementations must be safe for concurrent use.
+type Metrics interface {
+	// ObserveRequest records a request served by an API endpoint, by the type of the content sent.
+	ObserveRequest(endpoint string, contentType string, status int, duration time.Duration)
+	// ObserveUpstream records a read from the content store, by the path read and the response status.
+	ObserveUpstream(target string, status string, duration time.Duration)
+	// CountExpansion records a reference to related content which was expanded, by the field it was found in.
+	CountExpansion(field string)
+	// CountMissingReference records a reference to related content which was missing from the content store or
+	// could not be read from it, by the field it was found in.
+	CountMissingReference(field string)
+	// CountClientRequest records a request checked against the rate limits of its client, and whether it was limited.
+	CountClientRequest(client string, limited bool)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveRequest(string, string, int, time.Duration) {}
+func (noopMetrics) ObserveUpstream(string, string, time.Duration)     {}
+func (noopMetrics) CountExpansion(string)                             {}
+func (noopMetrics) CountMissingReference(string)                      {}
+func (noopMetrics) CountClientRequest(string, bool)                   {}
+
+// PrometheusMetrics records the metrics in a Prometheus registry.
+type PrometheusMetrics struct {
+	registry         *prometheus.Registry
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	upstream         *prometheus.CounterVec
+	upstreamDuration *prometheus.HistogramVec
+	expansions       *prometheus.CounterVec
+	missing          *prometheus.CounterVec
+	clients          *prometheus.CounterVec
+}
+
+// NewPrometheusMetrics registers the metrics of the service in the registry.
+func NewPrometheusMetrics(registry *prometheus.Registry) *PrometheusMetrics {
+	m := &PrometheusMetrics{
+		registry: registry,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "requests_total",
+			Help:      "Requests served, by endpoint, content type and response status.",
+		}, []string{"endpoint", "content_type", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "request_duration_seconds",
+			Help:      "Time taken to serve requests, by endpoint and content type.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"endpoint", "content_type"}),
+		upstream: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "upstream_requests_total",
+			Help:      "Reads from the content store, by path and response status.",
+		}, []string{"target", "status"}),
+		upstreamDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "upstream_request_duration_seconds",
+			Help:      "Time taken by reads from the content store, by path and response status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"target", "status"}),
+		expansions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "expansions_total",
+			Help:      "References to related content expanded, by field.",
+		}, []string{"field"}),
+		missing: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "missing_references_total",
+			Help:      "References to related content missing from the content store or which could not be read, by field.",
+		}, []string{"field"}),
+		clients: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "client_requests_total",
+			Help:      "Requests checked against the rate limits, by client and whether they were allowed or limited.",
+		}, []string{"client", "outcome"}),
+	}
+	registry.MustRegister(m.requests, m.requestDuration, m.upstream, m.upstreamDuration, m.expansions, m.missing, m.clients)
+	return m
+}
+
+// Handler serves the metrics of the registry in the Prometheus exposition format.
+func (m *PrometheusMetrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+func (m *PrometheusMetrics) ObserveRequest(endpoint string, contentType string, status int, duration time.Duration) {
+	m.requests.WithLabelValues(endpoint, contentType, strconv.Itoa(status)).Inc()
+	m.requestDuration.WithLabelValues(endpoint, contentType).Observe(duration.Seconds())
+}
+
+func (m *PrometheusMetrics) ObserveUpstream(target string, status string, duration time.Duration) {
+	m.upstream.WithLabelValues(target, status).Inc()
+	m.upstreamDuration.WithLabelValues(target, status).Observe(duration.Seconds())
+}
+
+func (m *PrometheusMetrics) CountExpansion(field string) {
+	m.expansions.WithLabelValues(field).Inc()
+}
+
+func (m *PrometheusMetrics) CountMissingReference(field string) {
+	m.missing.WithLabelValues(field).Inc()
+}
+
+func (m *PrometheusMetrics) CountClientRequest(client string, limited bool) {
+	outcome := "allowed"
+	if limited {
+		outcome = "limited"
+	}
+	m.clients.WithLabelValues(client, outcome).Inc()
+}
+
+// requestLabels holds the labels of a request which are only known once the handler decoded its body.
+type requestLabels struct {
+	contentType string
+}
+
+type requestLabelsKey struct{}
+
+// setContentTypeLabel records the type of the content sent with the request, for the request metrics.
+func setContentTypeLabel(r *http.Request, c Content) {
+	if labels, ok := r.Context().Value(requestLabelsKey{}).(*requestLabels); ok {
+		labels.contentType = contentTypeLabel(c)
+	}
+}
+
+// contentTypeLabels are the labels of the content types the service knows about. Other types are labelled as
+// unknown, so that the types sent by clients can't add labels to the metrics.
+var contentTypeLabels = map[string]string{
+	ArticleType:        "Article",
+	ImageSetType:       "ImageSet",
+	DynamicContentType: "DynamicContent",
+	ClipSetType:        "ClipSet",
+	ClipType:           "Clip",
+}
+
+// contentTypeLabel returns the name of the type of the content, e.g. Article.
+func contentTypeLabel(c Content) string {
+	if label, known := contentTypeLabels[getEventType(c)]; known {
+		return label
+	}
+	return unknownLabel
+}
+
+// Instrument records every request with the metrics, by the path template of the route it matched.
+func Instrument(m Metrics) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			endpoint := routeTemplate(r)
+			labels := &requestLabels{contentType: unknownLabel}
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), requestLabelsKey{}, labels)))
+			m.ObserveRequest(endpoint, labels.contentType, sw.status, time.Since(start))
+		})
+	}
+}
+
+// routeTemplate returns the path template of the route the request matched, or its path outside of a router.
+func routeTemplate(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if tpl, err := route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return r.URL.Path
+}
+
+var fieldIndex = regexp.MustCompile(`\[\d+]$`)
+
+// countReferences records the references found while unrolling a request which were expanded, or missing.
+// References are counted by field without their position, e.g. embeds rather than embeds[2].
+func (s *unrollState) countReferences(m Metrics) {
+	for _, ref := range s.references() {
+		field := fieldIndex.ReplaceAllString(ref.Field, "")
+		switch ref.Status {
+		case referenceFetched:
+			m.CountExpansion(field)
+		case referenceMissing, referenceFailed:
+			m.CountMissingReference(field)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package content
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// metricsRecorder is a Metrics keeping what was recorded, so that tests can assert on it.
+type metricsRecorder struct {
+	mu         sync.Mutex
+	requests   []string
+	upstream   []string
+	expansions map[string]int
+	missing    map[string]int
+	clients    []string
+}
+
+func newMetricsRecorder() *metricsRecorder {
+	return &metricsRecorder{expansions: map[string]int{}, missing: map[string]int{}}
+}
+
+func (m *metricsRecorder) ObserveRequest(endpoint string, contentType string, status int, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests = append(m.requests, endpoint+" "+contentType+" "+http.StatusText(status))
+}
+
+func (m *metricsRecorder) ObserveUpstream(target string, status string, _ time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.upstream = append(m.upstream, target+" "+status)
+}
+
+func (m *metricsRecorder) CountExpansion(field string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expansions[field]++
+}
+
+func (m *metricsRecorder) CountMissingReference(field string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.missing[field]++
+}
+
+func (m *metricsRecorder) CountClientRequest(client string, limited bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if limited {
+		client += " limited"
+	}
+	m.clients = append(m.clients, client)
+}
+
+func TestInstrument(t *testing.T) {
+	metrics := newMetricsRecorder()
+	r := mux.NewRouter()
+	r.Use(Instrument(metrics))
+	r.HandleFunc("/content", func(w http.ResponseWriter, r *http.Request) {
+		setContentTypeLabel(r, Content{typeField: ClipSetType})
+		w.WriteHeader(http.StatusTeapot)
+	})
+	r.HandleFunc("/internalcontent", func(w http.ResponseWriter, _ *http.Request) {})
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/content", nil))
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/internalcontent", nil))
+
+	assert.Equal(t, []string{"/content ClipSet I'm a teapot", "/internalcontent unknown OK"}, metrics.requests)
+}
+
+func TestContentTypeLabel(t *testing.T) {
+	tests := []struct {
+		contentType interface{}
+		want        string
+	}{
+		{contentType: ArticleType, want: "Article"},
+		{contentType: ClipSetType, want: "ClipSet"},
+		{contentType: "http://www.ft.com/ontology/content/Audio", want: unknownLabel},
+		{contentType: "http://www.ft.com/ontology/content/" + strings.Repeat("x", 64), want: unknownLabel},
+		{contentType: "Article", want: unknownLabel},
+		{contentType: 42, want: unknownLabel},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.want, contentTypeLabel(Content{typeField: test.contentType}))
+	}
+}
+
+func TestContentReader_ObservesUpstream(t *testing.T) {
+	metrics := newMetricsRecorder()
+	ok := successfulContentServerMock(t, "testdata/source-content-valid-response.json")
+	defer ok.Close()
+	unavailable := errorContentServerMock(t, http.StatusServiceUnavailable)
+	defer unavailable.Close()
+
+	for _, host := range []string{ok.URL, unavailable.URL} {
+		cr := NewContentReader(ReaderConfig{
+			ContentStoreAppName:         "content-source-app-name",
+			ContentStoreHost:            host,
+			ContentPathEndpoint:         "/content",
+			InternalContentPathEndpoint: "/internalcontent",
+			Metrics:                     metrics,
+		}, http.DefaultClient)
+		cr.GetInternal(context.Background(), testData, "tid_sample")
+	}
+
+	assert.Equal(t, []string{"/internalcontent 200", "/internalcontent 503"}, metrics.upstream)
+}
+
+func TestHandler_CountsReferences(t *testing.T) {
+	imageUUID := "639cd952-149f-11e7-2ea7-a07ecd9ac73f"
+	missingUUID := "d6c3a1d6-9b08-11e7-8cf8-1a0da58f8a2a"
+	body, err := json.Marshal(Content{
+		id:             "http://www.ft.com/thing/22c0d426-1466-11e7-b0c1-37e417ee6c76",
+		typeField:      ArticleType,
+		mainImageField: map[string]interface{}{id: "http://api.ft.com/content/" + imageUUID},
+		bodyXMLField:   `<body><ft-content type="http://www.ft.com/ontology/content/ImageSet" url="http://api.ft.com/content/` + missingUUID + `" data-embedded="true"></ft-content></body>`,
+	})
+	assert.NoError(t, err)
+	reader := &ReaderMock{
+		mockGet: func(_ []string, _ string) (map[string]Content, error) {
+			return map[string]Content{imageUUID: {id: "http://api.ft.com/content/" + imageUUID}}, nil
+		},
+	}
+	metrics := newMetricsRecorder()
+	h := NewHandler(
+		NewUniversalUnroller(reader, logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com"),
+		logger.NewUPPLogger("test-service", "Error"),
+		Limits{},
+		WithMetrics(metrics),
+	)
+	req, err := http.NewRequest(http.MethodPost, "/content", bytes.NewReader(body))
+	assert.NoError(t, err, "Cannot create request necessary for test")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(h.GetContent).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, map[string]int{mainImageField: 1}, metrics.expansions)
+	assert.Equal(t, map[string]int{embeds: 1}, metrics.missing)
+}
@@ -0,0 +1,96 @@
+package content
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
+	"github.com/gorilla/mux"
+)
+
+// MaxRequestSize limits the size of request bodies to limit bytes. Bigger bodies are rejected with a 413 response by the handlers.
+func MaxRequestSize(limit int64) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireJSON rejects requests which declare a Content-Type other than JSON. Requests without a Content-Type are let through.
+func RequireJSON(log *logger.UPPLogger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ct := r.Header.Get("Content-Type")
+			if ct == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			mediaType, _, err := mime.ParseMediaType(ct)
+			if err != nil || mediaType != "application/json" {
+				tid := transactionidutils.GetTransactionIDFromRequest(r)
+				handleError(r, log, tid, "", w, newUnrollError(CodeUnsupportedMedia, "", fmt.Errorf("unsupported Content-Type %q", ct)))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// errUnexpected is the error returned for panics, whose value and stack are only logged.
+var errUnexpected = errors.New("unexpected error")
+
+// RecoverPanics turns a panic in any of the next handlers into a 500 response instead of dropping the connection.
+func RecoverPanics(log *logger.UPPLogger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if rec := recover(); rec != nil {
+					if rec == http.ErrAbortHandler {
+						panic(rec)
+					}
+					tid := transactionidutils.GetTransactionIDFromRequest(r)
+					log.WithTransactionID(tid).WithField("stack", string(debug.Stack())).
+						Errorf("Recovered from panic while serving %s: %v", r.RequestURI, rec)
+					handleError(r, log, tid, "", w, errUnexpected)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Timing logs how long each request took to be served together with its response status.
+func Timing(log *logger.UPPLogger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(sw, r)
+			log.WithTransactionID(transactionidutils.GetTransactionIDFromRequest(r)).
+				WithFields(map[string]interface{}{
+					"request_url":   r.RequestURI,
+					"status":        sw.status,
+					"response_time": time.Since(start).Milliseconds(),
+				}).Debugf("Request %s %s served in %v", r.Method, r.RequestURI, time.Since(start))
+		})
+	}
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	sw.status = status
+	sw.ResponseWriter.WriteHeader(status)
+}
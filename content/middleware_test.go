@@ -0,0 +1,103 @@
+package content
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxRequestSize(t *testing.T) {
+	h := Handler{
+		Unroller: &UniversalUnroller{},
+		log:      logger.NewUPPLogger("test-service", "Error"),
+	}
+	handler := MaxRequestSize(10)(http.HandlerFunc(h.GetContent))
+
+	req := httptest.NewRequest(http.MethodPost, "/content", strings.NewReader(InvalidBodyRequest))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	var p problem
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+	assert.Equal(t, CodeRequestTooLarge, p.Code)
+}
+
+func TestRequireJSON(t *testing.T) {
+	tests := []struct {
+		name           string
+		contentType    string
+		expectedStatus int
+	}{
+		{
+			name:           "json",
+			contentType:    "application/json",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "json with charset",
+			contentType:    "application/json; charset=UTF-8",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "missing content type",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "form",
+			contentType:    "application/x-www-form-urlencoded",
+			expectedStatus: http.StatusUnsupportedMediaType,
+		},
+	}
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	handler := RequireJSON(logger.NewUPPLogger("test-service", "Error"))(next)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/content", strings.NewReader("{}"))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+			assert.Equal(t, tt.expectedStatus, rr.Code)
+		})
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	next := http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {
+		panic("unexpected content")
+	})
+	handler := RecoverPanics(logger.NewUPPLogger("test-service", "Error"))(next)
+
+	req := httptest.NewRequest(http.MethodPost, "/content", strings.NewReader("{}"))
+	req.Header.Set("X-Request-Id", "tid_test")
+	rr := httptest.NewRecorder()
+	assert.NotPanics(t, func() { handler.ServeHTTP(rr, req) })
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+	var p problem
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+	assert.Equal(t, CodeInternal, p.Code)
+	assert.Equal(t, "tid_test", p.TransactionID)
+	assert.Equal(t, "unexpected error", p.Detail, "The panic value should not be returned")
+}
+
+func TestTiming(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := Timing(logger.NewUPPLogger("test-service", "Error"))(next)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/content", nil))
+	assert.Equal(t, http.StatusTeapot, rr.Code)
+}
@@ -0,0 +1,472 @@
+package content
+
+import (
+	"encoding/json"
+	"math"
+)
+
+// The types below model the content the unroller knows how to expand. Only the fields the unrollers rely on are
+// typed, every other field is kept in Extra, so that decoding a Content and encoding it back is lossless.
+// Decoding reports fields of an unexpected JSON type as a *PathError naming the field.
+
+// Reference points to another piece of content, e.g. a main image, an image set member or a package item.
+type Reference struct {
+	ID     string
+	APIURL string
+	Type   string
+	Extra  Content
+
+	path string
+}
+
+// ClipSetMember is a reference to a clip together with the format it is played in. Format is nil when the
+// member does not declare one, an empty format is valid.
+type ClipSetMember struct {
+	Reference
+	Format *string
+}
+
+// Article is any content expanded by the default unrollers. The references it holds, like its main image, are
+// declared by the expansion rules and found in Extra.
+type Article struct {
+	ID      string
+	Type    string
+	BodyXML string
+	Extra   Content
+
+	path string
+}
+
+type ImageSet struct {
+	ID      string
+	Type    string
+	Members []Reference
+	Extra   Content
+
+	path string
+}
+
+// MediaResource is a single image binary, a member of an ImageSet, or a single rendition of a Clip.
+type MediaResource struct {
+	ID          string
+	Type        string
+	BinaryURL   string
+	PixelWidth  int
+	PixelHeight int
+	Extra       Content
+
+	path string
+}
+
+type Clip struct {
+	ID         string
+	Type       string
+	Poster     *Reference
+	DataSource []MediaResource
+	Extra      Content
+
+	path string
+}
+
+type ClipSet struct {
+	ID      string
+	Type    string
+	Members []ClipSetMember
+	Extra   Content
+
+	path string
+}
+
+type DynamicContent struct {
+	ID    string
+	Type  string
+	Extra Content
+
+	path string
+}
+
+// ContentPackage models both content packages and live blog packages.
+type ContentPackage struct {
+	ID       string
+	Type     string
+	Contains []Reference
+	Extra    Content
+
+	path string
+}
+
+// UUID returns the UUID the reference points to, taken from its id or, failing that, its apiUrl.
+func (r Reference) UUID() (string, error) {
+	if r.ID == "" && r.APIURL == "" {
+		return "", &PathError{Path: joinPath(r.path, id), Want: "string"}
+	}
+	if r.ID != "" {
+		return Content{id: r.ID}.root(r.path).field(id).uuid()
+	}
+	return Content{apiURLField: r.APIURL}.root(r.path).field(apiURLField).uuid()
+}
+
+func (r *Reference) decode(v value) error {
+	d := newDecoder(v)
+	d.str(id, &r.ID)
+	d.str(apiURLField, &r.APIURL)
+	d.str(typeField, &r.Type)
+	r.Extra, r.path = d.extra, v.path
+	return d.err
+}
+
+func (r Reference) toContent() Content {
+	e := newEncoder(r.Extra)
+	e.str(id, r.ID)
+	e.str(apiURLField, r.APIURL)
+	e.str(typeField, r.Type)
+	return e.c
+}
+
+func (m *ClipSetMember) decode(v value) error {
+	if err := m.Reference.decode(v); err != nil {
+		return err
+	}
+	d := newDecoder(m.Extra.root(v.path))
+	d.optionalStr(formatField, &m.Format)
+	m.Extra = d.extra
+	return d.err
+}
+
+func (m ClipSetMember) toContent() Content {
+	e := newEncoder(m.Reference.toContent())
+	if m.Format != nil {
+		e.set(formatField, *m.Format)
+	}
+	return e.c
+}
+
+func (a *Article) decode(v value) error {
+	d := newDecoder(v)
+	d.str(id, &a.ID)
+	d.str(typeField, &a.Type)
+	d.str(bodyXMLField, &a.BodyXML)
+	a.Extra, a.path = d.extra, v.path
+	return d.err
+}
+
+func (a Article) toContent() Content {
+	e := newEncoder(a.Extra)
+	e.str(id, a.ID)
+	e.str(typeField, a.Type)
+	e.str(bodyXMLField, a.BodyXML)
+	return e.c
+}
+
+func (s *ImageSet) decode(v value) error {
+	d := newDecoder(v)
+	d.str(id, &s.ID)
+	d.str(typeField, &s.Type)
+	d.array(membersField, func(_ int, mv value) error {
+		var m Reference
+		err := m.decode(mv)
+		s.Members = append(s.Members, m)
+		return err
+	})
+	s.Extra, s.path = d.extra, v.path
+	return d.err
+}
+
+func (s ImageSet) toContent() Content {
+	e := newEncoder(s.Extra)
+	e.str(id, s.ID)
+	e.str(typeField, s.Type)
+	if s.Members != nil {
+		e.set(membersField, toContentList(s.Members))
+	}
+	return e.c
+}
+
+func (m *MediaResource) decode(v value) error {
+	d := newDecoder(v)
+	d.str(id, &m.ID)
+	d.str(typeField, &m.Type)
+	d.str(binaryURLField, &m.BinaryURL)
+	d.int(pixelWidthField, &m.PixelWidth)
+	d.int(pixelHeightField, &m.PixelHeight)
+	m.Extra, m.path = d.extra, v.path
+	return d.err
+}
+
+func (m MediaResource) toContent() Content {
+	e := newEncoder(m.Extra)
+	e.str(id, m.ID)
+	e.str(typeField, m.Type)
+	e.str(binaryURLField, m.BinaryURL)
+	e.int(pixelWidthField, m.PixelWidth)
+	e.int(pixelHeightField, m.PixelHeight)
+	return e.c
+}
+
+func (c *Clip) decode(v value) error {
+	d := newDecoder(v)
+	d.str(id, &c.ID)
+	d.str(typeField, &c.Type)
+	d.object(posterField, func(pv value) error {
+		c.Poster = &Reference{}
+		return c.Poster.decode(pv)
+	})
+	d.array(dataSourceField, func(_ int, mv value) error {
+		var m MediaResource
+		err := m.decode(mv)
+		c.DataSource = append(c.DataSource, m)
+		return err
+	})
+	c.Extra, c.path = d.extra, v.path
+	return d.err
+}
+
+func (c Clip) toContent() Content {
+	e := newEncoder(c.Extra)
+	e.str(id, c.ID)
+	e.str(typeField, c.Type)
+	if c.Poster != nil {
+		e.set(posterField, c.Poster.toContent())
+	}
+	if c.DataSource != nil {
+		e.set(dataSourceField, toContentList(c.DataSource))
+	}
+	return e.c
+}
+
+func (s *ClipSet) decode(v value) error {
+	d := newDecoder(v)
+	d.str(id, &s.ID)
+	d.str(typeField, &s.Type)
+	d.array(membersField, func(_ int, mv value) error {
+		var m ClipSetMember
+		err := m.decode(mv)
+		s.Members = append(s.Members, m)
+		return err
+	})
+	s.Extra, s.path = d.extra, v.path
+	return d.err
+}
+
+func (s ClipSet) toContent() Content {
+	e := newEncoder(s.Extra)
+	e.str(id, s.ID)
+	e.str(typeField, s.Type)
+	if s.Members != nil {
+		e.set(membersField, toContentList(s.Members))
+	}
+	return e.c
+}
+
+func (dc *DynamicContent) decode(v value) error {
+	d := newDecoder(v)
+	d.str(id, &dc.ID)
+	d.str(typeField, &dc.Type)
+	dc.Extra, dc.path = d.extra, v.path
+	return d.err
+}
+
+func (dc DynamicContent) toContent() Content {
+	e := newEncoder(dc.Extra)
+	e.str(id, dc.ID)
+	e.str(typeField, dc.Type)
+	return e.c
+}
+
+func (p *ContentPackage) decode(v value) error {
+	d := newDecoder(v)
+	d.str(id, &p.ID)
+	d.str(typeField, &p.Type)
+	d.array(containsField, func(_ int, rv value) error {
+		var r Reference
+		err := r.decode(rv)
+		p.Contains = append(p.Contains, r)
+		return err
+	})
+	p.Extra, p.path = d.extra, v.path
+	return d.err
+}
+
+func (p ContentPackage) toContent() Content {
+	e := newEncoder(p.Extra)
+	e.str(id, p.ID)
+	e.str(typeField, p.Type)
+	if p.Contains != nil {
+		e.set(containsField, toContentList(p.Contains))
+	}
+	return e.c
+}
+
+func (r Reference) MarshalJSON() ([]byte, error)        { return json.Marshal(r.toContent()) }
+func (r *Reference) UnmarshalJSON(b []byte) error       { return unmarshalModel(b, r) }
+func (m ClipSetMember) MarshalJSON() ([]byte, error)    { return json.Marshal(m.toContent()) }
+func (m *ClipSetMember) UnmarshalJSON(b []byte) error   { return unmarshalModel(b, m) }
+func (a Article) MarshalJSON() ([]byte, error)          { return json.Marshal(a.toContent()) }
+func (a *Article) UnmarshalJSON(b []byte) error         { return unmarshalModel(b, a) }
+func (s ImageSet) MarshalJSON() ([]byte, error)         { return json.Marshal(s.toContent()) }
+func (s *ImageSet) UnmarshalJSON(b []byte) error        { return unmarshalModel(b, s) }
+func (m MediaResource) MarshalJSON() ([]byte, error)    { return json.Marshal(m.toContent()) }
+func (m *MediaResource) UnmarshalJSON(b []byte) error   { return unmarshalModel(b, m) }
+func (c Clip) MarshalJSON() ([]byte, error)             { return json.Marshal(c.toContent()) }
+func (c *Clip) UnmarshalJSON(b []byte) error            { return unmarshalModel(b, c) }
+func (s ClipSet) MarshalJSON() ([]byte, error)          { return json.Marshal(s.toContent()) }
+func (s *ClipSet) UnmarshalJSON(b []byte) error         { return unmarshalModel(b, s) }
+func (dc DynamicContent) MarshalJSON() ([]byte, error)  { return json.Marshal(dc.toContent()) }
+func (dc *DynamicContent) UnmarshalJSON(b []byte) error { return unmarshalModel(b, dc) }
+func (p ContentPackage) MarshalJSON() ([]byte, error)   { return json.Marshal(p.toContent()) }
+func (p *ContentPackage) UnmarshalJSON(b []byte) error  { return unmarshalModel(b, p) }
+
+type model interface {
+	decode(v value) error
+	toContent() Content
+}
+
+func unmarshalModel(b []byte, m model) error {
+	var c Content
+	if err := json.Unmarshal(b, &c); err != nil {
+		return err
+	}
+	return m.decode(c.root(""))
+}
+
+func toContentList[M interface{ toContent() Content }](models []M) []interface{} {
+	list := make([]interface{}, 0, len(models))
+	for _, m := range models {
+		list = append(list, map[string]interface{}(m.toContent()))
+	}
+	return list
+}
+
+// decoder consumes the known fields of an object. Fields which are absent or hold a zero value are left in
+// extra, so that they are written back exactly as they were received.
+type decoder struct {
+	v     value
+	extra Content
+	err   error
+}
+
+func newDecoder(v value) *decoder {
+	obj, err := v.object()
+	return &decoder{v: v, extra: obj.clone(), err: err}
+}
+
+func (d *decoder) field(key string) (value, bool) {
+	if d.err != nil {
+		return value{}, false
+	}
+	f := d.v.field(key)
+	return f, f.exists() && f.v != nil
+}
+
+func (d *decoder) str(key string, dst *string) {
+	f, found := d.field(key)
+	if !found {
+		return
+	}
+	s, err := f.str()
+	if err != nil {
+		d.err = err
+		return
+	}
+	if s != "" {
+		*dst = s
+		delete(d.extra, key)
+	}
+}
+
+// optionalStr decodes a string field whose presence matters, dst is left nil when the field is absent.
+func (d *decoder) optionalStr(key string, dst **string) {
+	f, found := d.field(key)
+	if !found {
+		return
+	}
+	s, err := f.str()
+	if err != nil {
+		d.err = err
+		return
+	}
+	*dst = &s
+	delete(d.extra, key)
+}
+
+func (d *decoder) int(key string, dst *int) {
+	f, found := d.field(key)
+	if !found {
+		return
+	}
+	n, ok := f.v.(float64)
+	if !ok {
+		d.err = f.typeError("number")
+		return
+	}
+	if n != 0 && n == math.Trunc(n) && math.Abs(n) <= math.MaxInt32 {
+		*dst = int(n)
+		delete(d.extra, key)
+	}
+}
+
+// object decodes the field with fn, failing when it is not an object.
+func (d *decoder) object(key string, fn func(value) error) {
+	f, found := d.field(key)
+	if !found {
+		return
+	}
+	if _, err := f.object(); err != nil {
+		d.err = err
+		return
+	}
+	if d.err = fn(f); d.err == nil {
+		delete(d.extra, key)
+	}
+}
+
+// optionalObject decodes the field with fn only when it is an object, other values are kept as they are.
+func (d *decoder) optionalObject(key string, fn func(value) error) {
+	f, found := d.field(key)
+	if !found {
+		return
+	}
+	if _, err := f.object(); err != nil {
+		return
+	}
+	d.object(key, fn)
+}
+
+// array decodes every element of the field with fn. Empty arrays are kept in extra.
+func (d *decoder) array(key string, fn func(int, value) error) {
+	f, found := d.field(key)
+	if !found {
+		return
+	}
+	if d.err = f.each(fn); d.err != nil {
+		return
+	}
+	if arr, _ := f.array(); len(arr) > 0 {
+		delete(d.extra, key)
+	}
+}
+
+type encoder struct {
+	c Content
+}
+
+func newEncoder(extra Content) *encoder {
+	c := extra.clone()
+	return &encoder{c: c}
+}
+
+func (e *encoder) str(key string, s string) {
+	if s != "" {
+		e.c[key] = s
+	}
+}
+
+func (e *encoder) int(key string, n int) {
+	if n != 0 {
+		e.c[key] = float64(n)
+	}
+}
+
+func (e *encoder) set(key string, v interface{}) {
+	e.c[key] = v
+}
@@ -0,0 +1,94 @@
+package content
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModel_RoundTripIsLossless(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		model func() interface{}
+	}{
+		{name: "article", file: "testdata/content-valid-request.json", model: func() interface{} { return &Article{} }},
+		{name: "article with promotional image", file: "testdata/invalid-article-missing-promotionalImage-id.json", model: func() interface{} { return &Article{} }},
+		{name: "internal article", file: "testdata/internalcontent-valid-request.json", model: func() interface{} { return &Article{} }},
+		{name: "clip set", file: "testdata/content-clipset-valid-request.json", model: func() interface{} { return &ClipSet{} }},
+		{name: "clip set with no members", file: "testdata/content-clipSet-with-no-members-valid-request.json", model: func() interface{} { return &ClipSet{} }},
+		{name: "image set with no members", file: "testdata/content-imageSet-with-no-members-valid-request.json", model: func() interface{} { return &ImageSet{} }},
+		{name: "content package", file: "testdata/internalcontent-contentpackage-valid-request.json", model: func() interface{} { return &ContentPackage{} }},
+		{name: "live blog package", file: "testdata/content-liveblogpackage-valid-request.json", model: func() interface{} { return &ContentPackage{} }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := os.ReadFile(tt.file)
+			assert.NoError(t, err, "Cannot read necessary test file")
+
+			m := tt.model()
+			assert.NoError(t, json.Unmarshal(b, m))
+			actual, err := json.Marshal(m)
+			assert.NoError(t, err)
+			assert.JSONEq(t, string(b), string(actual))
+		})
+	}
+}
+
+func TestModel_RoundTripOfReaderResponses(t *testing.T) {
+	b, err := os.ReadFile("testdata/reader-content-clipset-valid-response.json")
+	assert.NoError(t, err, "Cannot read necessary test file")
+
+	var raw map[string]json.RawMessage
+	assert.NoError(t, json.Unmarshal(b, &raw))
+
+	clip := Clip{}
+	assert.NoError(t, json.Unmarshal(raw["c96a594e-2466-422e-9aed-200abdc4de1c"], &clip))
+	assert.Equal(t, "https://api.ft.com/content/99d3c5f9-eeee-461f-a0d8-13f671fa17ae", clip.Poster.APIURL)
+	assert.Equal(t, 1920, clip.DataSource[0].PixelWidth)
+	actual, err := json.Marshal(clip)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(raw["c96a594e-2466-422e-9aed-200abdc4de1c"]), string(actual))
+
+	imageSet := ImageSet{}
+	assert.NoError(t, json.Unmarshal(raw["99d3c5f9-eeee-461f-a0d8-13f671fa17ae"], &imageSet))
+	assert.Equal(t, ImageSetType, imageSet.Type)
+	memberUUID, err := imageSet.Members[0].UUID()
+	assert.NoError(t, err)
+	assert.Equal(t, "e37aa9c0-69bd-4bd0-8874-c90f0a265894", memberUUID)
+	actual, err = json.Marshal(imageSet)
+	assert.NoError(t, err)
+	assert.JSONEq(t, string(raw["99d3c5f9-eeee-461f-a0d8-13f671fa17ae"]), string(actual))
+}
+
+func TestModel_DecodesTypedFields(t *testing.T) {
+	var a Article
+	err := json.Unmarshal([]byte(`{
+		"id": "http://www.ft.com/thing/22c0d426-1466-11e7-b0c1-37e417ee6c76",
+		"type": "http://www.ft.com/ontology/content/Article",
+		"bodyXML": "<body></body>",
+		"mainImage": {"id": "http://test.api.ft.com/content/639cd952-149f-11e7-2ea7-a07ecd9ac73f"}
+	}`), &a)
+	assert.NoError(t, err)
+
+	assert.Equal(t, ArticleType, a.Type)
+	assert.Equal(t, "<body></body>", a.BodyXML)
+	assert.Equal(t, Content{mainImageField: map[string]interface{}{id: "http://test.api.ft.com/content/639cd952-149f-11e7-2ea7-a07ecd9ac73f"}}, a.Extra,
+		"The references declared by the rules should be kept untyped")
+}
+
+func TestModel_DecodeReportsPath(t *testing.T) {
+	var s ClipSet
+	err := json.Unmarshal([]byte(`{"members": [{"id": "http://www.ft.com/thing/f6074f3c-b331-4a89-963c-f72eaf3895ae", "format": 5}]}`), &s)
+	path, found := malformedPath(err)
+	assert.True(t, found)
+	assert.Equal(t, "members[0].format", path)
+
+	var c Clip
+	err = json.Unmarshal([]byte(`{"poster": "http://api.ft.com/content/99d3c5f9-eeee-461f-a0d8-13f671fa17ae"}`), &c)
+	path, found = malformedPath(err)
+	assert.True(t, found)
+	assert.Equal(t, "poster", path)
+}
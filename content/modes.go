@@ -0,0 +1,105 @@
+package content
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// modeHeader selects how a request treats related content which is missing from the content store or could not
+// be read.
+const modeHeader = "X-Unroll-Mode"
+
+// Mode is the way an unroll request treats broken references.
+type Mode string
+
+const (
+	// DefaultMode is the mode of the requests which don't ask for one, on every endpoint. Reads of the related
+	// content which fail fail the request, unless the rule of the references skips failed reads. Posters which
+	// could not be read and related content which is missing are left unexpanded. None of them are reported in the
+	// response.
+	DefaultMode Mode = ""
+	// LenientMode leaves broken references unexpanded and lists them as warnings in the response.
+	LenientMode Mode = "lenient"
+	// StrictMode fails the request listing the broken references, both the missing ones and the ones which could
+	// not be read.
+	StrictMode Mode = "strict"
+)
+
+// parseMode returns the mode asked for by the value of the mode header, the default mode when the header is not set.
+func parseMode(header string) (Mode, error) {
+	switch Mode(strings.ToLower(strings.TrimSpace(header))) {
+	case DefaultMode:
+		return DefaultMode, nil
+	case LenientMode:
+		return LenientMode, nil
+	case StrictMode:
+		return StrictMode, nil
+	}
+	return "", newUnrollError(CodeUnsupportedMode, modeHeader, fmt.Errorf("unsupported unroll mode %q, expected %s or %s", header, LenientMode, StrictMode))
+}
+
+// strict reports whether broken references fail the request.
+func (s *unrollState) strict() bool {
+	return s.mode == StrictMode
+}
+
+// reportsWarnings reports whether the broken references are listed in the response, which only requests in lenient
+// mode or asking for diagnostics get.
+func (s *unrollState) reportsWarnings() bool {
+	return s.mode == LenientMode || (s.debug && s.diag != nil)
+}
+
+// readFailed records the UUIDs of a read which failed, so that the references to them are reported as failed
+// rather than missing.
+func (s *unrollState) readFailed(uuids []string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, uuid := range uuids {
+		s.failed[uuid] = err.Error()
+	}
+	if s.upstreamErr == nil && isUpstreamFailure(err) {
+		s.upstreamErr = err
+	}
+}
+
+// upstreamFailure returns the first read which failed as the content store is unavailable, nil if there was none.
+func (s *unrollState) upstreamFailure() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.upstreamErr
+}
+
+// broken records a reference which could not be expanded, as its content is missing or could not be read.
+func (s *unrollState) broken(ref referenceDiagnostic) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ref.Status, ref.Reason = referenceMissing, ""
+	if reason, failed := s.failed[ref.UUID]; failed {
+		ref.Status, ref.Reason = referenceFailed, reason
+	}
+	s.warnings = append(s.warnings, ref)
+}
+
+// brokenReferences returns the references recorded as broken so far.
+func (s *unrollState) brokenReferences() []referenceDiagnostic {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.warnings)
+}
+
+// checkMode fails requests in strict mode which have broken references.
+func (s *unrollState) checkMode() error {
+	if !s.strict() {
+		return nil
+	}
+	refs := s.brokenReferences()
+	if len(refs) == 0 {
+		return nil
+	}
+	return &UnrollError{
+		Code:       CodeBrokenReferences,
+		Err:        fmt.Errorf("%d references to related content could not be expanded", len(refs)),
+		references: refs,
+	}
+}
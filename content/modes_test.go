@@ -0,0 +1,49 @@
+package content
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    Mode
+		wantErr bool
+	}{
+		{header: "", want: DefaultMode},
+		{header: "lenient", want: LenientMode},
+		{header: "Strict", want: StrictMode},
+		{header: " strict ", want: StrictMode},
+		{header: "sloppy", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.header, func(t *testing.T) {
+			mode, err := parseMode(test.header)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.want, mode)
+		})
+	}
+}
+
+func TestUnrollState_BrokenReferencesReadFailed(t *testing.T) {
+	state := newUnrollState(Limits{})
+	state.readFailed([]string{"a"}, assert.AnError)
+	state.broken(referenceDiagnostic{Field: mainImageField, UUID: "a"})
+	state.broken(referenceDiagnostic{Field: embeds + "[0]", UUID: "b"})
+
+	assert.Equal(t, []referenceDiagnostic{
+		{Field: mainImageField, UUID: "a", Status: referenceFailed, Reason: assert.AnError.Error()},
+		{Field: "embeds[0]", UUID: "b", Status: referenceMissing},
+	}, state.brokenReferences())
+	assert.NoError(t, state.checkMode(), "Lenient mode should not fail")
+
+	state.mode = StrictMode
+	assert.Error(t, state.checkMode())
+}
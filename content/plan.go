@@ -0,0 +1,206 @@
+package content
+
+import "strings"
+
+// Plan describes what unrolling a piece of content would expand, worked out from the content alone without reading
+// anything from the content store.
+type Plan struct {
+	// Unroller is the unroller the content would be dispatched to.
+	Unroller string `json:"unroller"`
+	// References lists the related content found in the content, by field and by the type it is referenced as.
+	References []PlanGroup `json:"references"`
+	// Reads lists the UUIDs of every read made from the content store for the content itself. Reads made for the
+	// related content, like the members of image sets or the posters of clips, depend on what is read and are not
+	// planned.
+	Reads [][]string `json:"reads"`
+}
+
+// PlanGroup lists the UUIDs of the related content referenced in a field as the same type. The type is left empty
+// when the reference does not declare one.
+type PlanGroup struct {
+	Field string   `json:"field"`
+	Type  string   `json:"type,omitempty"`
+	UUIDs []string `json:"uuids"`
+}
+
+func newPlan(unroller string) Plan {
+	return Plan{Unroller: unroller, References: []PlanGroup{}, Reads: [][]string{}}
+}
+
+// add records a reference to uuid found in the field, grouping it with the references of the same field and type.
+func (p *Plan) add(field string, contentType string, uuids ...string) {
+	if len(uuids) == 0 {
+		return
+	}
+	for i, group := range p.References {
+		if group.Field == field && group.Type == contentType {
+			p.References[i].UUIDs = append(group.UUIDs, uuids...)
+			return
+		}
+	}
+	p.References = append(p.References, PlanGroup{Field: field, Type: contentType, UUIDs: uuids})
+}
+
+// read records a read from the content store. UUIDs used several times are read once.
+func (p *Plan) read(uuids []string) {
+	if unique := uniqueUUIDs(uuids); len(unique) > 0 {
+		p.Reads = append(p.Reads, unique)
+	}
+}
+
+// addContains records the items of a content package. None of the unrollers expands them, so they are listed
+// without being read.
+func (p *Plan) addContains(c Content) error {
+	if _, found := c[containsField]; !found {
+		return nil
+	}
+	var pkg ContentPackage
+	if err := pkg.decode(c.root("")); err != nil {
+		return err
+	}
+	for _, item := range pkg.Contains {
+		uuid, err := item.UUID()
+		if err != nil {
+			return err
+		}
+		p.add(containsField, item.Type, uuid)
+	}
+	return nil
+}
+
+func (u *UniversalUnroller) PlanContent(event UnrollEvent) (Plan, error) {
+	switch getEventType(event.c) {
+	case ClipSetType:
+		return u.planClipSet(event)
+	case ClipType:
+		return u.planClip(event)
+	case ImageSetType:
+		return u.planImageSet(event)
+	default:
+		return u.defaultUnroller().plan(event)
+	}
+}
+
+func (u *UniversalUnroller) PlanInternalContent(event UnrollEvent) (Plan, error) {
+	switch getEventType(event.c) {
+	default:
+		return u.defaultInternalUnroller().plan(event)
+	}
+}
+
+func (u *UniversalUnroller) planClipSet(event UnrollEvent) (Plan, error) {
+	if !validateClipset(event.c) {
+		return Plan{}, ErrValidating
+	}
+	var clipSet ClipSet
+	if err := clipSet.decode(event.c.root("")); err != nil {
+		return Plan{}, err
+	}
+
+	p := newPlan("clipset")
+	var clipUUIDs []string
+	for _, m := range clipSet.Members {
+		uuid, err := m.UUID()
+		if err != nil {
+			return Plan{}, err
+		}
+		p.add(membersField, m.Type, uuid)
+		clipUUIDs = append(clipUUIDs, uuid)
+	}
+	p.read(clipUUIDs)
+	return p, nil
+}
+
+func (u *UniversalUnroller) planClip(event UnrollEvent) (Plan, error) {
+	poster, err := clipPoster(event.c, "")
+	if err != nil {
+		return Plan{}, err
+	}
+
+	p := newPlan("clip")
+	if poster == nil {
+		return p, nil
+	}
+	posterUUID, err := poster.UUID()
+	if err != nil {
+		return Plan{}, err
+	}
+	p.add(posterField, poster.Type, posterUUID)
+	p.read([]string{posterUUID})
+	return p, nil
+}
+
+func (u *UniversalUnroller) planImageSet(event UnrollEvent) (Plan, error) {
+	imageUUIDs, err := imageSetMemberUUIDs(event.c, "")
+	if err != nil {
+		return Plan{}, err
+	}
+
+	p := newPlan("imageset")
+	p.add(membersField, "", imageUUIDs...)
+	p.read(imageUUIDs)
+	return p, nil
+}
+
+// plan runs the schema building stage of Unroll.
+func (u *DefaultUnroller) plan(req UnrollEvent) (Plan, error) {
+	rules, err := selectRules(u.contentRules(), req.c)
+	if err != nil {
+		return Plan{}, err
+	}
+	return u.planReferences(req, rules, "default")
+}
+
+// plan runs the schema building stage of Unroll.
+func (u *DefaultInternalUnroller) plan(req UnrollEvent) (Plan, error) {
+	rules, err := selectRules(u.contentRules(), req.c)
+	if err != nil {
+		return Plan{}, err
+	}
+	return (*DefaultUnroller)(u).planReferences(req, rules, "internal")
+}
+
+// planReferences lists the references declared by the rules, and the reads made for them, one for every rule
+// and endpoint the related content is read from.
+func (u *DefaultUnroller) planReferences(req UnrollEvent, rules ContentRules, unroller string) (Plan, error) {
+	// the schema is built on a copy, as finding the references prepares the content for placing the related content
+	schema, err := u.createContentSchema(req.c.deepClone(), rules, req.tid, req.uuid)
+	if err != nil {
+		return Plan{}, err
+	}
+	var article Article
+	if err := article.decode(req.c.root("")); err != nil {
+		return Plan{}, err
+	}
+
+	p := newPlan(unroller)
+	for i := range rules.References {
+		rule := &rules.References[i]
+		if rule.embedded() {
+			for _, embedType := range rule.EmbeddedTypes {
+				emContent, _ := extractEmbeddedContentByType(article, u.log, []string{embedType}, req.tid, req.uuid)
+				p.add(rule.Field, embedType, embedUUIDs(emContent)...)
+			}
+			continue
+		}
+		for _, ref := range schema.refs {
+			if ref.rule != rule {
+				continue
+			}
+			// types which are not content types, like the crops of lead images, are left out
+			refType, _ := ref.holder[typeField].(string)
+			if !strings.HasPrefix(refType, ontologyTypePrefix) {
+				refType = ""
+			}
+			p.add(rule.planField(), refType, ref.uuid)
+		}
+	}
+	for _, b := range schema.batches() {
+		p.read(b.uuids)
+	}
+
+	if err := p.addContains(req.c); err != nil {
+		return Plan{}, err
+	}
+	return p, nil
+}
@@ -0,0 +1,134 @@
+package content
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func newPlanTestUnroller(t *testing.T) *UniversalUnroller {
+	failingRead := func(_ []string, _ string) (map[string]Content, error) {
+		t.Error("The content store should not be read while planning")
+		return nil, errors.New("unexpected read")
+	}
+	reader := &ReaderMock{mockGet: failingRead, mockGetInternal: failingRead}
+	return NewUniversalUnroller(reader, logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com")
+}
+
+func readPlanTestContent(t *testing.T, file string) Content {
+	b, err := os.ReadFile(file)
+	assert.NoError(t, err, "Cannot read file necessary for test case")
+	var c Content
+	assert.NoError(t, json.Unmarshal(b, &c))
+	return c
+}
+
+func TestPlanContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		expected Plan
+	}{
+		{
+			name: "article",
+			file: "testdata/content-valid-request.json",
+			expected: Plan{
+				Unroller: "default",
+				References: []PlanGroup{
+					{Field: mainImageField, UUIDs: []string{"639cd952-149f-11e7-2ea7-a07ecd9ac73f"}},
+					{Field: embeds, Type: ImageSetType, UUIDs: []string{"639cd952-149f-11e7-2ea7-a07ecd9ac73f", "71231d3a-13c7-11e7-2ea7-a07ecd9ac73f", "0261ea4a-1474-11e7-1e92-847abda1ac65"}},
+					{Field: embeds, Type: DynamicContentType, UUIDs: []string{"d02886fc-58ff-11e8-9859-6668838a4c10"}},
+					{Field: "alternativeImages.promotionalImage", UUIDs: []string{"4723cb4e-027c-11e7-ace0-1ce02ef0def9"}},
+				},
+				Reads: [][]string{
+					{"639cd952-149f-11e7-2ea7-a07ecd9ac73f"},
+					{"71231d3a-13c7-11e7-2ea7-a07ecd9ac73f", "0261ea4a-1474-11e7-1e92-847abda1ac65", "d02886fc-58ff-11e8-9859-6668838a4c10"},
+					{"4723cb4e-027c-11e7-ace0-1ce02ef0def9"},
+				},
+			},
+		},
+		{
+			name: "clip set",
+			file: "testdata/content-clipset-valid-request.json",
+			expected: Plan{
+				Unroller:   "clipset",
+				References: []PlanGroup{{Field: membersField, UUIDs: []string{"c96a594e-2466-422e-9aed-200abdc4de1c"}}},
+				Reads:      [][]string{{"c96a594e-2466-422e-9aed-200abdc4de1c"}},
+			},
+		},
+		{
+			name: "content package",
+			file: "testdata/internalcontent-contentpackage-valid-request.json",
+			expected: Plan{
+				Unroller: "default",
+				References: []PlanGroup{
+					{Field: containsField, UUIDs: []string{
+						"2401d64e-f23e-48a6-9a0b-9ee5d777e5e4",
+						"a2602177-7ba0-470b-abfb-8cae5ef5e4a5",
+						"50656582-8b42-47d9-9bcf-decb0f976dd3",
+						"55bc9d43-1260-49ca-8a3d-0f25ae712e23",
+						"5de1a278-9d49-441d-ab67-fe6aa0f3ec9b",
+						"4bc25fa2-acb3-461f-b1f3-548f82b78b5b",
+					}},
+				},
+				Reads: [][]string{},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			actual, err := newPlanTestUnroller(t).PlanContent(UnrollEvent{c: readPlanTestContent(t, test.file), tid: "tid_sample", uuid: "uuid_sample"})
+			assert.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestPlanInternalContent(t *testing.T) {
+	c := readPlanTestContent(t, "testdata/internalcontent-valid-request.json")
+
+	actual, err := newPlanTestUnroller(t).PlanInternalContent(UnrollEvent{c: c, tid: "tid_sample", uuid: "uuid_sample"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, Plan{
+		Unroller: "internal",
+		References: []PlanGroup{
+			{Field: leadImages, UUIDs: []string{"89f194c8-13bc-11e7-80f4-13e067d5072c", "3e96c818-13bc-11e7-b0c1-37e417ee6c76", "8d7b4e22-13bc-11e7-80f4-13e067d5072c"}},
+			{Field: embeds, Type: DynamicContentType, UUIDs: []string{"d02886fc-58ff-11e8-9859-6668838a4c10"}},
+		},
+		Reads: [][]string{
+			{"89f194c8-13bc-11e7-80f4-13e067d5072c", "3e96c818-13bc-11e7-b0c1-37e417ee6c76", "8d7b4e22-13bc-11e7-80f4-13e067d5072c"},
+			{"d02886fc-58ff-11e8-9859-6668838a4c10"},
+		},
+	}, actual)
+}
+
+func TestPlanContent_DuplicateUUIDsAreReadOnce(t *testing.T) {
+	imageUUID := "4723cb4e-027c-11e7-ace0-1ce02ef0def9"
+	c := Content{
+		id:             "http://www.ft.com/thing/22c0d426-1466-11e7-b0c1-37e417ee6c76",
+		typeField:      ArticleType,
+		mainImageField: map[string]interface{}{id: "http://test.api.ft.com/content/" + imageUUID, typeField: ImageSetType},
+		bodyXMLField:   `<body><ft-content type="http://www.ft.com/ontology/content/ImageSet" url="http://api.ft.com/content/` + imageUUID + `" data-embedded="true"></ft-content></body>`,
+	}
+
+	actual, err := newPlanTestUnroller(t).PlanContent(UnrollEvent{c: c, tid: "tid_sample", uuid: "uuid_sample"})
+
+	assert.NoError(t, err)
+	assert.Equal(t, []PlanGroup{
+		{Field: mainImageField, Type: ImageSetType, UUIDs: []string{imageUUID}},
+		{Field: embeds, Type: ImageSetType, UUIDs: []string{imageUUID}},
+	}, actual.References)
+	assert.Equal(t, [][]string{{imageUUID}}, actual.Reads)
+}
+
+func TestPlanContent_InvalidContent(t *testing.T) {
+	_, err := newPlanTestUnroller(t).PlanContent(UnrollEvent{c: Content{id: "http://www.ft.com/thing/22c0d426-1466-11e7-b0c1-37e417ee6c76"}})
+
+	assert.ErrorIs(t, err, ErrValidating)
+}
@@ -0,0 +1,290 @@
+package content
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Financial-Times/go-logger/v2"
+	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
+	"github.com/gorilla/mux"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultClient is the client label of the requests from clients without their own limits.
+const defaultClient = "default"
+
+// addressClient is the client label of the requests checked against the limits of their address.
+const addressClient = "address"
+
+// maxAddresses bounds the number of addresses with their own bucket. Requests from other addresses share one bucket
+// while buckets are all in use.
+const maxAddresses = 10000
+
+// RateLimit is the rate, in requests per second, and the burst of requests a client can make.
+type RateLimit struct {
+	Rate  float64 `yaml:"rate" json:"rate"`
+	Burst int     `yaml:"burst" json:"burst"`
+}
+
+// ClientRateLimit is the rate limit of a client, and the value of the header telling its requests apart when they
+// are not authenticated.
+type ClientRateLimit struct {
+	RateLimit `yaml:",inline"`
+	// Key is the value of the header sent by the client, e.g. its API key.
+	Key string `yaml:"key" json:"key"`
+}
+
+// RateLimitConfig sets the rate limits of the clients, by name. Requests are told apart by the name of the client
+// they were authenticated as, or by the value of a request header when they were not.
+type RateLimitConfig struct {
+	// Header holds the key of the client, e.g. X-Api-Key. It is only needed for requests which are not
+	// authenticated.
+	Header string `yaml:"header" json:"header"`
+	// Default is shared by all the requests from clients without their own limits, or without the header. They
+	// are not limited when it is not set.
+	Default *RateLimit `yaml:"default" json:"default"`
+	// Clients are the limits of each client by name.
+	Clients map[string]ClientRateLimit `yaml:"clients" json:"clients"`
+	// PerAddress is the limit of each address requests are sent from, checked before the requests are
+	// authenticated, so that the requests failing authentication are limited too. Addresses are not limited when
+	// it is not set.
+	PerAddress *RateLimit `yaml:"perAddress" json:"perAddress"`
+	// AddressHeader holds the address of the client set by the load balancer in front of the service, e.g.
+	// X-Forwarded-For, whose last address is used. The remote address of the connection is used when it is not set.
+	AddressHeader string `yaml:"addressHeader" json:"addressHeader"`
+}
+
+// LoadRateLimitConfig reads and validates the rate limits from a YAML file.
+func LoadRateLimitConfig(path string) (RateLimitConfig, error) {
+	var cfg RateLimitConfig
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return cfg, fmt.Errorf("decoding rate limits from %s: %w", path, err)
+	}
+	if err := cfg.validate(); err != nil {
+		return cfg, fmt.Errorf("invalid rate limits in %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (cfg RateLimitConfig) validate() error {
+	keys := map[string]string{}
+	if cfg.Default != nil {
+		if err := cfg.Default.validate(); err != nil {
+			return fmt.Errorf("default: %w", err)
+		}
+	}
+	if cfg.PerAddress != nil {
+		if err := cfg.PerAddress.validate(); err != nil {
+			return fmt.Errorf("perAddress: %w", err)
+		}
+	}
+	for client, limit := range cfg.Clients {
+		if err := limit.validate(); err != nil {
+			return fmt.Errorf("client %s: %w", client, err)
+		}
+		if limit.Key == "" {
+			continue
+		}
+		if cfg.Header == "" {
+			return fmt.Errorf("client %s: key is set but header is not set", client)
+		}
+		if other, found := keys[limit.Key]; found {
+			return fmt.Errorf("clients %s and %s have the same key", min(client, other), max(client, other))
+		}
+		keys[limit.Key] = client
+	}
+	return nil
+}
+
+func (l RateLimit) validate() error {
+	if l.Rate <= 0 {
+		return fmt.Errorf("rate must be positive, got %v", l.Rate)
+	}
+	if l.Burst < 1 {
+		return fmt.Errorf("burst must be at least 1, got %d", l.Burst)
+	}
+	return nil
+}
+
+// RateLimiter keeps a token bucket for each client with its own limits, and one shared by all the others. It also
+// keeps a bucket for each address requests are sent from, when they are limited.
+type RateLimiter struct {
+	header string
+	// names are the names of the clients by the value of the header.
+	names     map[string]string
+	clients   map[string]*rate.Limiter
+	fallback  *rate.Limiter
+	addresses *addressLimiter
+	metrics   Metrics
+}
+
+// addressLimiter keeps a token bucket for each address, up to maxAddresses of them.
+type addressLimiter struct {
+	header  string
+	limit   RateLimit
+	mu      sync.Mutex
+	buckets map[string]*rate.Limiter
+	// overflow is shared by the addresses without their own bucket while all the buckets are in use.
+	overflow *rate.Limiter
+}
+
+// bucket returns the bucket of the address. Buckets which have filled up again are dropped to make room for new
+// addresses, as they are the same as new ones.
+func (al *addressLimiter) bucket(address string) *rate.Limiter {
+	al.mu.Lock()
+	defer al.mu.Unlock()
+	if limiter, found := al.buckets[address]; found {
+		return limiter
+	}
+	if len(al.buckets) >= maxAddresses {
+		for a, limiter := range al.buckets {
+			if limiter.Tokens() >= float64(al.limit.Burst) {
+				delete(al.buckets, a)
+			}
+		}
+	}
+	if len(al.buckets) >= maxAddresses {
+		return al.overflow
+	}
+	limiter := rate.NewLimiter(rate.Limit(al.limit.Rate), al.limit.Burst)
+	al.buckets[address] = limiter
+	return limiter
+}
+
+// address returns the address the request was sent from.
+func (al *addressLimiter) address(r *http.Request) string {
+	if al.header != "" {
+		if forwarded := r.Header.Values(al.header); len(forwarded) > 0 {
+			addresses := strings.Split(forwarded[len(forwarded)-1], ",")
+			return strings.TrimSpace(addresses[len(addresses)-1])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// NewRateLimiter returns a limiter enforcing the validated config. Every request checked is counted by client with
+// the metrics, if set.
+func NewRateLimiter(cfg RateLimitConfig, m Metrics) *RateLimiter {
+	if m == nil {
+		m = noopMetrics{}
+	}
+	rl := &RateLimiter{header: cfg.Header, names: map[string]string{}, clients: map[string]*rate.Limiter{}, metrics: m}
+	for client, limit := range cfg.Clients {
+		rl.clients[client] = rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)
+		if limit.Key != "" {
+			rl.names[limit.Key] = client
+		}
+	}
+	if cfg.Default != nil {
+		rl.fallback = rate.NewLimiter(rate.Limit(cfg.Default.Rate), cfg.Default.Burst)
+	}
+	if cfg.PerAddress != nil {
+		rl.addresses = &addressLimiter{
+			header:   cfg.AddressHeader,
+			limit:    *cfg.PerAddress,
+			buckets:  map[string]*rate.Limiter{},
+			overflow: rate.NewLimiter(rate.Limit(cfg.PerAddress.Rate), cfg.PerAddress.Burst),
+		}
+	}
+	return rl
+}
+
+// client returns the name of the client sending the request: the one it was authenticated as, otherwise the one
+// with the key sent in the header. The header itself is never used as a name, as it may hold a secret.
+func (rl *RateLimiter) client(r *http.Request) string {
+	if name, authenticated := clientFrom(r.Context()); authenticated {
+		return name
+	}
+	if rl.header == "" {
+		return ""
+	}
+	return rl.names[r.Header.Get(rl.header)]
+}
+
+// allow reports whether the request is within the limits of its client, and otherwise how long the client has to
+// wait for, in whole seconds. The client is returned as the label it is counted with.
+func (rl *RateLimiter) allow(r *http.Request) (string, bool, int) {
+	client := rl.client(r)
+	limiter, found := rl.clients[client]
+	if !found {
+		client, limiter = defaultClient, rl.fallback
+	}
+	if limiter == nil {
+		return client, true, 0
+	}
+	allowed, retryAfter := take(limiter)
+	return client, allowed, retryAfter
+}
+
+// allowAddress reports whether the request is within the limits of the address it was sent from, and otherwise
+// how long it has to wait for, in whole seconds.
+func (rl *RateLimiter) allowAddress(r *http.Request) (bool, int) {
+	return take(rl.addresses.bucket(rl.addresses.address(r)))
+}
+
+// take takes a token from the bucket, or returns how long it has to be waited for, in whole seconds.
+func take(limiter *rate.Limiter) (bool, int) {
+	reservation := limiter.Reserve()
+	if delay := reservation.Delay(); delay > 0 {
+		reservation.Cancel()
+		return false, int(math.Ceil(delay.Seconds()))
+	}
+	return true, 0
+}
+
+// LimitRate rejects the requests of clients over their rate limits with a 429 response.
+func LimitRate(rl *RateLimiter, log *logger.UPPLogger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client, allowed, retryAfter := rl.allow(r)
+			rl.metrics.CountClientRequest(client, !allowed)
+			if !allowed {
+				tid := transactionidutils.GetTransactionIDFromRequest(r)
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				handleError(r, log, tid, "", w, newUnrollError(CodeRateLimited, rl.header, fmt.Errorf("client %s is over its rate limit", client)))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// LimitRateByAddress rejects the requests over the limits of the address they were sent from with a 429 response.
+// It runs before the requests are authenticated, so that the ones which fail to be are limited too.
+func LimitRateByAddress(rl *RateLimiter, log *logger.UPPLogger) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if rl.addresses == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, retryAfter := rl.allowAddress(r)
+			rl.metrics.CountClientRequest(addressClient, !allowed)
+			if !allowed {
+				tid := transactionidutils.GetTransactionIDFromRequest(r)
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				handleError(r, log, tid, "", w, newUnrollError(CodeRateLimited, rl.addresses.header, errors.New("address is over its rate limit")))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package content
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/time/rate"
+)
+
+func TestLoadRateLimitConfig(t *testing.T) {
+	cfg, err := LoadRateLimitConfig("testdata/rate-limits.yaml")
+
+	assert.NoError(t, err)
+	assert.Equal(t, RateLimitConfig{
+		Header:        "X-Api-Key",
+		Default:       &RateLimit{Rate: 5, Burst: 1},
+		Clients:       map[string]ClientRateLimit{"next-article": {RateLimit: RateLimit{Rate: 10, Burst: 2}, Key: "next-article-key"}},
+		PerAddress:    &RateLimit{Rate: 20, Burst: 40},
+		AddressHeader: "X-Forwarded-For",
+	}, cfg)
+}
+
+func TestLoadRateLimitConfig_Invalid(t *testing.T) {
+	tests := map[string]struct {
+		config string
+		err    string
+	}{
+		"key without header":    {"clients:\n  a: {key: k, rate: 1, burst: 1}\n", "client a: key is set but header is not set"},
+		"duplicate key":         {"header: X-Api-Key\nclients:\n  a: {key: k, rate: 1, burst: 1}\n  b: {key: k, rate: 1, burst: 1}\n", "clients a and b have the same key"},
+		"zero rate":             {"header: X-Api-Key\ndefault: {rate: 0, burst: 1}\n", "default: rate must be positive"},
+		"zero burst":            {"header: X-Api-Key\nclients:\n  a: {rate: 1, burst: 0}\n", "client a: burst must be at least 1"},
+		"negative address rate": {"perAddress: {rate: -1, burst: 1}\n", "perAddress: rate must be positive"},
+		"unknown field":         {"header: X-Api-Key\nlimit: 1\n", "field limit not found"},
+		"malformed value":       {"header: X-Api-Key\ndefault: {rate: fast, burst: 1}\n", "decoding rate limits"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rate-limits.yaml")
+			assert.NoError(t, os.WriteFile(path, []byte(test.config), 0o600))
+
+			_, err := LoadRateLimitConfig(path)
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
+
+func TestLimitRate(t *testing.T) {
+	metrics := newMetricsRecorder()
+	rl := NewRateLimiter(RateLimitConfig{
+		Header:  "X-Api-Key",
+		Default: &RateLimit{Rate: 0.001, Burst: 1},
+		Clients: map[string]ClientRateLimit{"next-article": {RateLimit: RateLimit{Rate: 0.001, Burst: 2}, Key: "next-article-key"}},
+	}, metrics)
+	h := LimitRate(rl, logger.NewUPPLogger("test-service", "Error"))(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/content", nil)
+		if key != "" {
+			req.Header.Set("X-Api-Key", key)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusOK, send("next-article-key").Code)
+	assert.Equal(t, http.StatusOK, send("next-article-key").Code)
+	limited := send("next-article-key")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code, "The client should be limited once its burst is used up")
+	assert.Equal(t, "1000", limited.Header().Get("Retry-After"))
+	var p problem
+	assert.NoError(t, json.Unmarshal(limited.Body.Bytes(), &p))
+	assert.Equal(t, CodeRateLimited, p.Code)
+
+	assert.Equal(t, http.StatusOK, send("").Code, "Clients without their own limits should share the default ones")
+	assert.Equal(t, http.StatusTooManyRequests, send("next-article").Code, "Clients should not be told apart by their name in the header")
+
+	assert.Equal(t, []string{"next-article", "next-article", "next-article limited", "default", "default limited"}, metrics.clients)
+}
+
+func TestLimitRate_NoDefault(t *testing.T) {
+	rl := NewRateLimiter(RateLimitConfig{
+		Header:  "X-Api-Key",
+		Clients: map[string]ClientRateLimit{"next-article": {RateLimit: RateLimit{Rate: 0.001, Burst: 1}, Key: "next-article-key"}},
+	}, nil)
+	h := LimitRate(rl, logger.NewUPPLogger("test-service", "Error"))(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/content", nil))
+		assert.Equal(t, http.StatusOK, rec.Code, "Clients without their own limits should not be limited without default ones")
+	}
+}
+
+func TestLimitRate_AuthenticatedClients(t *testing.T) {
+	metrics := newMetricsRecorder()
+	rl := NewRateLimiter(RateLimitConfig{
+		Default: &RateLimit{Rate: 0.001, Burst: 1},
+		Clients: map[string]ClientRateLimit{"next-article": {RateLimit: RateLimit{Rate: 0.001, Burst: 1}}},
+	}, metrics)
+	r := authRouter(NewAuthenticator(AuthConfig{Clients: map[string]Client{
+		"next-article": {Key: "next-article-secret"},
+		"methode":      {Key: "methode-secret"},
+	}}))
+	r.Use(LimitRate(rl, logger.NewUPPLogger("test-service", "Error")))
+
+	send := func(key string) int {
+		req := httptest.NewRequest(http.MethodPost, "/content", nil)
+		req.Header.Set(DefaultKeyHeader, key)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("next-article-secret"))
+	assert.Equal(t, http.StatusTooManyRequests, send("next-article-secret"))
+	assert.Equal(t, http.StatusOK, send("methode-secret"), "Clients without their own limits should share the default ones")
+
+	assert.Equal(t, []string{"next-article", "next-article limited", "default"}, metrics.clients, "Requests should be counted by the name of the client, not by its key")
+}
+
+func TestLimitRateByAddress(t *testing.T) {
+	metrics := newMetricsRecorder()
+	rl := NewRateLimiter(RateLimitConfig{
+		Clients:       map[string]ClientRateLimit{"next-article": {RateLimit: RateLimit{Rate: 100, Burst: 100}}},
+		PerAddress:    &RateLimit{Rate: 0.001, Burst: 2},
+		AddressHeader: "X-Forwarded-For",
+	}, metrics)
+	r := authRouter(NewAuthenticator(AuthConfig{Clients: map[string]Client{"next-article": {Key: "next-article-secret"}}}))
+	r.Use(LimitRate(rl, logger.NewUPPLogger("test-service", "Error")))
+	h := LimitRateByAddress(rl, logger.NewUPPLogger("test-service", "Error"))(r)
+
+	send := func(forwardedFor string, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/content", nil)
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.Header.Set(DefaultKeyHeader, key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, send("203.0.113.7, 10.0.0.1", "guessed").Code)
+	assert.Equal(t, http.StatusUnauthorized, send("198.51.100.1, 10.0.0.1", "guessed").Code)
+	limited := send("10.0.0.1", "next-article-secret")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code, "Requests failing authentication should use up the limits of their address")
+	assert.Equal(t, "1000", limited.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusOK, send("10.0.0.2", "next-article-secret").Code, "Addresses should have their own limits")
+
+	assert.Equal(t, []string{"address", "address", "address limited", "address", "next-article"}, metrics.clients)
+}
+
+func TestLimitRateByAddress_RemoteAddress(t *testing.T) {
+	rl := NewRateLimiter(RateLimitConfig{PerAddress: &RateLimit{Rate: 0.001, Burst: 1}}, nil)
+	h := LimitRateByAddress(rl, logger.NewUPPLogger("test-service", "Error"))(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+
+	send := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodPost, "/content", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "10.0.0.1")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("203.0.113.7:1234"))
+	assert.Equal(t, http.StatusTooManyRequests, send("203.0.113.7:5678"), "Addresses should be told apart without their port")
+	assert.Equal(t, http.StatusOK, send("198.51.100.1:1234"), "The header should not be trusted when it is not set")
+}
+
+func TestAddressLimiter_BoundsBuckets(t *testing.T) {
+	rl := NewRateLimiter(RateLimitConfig{PerAddress: &RateLimit{Rate: 0.001, Burst: 1}}, nil)
+	al := rl.addresses
+	for i := 0; i < maxAddresses; i++ {
+		take(al.bucket(strconv.Itoa(i)))
+	}
+
+	assert.Same(t, al.overflow, al.bucket("new"), "Addresses should share a bucket while all the buckets are in use")
+	assert.Len(t, al.buckets, maxAddresses)
+
+	al.buckets["0"] = rate.NewLimiter(rate.Limit(al.limit.Rate), al.limit.Burst)
+	assert.NotSame(t, al.overflow, al.bucket("new"), "Buckets which filled up again should make room for new addresses")
+	assert.Len(t, al.buckets, maxAddresses)
+}
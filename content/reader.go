@@ -1,14 +1,22 @@
 package content
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	transactionidutils "github.com/Financial-Times/transactionid-utils-go"
 	uuidutils "github.com/Financial-Times/uuid-utils-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -16,20 +24,25 @@ const (
 	userAgentValue = "UPP_content-unroller"
 )
 
-var ErrConnectingToAPI = errors.New("error connecting to API")
+var (
+	ErrConnectingToAPI = errors.New("error connecting to API")
+	ErrUpstreamTimeout = errors.New("timeout while calling API")
+)
 
 type Reader interface {
-	Get([]string, string) (map[string]Content, error)
-	GetInternal([]string, string) (map[string]Content, error)
+	Get(context.Context, []string, string) (map[string]Content, error)
+	GetInternal(context.Context, []string, string) (map[string]Content, error)
 }
 
-type ReaderFunc func([]string, string) (map[string]Content, error)
+type ReaderFunc func(context.Context, []string, string) (map[string]Content, error)
 
 type ReaderConfig struct {
-	ContentStoreAppName         string
-	ContentStoreHost            string
-	ContentPathEndpoint         string
-	InternalContentPathEndpoint string
+	ContentStoreAppName         string `yaml:"appName"`
+	ContentStoreHost            string `yaml:"host"`
+	ContentPathEndpoint         string `yaml:"contentPath"`
+	InternalContentPathEndpoint string `yaml:"internalContentPath"`
+	// Metrics records the reads made from the content store, none are recorded when it is not set.
+	Metrics Metrics `yaml:"-"`
 }
 
 type ContentReader struct {
@@ -38,6 +51,9 @@ type ContentReader struct {
 }
 
 func NewContentReader(rConfig ReaderConfig, client *http.Client) *ContentReader {
+	if rConfig.Metrics == nil {
+		rConfig.Metrics = noopMetrics{}
+	}
 	return &ContentReader{
 		client: client,
 		config: rConfig,
@@ -45,11 +61,11 @@ func NewContentReader(rConfig ReaderConfig, client *http.Client) *ContentReader
 }
 
 // Get reads content from content-public-read
-func (cr *ContentReader) Get(uuids []string, tid string) (map[string]Content, error) {
+func (cr *ContentReader) Get(ctx context.Context, uuids []string, tid string) (map[string]Content, error) {
 	var cm = make(map[string]Content)
 	requestURL := fmt.Sprintf("%s%s", cr.config.ContentStoreHost, cr.config.ContentPathEndpoint)
 
-	contentBatch, err := cr.doGet(uuids, tid, requestURL, cr.config.ContentStoreAppName)
+	contentBatch, err := cr.doGet(ctx, uuids, tid, requestURL, cr.config.ContentPathEndpoint, cr.config.ContentStoreAppName)
 	if err != nil {
 		return cm, err
 	}
@@ -66,7 +82,7 @@ func (cr *ContentReader) Get(uuids []string, tid string) (map[string]Content, er
 		return cm, nil
 	}
 
-	imgModelsList, err := cr.doGet(imgModelUUIDs, tid, requestURL, cr.config.ContentStoreAppName)
+	imgModelsList, err := cr.doGet(ctx, uniqueUUIDs(imgModelUUIDs), tid, requestURL, cr.config.ContentPathEndpoint, cr.config.ContentStoreAppName)
 	if err != nil {
 		return cm, err
 	}
@@ -79,11 +95,11 @@ func (cr *ContentReader) Get(uuids []string, tid string) (map[string]Content, er
 }
 
 // GetInternal reads internal components from content-public-read
-func (cr *ContentReader) GetInternal(uuids []string, tid string) (map[string]Content, error) {
+func (cr *ContentReader) GetInternal(ctx context.Context, uuids []string, tid string) (map[string]Content, error) {
 	var cm = make(map[string]Content)
 	requestURL := fmt.Sprintf("%s%s", cr.config.ContentStoreHost, cr.config.InternalContentPathEndpoint)
 
-	internalContent, err := cr.doGet(uuids, tid, requestURL, cr.config.ContentStoreAppName)
+	internalContent, err := cr.doGet(ctx, uuids, tid, requestURL, cr.config.InternalContentPathEndpoint, cr.config.ContentStoreAppName)
 	if err != nil {
 		return cm, err
 	}
@@ -95,10 +111,16 @@ func (cr *ContentReader) GetInternal(uuids []string, tid string) (map[string]Con
 	return cm, nil
 }
 
-func (cr *ContentReader) doGet(uuids []string, tid string, reqURL string, appName string) ([]Content, error) {
-	var cb []Content
+// doGet reads the uuids from reqURL. The read is recorded with the metrics by target, the path read, and traced
+// as a client span whose trace context is propagated to the content store.
+func (cr *ContentReader) doGet(ctx context.Context, uuids []string, tid string, reqURL string, target string, appName string) (cb []Content, err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "GET "+target,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPRequestMethodKey.String(http.MethodGet), attrUUIDCount.Int(len(uuids))),
+	)
+	defer func() { endSpan(span, err) }()
 
-	req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
 	if err != nil {
 		return cb, errors.Join(ErrConnectingToAPI, err, fmt.Errorf("error creating request to %v", appName))
 	}
@@ -112,11 +134,20 @@ func (cr *ContentReader) doGet(uuids []string, tid string, reqURL string, appNam
 		}
 	}
 	req.URL.RawQuery = q.Encode()
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	start := time.Now()
 	res, err := cr.client.Do(req)
 	if err != nil {
+		if os.IsTimeout(err) {
+			cr.config.Metrics.ObserveUpstream(target, upstreamTimeout, time.Since(start))
+			return cb, errors.Join(ErrConnectingToAPI, ErrUpstreamTimeout, err, fmt.Errorf("request to %v timed out", appName))
+		}
+		cr.config.Metrics.ObserveUpstream(target, upstreamError, time.Since(start))
 		return cb, errors.Join(ErrConnectingToAPI, err, fmt.Errorf("request to %v failed", appName))
 	}
 	defer res.Body.Close()
+	cr.config.Metrics.ObserveUpstream(target, strconv.Itoa(res.StatusCode), time.Since(start))
+	span.SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode))
 
 	if res.StatusCode != http.StatusOK {
 		return cb, errors.Join(ErrConnectingToAPI, fmt.Errorf("request to %v failed with status code %d", appName, res.StatusCode))
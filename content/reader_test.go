@@ -1,6 +1,7 @@
 package content
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -64,7 +66,7 @@ func TestGet(t *testing.T) {
 	err = json.Unmarshal(body, &expected)
 	assert.NoError(t, err, "Cannot read expected response for test case.")
 
-	actual, err := cr.Get(testData, "tid_1")
+	actual, err := cr.Get(context.Background(), testData, "tid_1")
 	assert.NoError(t, err, "Error while getting content data")
 	assert.Equal(t, expected, actual)
 }
@@ -74,7 +76,7 @@ func TestGet_ContentSourceReturns500(t *testing.T) {
 	defer ts.Close()
 
 	cr := readerForTest(ts.URL)
-	_, err := cr.Get(testData, "tid_1")
+	_, err := cr.Get(context.Background(), testData, "tid_1")
 	assert.Error(t, err, "There should an error thrown")
 }
 
@@ -83,22 +85,38 @@ func TestGet_ContentSourceReturns404(t *testing.T) {
 	defer ts.Close()
 
 	cr := readerForTest(ts.URL)
-	_, err := cr.Get(testData, "tid_1")
+	_, err := cr.Get(context.Background(), testData, "tid_1")
 	assert.Error(t, err, "There should an error thrown")
 }
 
 func TestGet_ContentSourceCannotBeResolved(t *testing.T) {
 	cr := readerForTest(unresolvedHostURL)
-	_, err := cr.Get(testData, "tid_1")
+	_, err := cr.Get(context.Background(), testData, "tid_1")
 	assert.Error(t, err, "There should an error thrown")
 }
 
 func TestGet_ContentSourceHasInvalidURL(t *testing.T) {
 	cr := readerForTest(invalidHostURL)
-	_, err := cr.Get(testData, "tid_1")
+	_, err := cr.Get(context.Background(), testData, "tid_1")
 	assert.Error(t, err, "There should an error thrown")
 }
 
+func TestGet_ContentSourceTimesOut(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	}))
+	defer ts.Close()
+
+	cfg := ReaderConfig{
+		ContentStoreAppName: "content-source-app-name",
+		ContentStoreHost:    ts.URL,
+	}
+	cr := NewContentReader(cfg, &http.Client{Timeout: 10 * time.Millisecond})
+	_, err := cr.Get(context.Background(), testData, "tid_1")
+	assert.ErrorIs(t, err, ErrConnectingToAPI)
+	assert.ErrorIs(t, err, ErrUpstreamTimeout)
+}
+
 func TestGetInternal(t *testing.T) {
 	ts := successfulContentServerMock(t, "testdata/internalcontent-source-valid-response.json")
 	defer ts.Close()
@@ -111,7 +129,7 @@ func TestGetInternal(t *testing.T) {
 	err = json.Unmarshal(body, &expected)
 	assert.NoError(t, err, "Cannot read expected response for test case.")
 
-	actual, err := cr.GetInternal(testData, "tid_1")
+	actual, err := cr.GetInternal(context.Background(), testData, "tid_1")
 	assert.NoError(t, err, "Error while getting content data")
 	assert.Equal(t, expected, actual)
 }
@@ -121,7 +139,7 @@ func TestGetInternal_ContentSourceReturns500(t *testing.T) {
 	defer ts.Close()
 
 	cr := readerForTest(ts.URL)
-	_, err := cr.GetInternal(testData, "tid_1")
+	_, err := cr.GetInternal(context.Background(), testData, "tid_1")
 	assert.Error(t, err, "There should an error thrown")
 }
 
@@ -130,18 +148,18 @@ func TestGetInternal_ContentSourceReturns404(t *testing.T) {
 	defer ts.Close()
 
 	cr := readerForTest(ts.URL)
-	_, err := cr.GetInternal(testData, "tid_1")
+	_, err := cr.GetInternal(context.Background(), testData, "tid_1")
 	assert.Error(t, err, "There should an error thrown")
 }
 
 func TestGetInternal_ContentSourceCannotBeResolved(t *testing.T) {
 	cr := readerForTest(unresolvedHostURL)
-	_, err := cr.GetInternal(testData, "tid_1")
+	_, err := cr.GetInternal(context.Background(), testData, "tid_1")
 	assert.Error(t, err, "There should an error thrown")
 }
 
 func TestGetInternal_ContentSourceHasInvalidURL(t *testing.T) {
 	cr := readerForTest(invalidHostURL)
-	_, err := cr.GetInternal(testData, "tid_1")
+	_, err := cr.GetInternal(context.Background(), testData, "tid_1")
 	assert.Error(t, err, "There should an error thrown")
 }
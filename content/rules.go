@@ -0,0 +1,202 @@
+package content
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// How related content is read from the content store.
+const (
+	ResolvePublic   = "public"
+	ResolveInternal = "internal"
+)
+
+// ReferenceRule declares where content references related content, and how the related content is expanded.
+type ReferenceRule struct {
+	// Field is the path of the objects referencing related content by their id, e.g. mainImage or
+	// alternativeImages.promotionalImage, where a [] suffix selects every object of an array, e.g. leadImages[].
+	// For content embedded in the body, it is the field the expanded content is set in.
+	Field string `yaml:"field"`
+	// EmbeddedTypes are the types of the content embedded in the bodyXML which is expanded, by URI or by name,
+	// e.g. ImageSet. The references are found in the body instead of the field when they are set.
+	EmbeddedTypes []string `yaml:"embeddedTypes"`
+	// Into is the field of the referencing object the related content is set in. The referencing object is replaced
+	// by the related content when it is not set.
+	Into string `yaml:"into"`
+	// Resolve is public or internal, for reading the related content from the public or the internal content
+	// endpoint. Defaults to public.
+	Resolve string `yaml:"resolve"`
+	// ExpandSets expands the members of the related image sets and clip sets, and the posters of their members.
+	ExpandSets bool `yaml:"expandSets"`
+	// Optional skips the referencing objects without an id, instead of failing the request.
+	Optional bool `yaml:"optional"`
+	// KeepMissing leaves the referencing object as it is when the related content is missing, instead of replacing
+	// it with the id of the related content.
+	KeepMissing bool `yaml:"keepMissing"`
+	// SkipFailedReads leaves the referencing objects as they are when reading the related content fails in the
+	// default mode, instead of failing the request.
+	SkipFailedReads bool `yaml:"skipFailedReads"`
+}
+
+// resolve returns how the related content is read.
+func (rule ReferenceRule) resolve() string {
+	if rule.Resolve == "" {
+		return ResolvePublic
+	}
+	return rule.Resolve
+}
+
+func (rule ReferenceRule) embedded() bool {
+	return len(rule.EmbeddedTypes) > 0
+}
+
+// planField returns the field the references are listed under in plans, e.g. leadImages for leadImages[].
+func (rule ReferenceRule) planField() string {
+	return strings.ReplaceAll(rule.Field, "[]", "")
+}
+
+// ContentRules declares the references expanded in the content of some types.
+type ContentRules struct {
+	// Types are the content types the rules apply to, by URI or by name, e.g. Article. Rules without types apply to
+	// the content of the types without their own rules.
+	Types []string `yaml:"types"`
+	// Required are the fields the content must have at least one of to be unrolled. Any content is unrolled when
+	// none are set.
+	Required   []string        `yaml:"required"`
+	References []ReferenceRule `yaml:"references"`
+}
+
+// accepts reports whether the content has one of the required fields.
+func (cr ContentRules) accepts(c Content) bool {
+	return len(cr.Required) == 0 || slices.ContainsFunc(cr.Required, func(field string) bool {
+		_, found := c[field]
+		return found
+	})
+}
+
+// Rules declares the references expanded by the default unrollers, by view. Image sets, clip sets and clips are
+// unrolled by their own unrollers and are not covered by the rules.
+type Rules struct {
+	Content         []ContentRules `yaml:"content"`
+	InternalContent []ContentRules `yaml:"internalcontent"`
+}
+
+// DefaultRules returns the rules applied when no rules file is set.
+func DefaultRules() Rules {
+	return Rules{
+		Content: []ContentRules{{
+			Required: []string{mainImageField, bodyXMLField, altImagesField},
+			References: []ReferenceRule{
+				{Field: mainImageField, ExpandSets: true},
+				{Field: embeds, EmbeddedTypes: []string{ImageSetType, DynamicContentType, ClipSetType}, ExpandSets: true},
+				// the promotional image is kept as it is when it can't be expanded
+				{Field: joinPath(altImagesField, promotionalImage), Optional: true, KeepMissing: true},
+			},
+		}},
+		InternalContent: []ContentRules{{
+			Required: []string{leadImages, bodyXMLField},
+			References: []ReferenceRule{
+				{Field: leadImages + "[]", Into: image, SkipFailedReads: true},
+				{Field: embeds, EmbeddedTypes: []string{DynamicContentType}, Resolve: ResolveInternal, SkipFailedReads: true},
+			},
+		}},
+	}
+}
+
+// LoadRules reads and validates the rules from a YAML or JSON file.
+func LoadRules(path string) (Rules, error) {
+	var rules Rules
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rules, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&rules); err != nil {
+		return rules, fmt.Errorf("decoding expansion rules from %s: %w", path, err)
+	}
+	rules.normalize()
+	if err := rules.validate(); err != nil {
+		return rules, fmt.Errorf("invalid expansion rules in %s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// normalize replaces the names of the types with their URIs.
+func (r Rules) normalize() {
+	for _, view := range [][]ContentRules{r.Content, r.InternalContent} {
+		for i := range view {
+			normalizeTypes(view[i].Types)
+			for j := range view[i].References {
+				normalizeTypes(view[i].References[j].EmbeddedTypes)
+			}
+		}
+	}
+}
+
+func normalizeTypes(types []string) {
+	for i, t := range types {
+		if !strings.Contains(t, "/") {
+			types[i] = ontologyTypePrefix + "content/" + t
+		}
+	}
+}
+
+func (r Rules) validate() error {
+	for view, rules := range map[View][]ContentRules{PublicView: r.Content, InternalView: r.InternalContent} {
+		for i, cr := range rules {
+			for j, rule := range cr.References {
+				if err := rule.validate(); err != nil {
+					return fmt.Errorf("%s[%d].references[%d]: %w", view, i, j, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (rule ReferenceRule) validate() error {
+	switch {
+	case rule.Field == "":
+		return errors.New("field is not set")
+	case rule.resolve() != ResolvePublic && rule.resolve() != ResolveInternal:
+		return fmt.Errorf("resolve must be %s or %s, got %q", ResolvePublic, ResolveInternal, rule.Resolve)
+	case rule.ExpandSets && rule.resolve() != ResolvePublic:
+		return errors.New("sets can only be expanded from public content")
+	case rule.embedded() && (rule.Into != "" || strings.ContainsAny(rule.Field, ".[]")):
+		return errors.New("embedded content is set in a top level field")
+	}
+	for _, segment := range strings.Split(rule.Field, ".") {
+		if name := strings.TrimSuffix(segment, "[]"); name == "" || strings.ContainsAny(name, "[]") {
+			return fmt.Errorf("invalid field %q", rule.Field)
+		}
+	}
+	return nil
+}
+
+// match returns the rules for the type of the content, or the rules for any type.
+func match(rules []ContentRules, c Content) (ContentRules, bool) {
+	contentType := getEventType(c)
+	var fallback *ContentRules
+	for i := range rules {
+		if len(rules[i].Types) == 0 {
+			if fallback == nil {
+				fallback = &rules[i]
+			}
+			continue
+		}
+		if slices.Contains(rules[i].Types, contentType) {
+			return rules[i], true
+		}
+	}
+	if fallback != nil {
+		return *fallback, true
+	}
+	return ContentRules{}, false
+}
@@ -0,0 +1,136 @@
+package content
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadRules(t *testing.T) {
+	rules, err := LoadRules("testdata/rules.yaml")
+
+	assert.NoError(t, err)
+	assert.Equal(t, Rules{Content: []ContentRules{
+		{
+			Types:    []string{ArticleType},
+			Required: []string{mainImageField, "topper"},
+			References: []ReferenceRule{
+				{Field: mainImageField, ExpandSets: true},
+				{Field: "topper.images[]", Into: image},
+			},
+		},
+		{
+			Types: []string{"http://www.ft.com/ontology/content/Video"},
+			References: []ReferenceRule{
+				{Field: embeds, EmbeddedTypes: []string{DynamicContentType}, Resolve: ResolveInternal},
+			},
+		},
+	}}, rules)
+}
+
+func TestLoadRules_Invalid(t *testing.T) {
+	tests := map[string]struct {
+		rules string
+		err   string
+	}{
+		"missing field":     {"content:\n  - references:\n      - into: image\n", "content[0].references[0]: field is not set"},
+		"unknown resolve":   {"internalcontent:\n  - references:\n      - field: a\n        resolve: draft\n", `resolve must be public or internal, got "draft"`},
+		"internal sets":     {"content:\n  - references:\n      - field: a\n        resolve: internal\n        expandSets: true\n", "sets can only be expanded from public content"},
+		"nested embeds":     {"content:\n  - references:\n      - field: a.b\n        embeddedTypes: [ImageSet]\n", "embedded content is set in a top level field"},
+		"malformed field":   {"content:\n  - references:\n      - field: a..b\n", `invalid field "a..b"`},
+		"unknown key":       {"content:\n  - references:\n      - path: a\n", "field path not found"},
+		"malformed content": {"content: mainImage\n", "decoding expansion rules"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.yaml")
+			assert.NoError(t, os.WriteFile(path, []byte(test.rules), 0o600))
+
+			_, err := LoadRules(path)
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	article := ContentRules{Types: []string{ArticleType}, Required: []string{"topper"}}
+	fallback := ContentRules{Required: []string{bodyXMLField}}
+
+	cr, found := match([]ContentRules{fallback, article}, Content{typeField: ArticleType})
+	assert.True(t, found)
+	assert.Equal(t, article, cr, "The rules of the type should be preferred to the ones without types")
+
+	cr, found = match([]ContentRules{fallback, article}, Content{typesField: []interface{}{ClipType}})
+	assert.True(t, found)
+	assert.Equal(t, fallback, cr)
+
+	_, found = match([]ContentRules{article}, Content{typeField: ClipType})
+	assert.False(t, found)
+}
+
+func TestUnrollContent_WithRules(t *testing.T) {
+	const (
+		imageUUID   = "639cd952-149f-11e7-2ea7-a07ecd9ac73f"
+		topperUUID  = "71231d3a-13c7-11e7-2ea7-a07ecd9ac73f"
+		missingUUID = "0261ea4a-1474-11e7-1e92-847abda1ac65"
+	)
+	rules, err := LoadRules("testdata/rules.yaml")
+	assert.NoError(t, err)
+
+	var mu sync.Mutex
+	var reads [][]string
+	reader := &ReaderMock{
+		mockGet: func(uuids []string, _ string) (map[string]Content, error) {
+			mu.Lock()
+			reads = append(reads, uuids)
+			mu.Unlock()
+			return map[string]Content{
+				imageUUID:  {id: "http://www.ft.com/thing/" + imageUUID, typeField: "http://www.ft.com/ontology/content/Image"},
+				topperUUID: {id: "http://www.ft.com/thing/" + topperUUID, "binaryUrl": "https://example.com/topper.jpg"},
+			}, nil
+		},
+	}
+	u := NewUniversalUnroller(reader, logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com", WithRules(rules))
+
+	c := Content{
+		typeField:      ArticleType,
+		mainImageField: map[string]interface{}{id: "http://www.ft.com/thing/" + imageUUID},
+		"topper": map[string]interface{}{
+			"images": []interface{}{
+				map[string]interface{}{id: "http://www.ft.com/thing/" + topperUUID, typeField: "wide"},
+				map[string]interface{}{id: "http://www.ft.com/thing/" + missingUUID},
+			},
+		},
+	}
+	state := newUnrollState(Limits{})
+	actual, err := u.UnrollContent(withUnrollState(context.Background(), state), UnrollEvent{c, "tid_sample", "sample_uuid"})
+
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, [][]string{{imageUUID}, {topperUUID, missingUUID}}, reads)
+	assert.Equal(t, Content{id: "http://www.ft.com/thing/" + imageUUID, typeField: "http://www.ft.com/ontology/content/Image"}, actual[mainImageField])
+	assert.Equal(t, []Content{
+		{id: "http://www.ft.com/thing/" + topperUUID, typeField: "wide", image: Content{id: "http://www.ft.com/thing/" + topperUUID, "binaryUrl": "https://example.com/topper.jpg"}},
+		{id: "http://www.ft.com/thing/" + missingUUID},
+	}, actual["topper"].(map[string]interface{})["images"])
+	assert.Equal(t, []referenceDiagnostic{
+		{Field: "topper.images[1]", UUID: missingUUID, Status: referenceMissing},
+	}, state.brokenReferences())
+	assert.NotContains(t, c["topper"].(map[string]interface{})["images"].([]interface{})[0], image, "Input content should not be changed")
+
+	p, err := u.PlanContent(UnrollEvent{c, "tid_sample", "sample_uuid"})
+	assert.NoError(t, err)
+	assert.Equal(t, []PlanGroup{
+		{Field: mainImageField, UUIDs: []string{imageUUID}},
+		{Field: "topper.images", UUIDs: []string{topperUUID, missingUUID}},
+	}, p.References)
+
+	_, err = u.UnrollContent(context.Background(), UnrollEvent{Content{typeField: ArticleType, bodyXMLField: "<body/>"}, "tid_sample", "sample_uuid"})
+	assert.ErrorIs(t, err, ErrValidating, "Content without the required fields should be invalid")
+	_, err = u.UnrollContent(context.Background(), UnrollEvent{Content{typeField: "http://www.ft.com/ontology/content/Audio", mainImageField: map[string]interface{}{}}, "tid_sample", "sample_uuid"})
+	assert.ErrorIs(t, err, ErrValidating, "Content of types without rules should be invalid")
+}
@@ -1,6 +1,7 @@
 package content
 
 import (
+	"context"
 	"errors"
 	"slices"
 
@@ -8,6 +9,7 @@ import (
 )
 
 const (
+	ontologyTypePrefix = "http://www.ft.com/ontology/"
 	ImageSetType       = "http://www.ft.com/ontology/content/ImageSet"
 	DynamicContentType = "http://www.ft.com/ontology/content/DynamicContent"
 	ClipSetType        = "http://www.ft.com/ontology/content/ClipSet"
@@ -27,6 +29,11 @@ const (
 	typeField          = "type"
 	typesField         = "types"
 	apiURLField        = "apiUrl"
+	binaryURLField     = "binaryUrl"
+	pixelWidthField    = "pixelWidth"
+	pixelHeightField   = "pixelHeight"
+	dataSourceField    = "dataSource"
+	containsField      = "contains"
 )
 
 var (
@@ -38,38 +45,80 @@ type UniversalUnroller struct {
 	reader  Reader
 	log     *logger.UPPLogger
 	apiHost string
+	rules   Rules
 }
 
-func NewUniversalUnroller(r Reader, log *logger.UPPLogger, apiHost string) *UniversalUnroller {
-	return &UniversalUnroller{
+// UnrollerOption configures optional behaviour of a UniversalUnroller.
+type UnrollerOption func(*UniversalUnroller)
+
+// WithRules expands the references declared by the rules instead of the default ones. The default rules are kept
+// for the views without rules.
+func WithRules(rules Rules) UnrollerOption {
+	return func(u *UniversalUnroller) {
+		u.rules = rules
+	}
+}
+
+func NewUniversalUnroller(r Reader, log *logger.UPPLogger, apiHost string, opts ...UnrollerOption) *UniversalUnroller {
+	u := &UniversalUnroller{
 		reader:  r,
 		log:     log,
 		apiHost: apiHost,
 	}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
+}
+
+func (u *UniversalUnroller) defaultUnroller() *DefaultUnroller {
+	du := NewDefaultUnroller(u.reader, u.log, u.apiHost)
+	du.rules = u.rules.Content
+	return du
+}
+
+func (u *UniversalUnroller) defaultInternalUnroller() *DefaultInternalUnroller {
+	du := NewDefaultInternalUnroller(u.reader, u.log, u.apiHost)
+	du.rules = u.rules.InternalContent
+	return du
 }
 
-func (u *UniversalUnroller) UnrollContent(event UnrollEvent) (Content, error) {
-	defaultUnroller := NewDefaultUnroller(u.reader, u.log, u.apiHost)
+func (u *UniversalUnroller) UnrollContent(ctx context.Context, event UnrollEvent) (Content, error) {
+	ctx = ensureUnrollState(ctx)
+	defaultUnroller := u.defaultUnroller()
 
+	var res Content
+	var err error
 	switch getEventType(event.c) {
 	case ClipSetType:
-		return u.unrollClipSet(event)
+		res, err = u.unrollClipSet(ctx, event)
 	case ClipType:
-		return u.unrollClip(event)
+		res, err = u.unrollClip(ctx, event)
 	case ImageSetType:
-		return u.unrollImageSet(event)
+		res, err = u.unrollImageSet(ctx, event)
 	default:
-		return defaultUnroller.Unroll(event)
+		res, err = defaultUnroller.Unroll(ctx, event)
 	}
+	if err != nil {
+		return res, err
+	}
+	return res, unrollStateFrom(ctx).checkMode()
 }
 
-func (u *UniversalUnroller) UnrollInternalContent(event UnrollEvent) (Content, error) {
-	defaultInternalUnroller := NewDefaultInternalUnroller(u.reader, u.log, u.apiHost)
+func (u *UniversalUnroller) UnrollInternalContent(ctx context.Context, event UnrollEvent) (Content, error) {
+	ctx = ensureUnrollState(ctx)
+	defaultInternalUnroller := u.defaultInternalUnroller()
 
+	var res Content
+	var err error
 	switch getEventType(event.c) {
 	default:
-		return defaultInternalUnroller.Unroll(event)
+		res, err = defaultInternalUnroller.Unroll(ctx, event)
 	}
+	if err != nil {
+		return res, err
+	}
+	return res, unrollStateFrom(ctx).checkMode()
 }
 
 type Content map[string]interface{}
@@ -82,29 +131,71 @@ func (c Content) clone() Content {
 	return clone
 }
 
+// deepClone copies the content together with all nested objects and arrays, so that the copy can be changed
+// without affecting the original.
+func (c Content) deepClone() Content {
+	if c == nil {
+		return nil
+	}
+	return deepCopy(c).(Content)
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch val := v.(type) {
+	case Content:
+		clone := make(Content, len(val))
+		for k, nested := range val {
+			clone[k] = deepCopy(nested)
+		}
+		return clone
+	case map[string]interface{}:
+		clone := make(map[string]interface{}, len(val))
+		for k, nested := range val {
+			clone[k] = deepCopy(nested)
+		}
+		return clone
+	case []interface{}:
+		clone := make([]interface{}, len(val))
+		for i, nested := range val {
+			clone[i] = deepCopy(nested)
+		}
+		return clone
+	case []Content:
+		clone := make([]Content, len(val))
+		for i, nested := range val {
+			clone[i] = nested.deepClone()
+		}
+		return clone
+	default:
+		return val
+	}
+}
+
+// copyContentMap returns a new map holding the same content, so that entries can be replaced without
+// changing a map shared with the reader.
+func copyContentMap(src map[string]Content) map[string]Content {
+	dest := make(map[string]Content, len(src))
+	for k, v := range src {
+		dest[k] = v
+	}
+	return dest
+}
+
 func (c Content) getMembersUUID() []string {
 	uuids := []string{}
-	members, found := c[membersField]
-	if !found {
+	members := c.field(membersField)
+	if !members.exists() {
 		return uuids
 	}
 
-	memList, ok := members.([]interface{})
-	if !ok {
-		return uuids
-	}
-	for _, m := range memList {
-		mData := m.(map[string]interface{})
-		url, found := mData[id].(string)
-		if !found {
-			continue
-		}
-		u, err := extractUUIDFromString(url)
+	members.each(func(_ int, m value) error {
+		u, err := m.field(id).uuid()
 		if err != nil {
-			continue
+			return nil
 		}
 		uuids = append(uuids, u)
-	}
+		return nil
+	})
 	return uuids
 }
 
@@ -114,139 +205,116 @@ func (c Content) merge(src Content) {
 	}
 }
 
-// Schema is a map containing UUIDs of related content and the name of the field they are used in.
-type Schema map[string][]string
-
-func (u Schema) put(key string, value string) {
-	if key != mainImageField && key != promotionalImage && key != leadImages {
-		return
-	}
-	prev, found := u[key]
-	if !found {
-		u[key] = []string{value}
-		return
-	}
-	act := append(prev, value)
-	u[key] = act
+// schemaRef is a place in the content where a related UUID is used.
+type schemaRef struct {
+	uuid string
+	rule *ReferenceRule
+	// path is where the reference is found in the content, e.g. embeds[2].
+	path string
+	// holder is the object holding the reference, nil for the content embedded in the body.
+	holder Content
+	// place sets the related content in the place of the reference.
+	place func(Content)
 }
 
-func (u Schema) get(key string) string {
-	if _, found := u[key]; key != mainImageField && key != promotionalImage || !found {
-		return ""
-	}
-	return u[key][0]
+// Schema tracks the unique UUIDs of related content together with every place they are used in,
+// so that each UUID is read once and the result is fanned out to all the places needing it.
+type Schema struct {
+	uuids []string
+	refs  []schemaRef
+	seen  map[string]bool
 }
 
-func (u Schema) putAll(key string, values []string) {
-	if key != embeds && key != leadImages {
-		return
-	}
-	prevValue, found := u[key]
-	if !found {
-		u[key] = values
-		return
-	}
-	u[key] = append(prevValue, values...)
+func newSchema() *Schema {
+	return &Schema{seen: map[string]bool{}}
 }
 
-func (u Schema) getAll(key string) []string {
-	if key != embeds && key != leadImages {
-		return []string{}
+func (u *Schema) add(uuid string, ref schemaRef) {
+	if !u.seen[uuid] {
+		u.seen[uuid] = true
+		u.uuids = append(u.uuids, uuid)
 	}
-	return u[key]
+	ref.uuid = uuid
+	u.refs = append(u.refs, ref)
 }
 
-func (u Schema) toArray() (UUIDs []string) {
-	for _, v := range u {
-		UUIDs = append(UUIDs, v...)
+// refsTo returns every place the UUID is used in, in the order they were found.
+func (u *Schema) refsTo(uuid string) []schemaRef {
+	var refs []schemaRef
+	for _, ref := range u.refs {
+		if ref.uuid == uuid {
+			refs = append(refs, ref)
+		}
 	}
-	return UUIDs
+	return refs
 }
 
-func fromMap(src map[string]interface{}) Content {
-	dest := Content{}
-	for k, v := range src {
-		dest[k] = v
+// setUUIDs returns the UUIDs used by rules expanding sets, leaving out the ones cut off.
+func (u *Schema) setUUIDs(uuids []string, cutoffs map[string]string) []string {
+	var setUUIDs []string
+	for _, uuid := range uuids {
+		_, isCut := cutoffs[uuid]
+		if !isCut && slices.ContainsFunc(u.refsTo(uuid), func(ref schemaRef) bool { return ref.rule.ExpandSets }) {
+			setUUIDs = append(setUUIDs, uuid)
+		}
 	}
-	return dest
+	return setUUIDs
 }
 
-func unrollLeadImages(cc Content, r Reader, log *logger.UPPLogger, tid string, uuid string) ([]Content, bool) {
-	localLog := log.WithTransactionID(tid).WithUUID(uuid)
-
-	images, foundLeadImages := cc[leadImages].([]interface{})
-	if !foundLeadImages {
-		localLog.Debug("No lead images to expand for supplied content")
-		return nil, false
-	}
+// schemaBatch is a group of related UUIDs read from the content store in a single call.
+type schemaBatch struct {
+	rule    *ReferenceRule
+	resolve string
+	uuids   []string
+}
 
-	if len(images) == 0 {
-		localLog.Debug("No lead images to expand for supplied content")
-		return nil, false
-	}
-	schema := make(Schema)
-	for _, item := range images {
-		li := item.(map[string]interface{})
-		uuid, err := extractUUIDFromString(li[id].(string))
-		if err != nil {
-			localLog.WithError(err).Errorf("Error while getting UUID for %s: %v", li[id].(string), err.Error())
+// batches groups the unique UUIDs by the rule using them first, so that the references of different rules are read
+// at the same time. UUIDs used by several rules are read once for every endpoint they are read from.
+func (u *Schema) batches() []schemaBatch {
+	var batches []schemaBatch
+	byRule := map[*ReferenceRule]int{}
+	read := map[[2]string]bool{}
+	for _, ref := range u.refs {
+		key := [2]string{ref.rule.resolve(), ref.uuid}
+		if read[key] {
 			continue
 		}
-		li[image] = uuid
-		schema.put(leadImages, uuid)
-	}
-
-	imgMap, err := r.Get(schema.toArray(), tid)
-	if err != nil {
-		localLog.WithError(err).Errorf("Error while getting content for expanded images %s", err.Error())
-
-		// couldn't get the images so we have to delete the additional uuid field (previously added)
-		for _, li := range images {
-			rawLi := li.(map[string]interface{})
-			delete(rawLi, image)
-		}
-
-		return nil, false
-	}
-
-	var expLeadImages []Content
-	for _, li := range images {
-		rawLi := li.(map[string]interface{})
-		rawLiUUID := rawLi[image].(string)
-		liContent := fromMap(rawLi)
-		imageData, found := resolveContent(rawLiUUID, imgMap)
+		read[key] = true
+		i, found := byRule[ref.rule]
 		if !found {
-			localLog.Debugf("Missing image model %s. Returning only the id.", rawLiUUID)
-			delete(liContent, image)
-			expLeadImages = append(expLeadImages, liContent)
-			continue
+			i = len(batches)
+			byRule[ref.rule] = i
+			batches = append(batches, schemaBatch{rule: ref.rule, resolve: ref.rule.resolve()})
 		}
-		liContent[image] = imageData
-		expLeadImages = append(expLeadImages, liContent)
+		batches[i].uuids = append(batches[i].uuids, ref.uuid)
 	}
-
-	cc[leadImages] = expLeadImages
-	return expLeadImages, true
+	return batches
 }
 
-func unrollDynamicContent(cc Content, log *logger.UPPLogger, tid string, uuid string, getContentFromSourceFn ReaderFunc) ([]Content, bool) {
-	emContentUUIDs, foundEmbedded := extractEmbeddedContentByType(cc, log, []string{DynamicContentType}, tid, uuid)
-	if !foundEmbedded {
-		return nil, false
-	}
+// toArray returns every UUID in the schema once, in the order they were first put in it.
+func (u *Schema) toArray() []string {
+	return u.uuids
+}
 
-	contentMap, err := getContentFromSourceFn(emContentUUIDs, tid)
-	if err != nil {
-		log.WithError(err).WithTransactionID(tid).WithUUID(uuid).Errorf(tid, "Error while getting embedded dynamic content %s", err.Error())
-		return nil, false
+// uniqueUUIDs returns the UUIDs without duplicates, keeping the order they were first found in.
+func uniqueUUIDs(uuids []string) []string {
+	seen := make(map[string]bool, len(uuids))
+	unique := make([]string, 0, len(uuids))
+	for _, uuid := range uuids {
+		if !seen[uuid] {
+			seen[uuid] = true
+			unique = append(unique, uuid)
+		}
 	}
+	return unique
+}
 
-	var embedded []Content
-	for _, ec := range emContentUUIDs {
-		embedded = append(embedded, contentMap[ec])
+func fromMap(src map[string]interface{}) Content {
+	dest := Content{}
+	for k, v := range src {
+		dest[k] = v
 	}
-
-	return embedded, true
+	return dest
 }
 
 func resolveContent(uuid string, imgMap map[string]Content) (Content, bool) {
@@ -257,44 +325,25 @@ func resolveContent(uuid string, imgMap map[string]Content) (Content, bool) {
 	return c, true
 }
 
-func extractEmbeddedContentByType(cc Content, log *logger.UPPLogger, acceptedTypes []string, tid string, uuid string) ([]string, bool) {
+func extractEmbeddedContentByType(article Article, log *logger.UPPLogger, acceptedTypes []string, tid string, uuid string) ([]Embed, bool) {
 	localLog := log.WithTransactionID(tid).WithUUID(uuid)
 
-	body, foundBody := cc[bodyXMLField]
-	if !foundBody {
+	if article.BodyXML == "" {
 		localLog.Debug("Missing body. Skipping expanding embedded content and images.")
 		return nil, false
 	}
 
-	bodyXML := body.(string)
-	emContentUUIDs, err := getEmbedded(log, bodyXML, acceptedTypes, tid, uuid)
+	emContent, err := getEmbedded(log, article.BodyXML, acceptedTypes, tid, uuid)
 	if err != nil {
 		localLog.WithError(err).Errorf("Cannot parse bodyXML for content %s", err.Error())
 		return nil, false
 	}
 
-	if len(emContentUUIDs) == 0 {
+	if len(emContent) == 0 {
 		return nil, false
 	}
 
-	return emContentUUIDs, true
-}
-
-func extractMainImageContentByType(cc Content, log *logger.UPPLogger, tid string, uuid string) (string, bool) {
-	localLog := log.WithTransactionID(tid).WithUUID(uuid)
-	mi, foundMainImg := cc[mainImageField].(map[string]interface{})
-	if foundMainImg {
-		u, err := extractUUIDFromString(mi[id].(string))
-		if err != nil {
-			localLog.WithError(err).Errorf("Cannot find main image: %v. Skipping expanding main image", err.Error())
-			foundMainImg = false
-		} else {
-			return u, foundMainImg
-		}
-	} else {
-		localLog.Debug(tid, uuid, "Cannot find main image. Skipping expanding main image")
-	}
-	return "", foundMainImg
+	return emContent, true
 }
 
 func checkType(content Content, wantedType string) bool {
@@ -310,7 +359,8 @@ func checkType(content Content, wantedType string) bool {
 func getEventType(content Content) string {
 	if contentTypes, ok := content[typesField].([]interface{}); ok {
 		if len(contentTypes) > 0 {
-			return contentTypes[0].(string)
+			t, _ := content.field(typesField).index(0).str()
+			return t
 		}
 		return ""
 	}
@@ -1,6 +1,7 @@
 package content
 
 import (
+	"context"
 	"encoding/json"
 	"os"
 	"testing"
@@ -19,11 +20,11 @@ type ReaderMock struct {
 	mockGetInternal func(uuids []string, tid string) (map[string]Content, error)
 }
 
-func (rm *ReaderMock) Get(c []string, tid string) (map[string]Content, error) {
+func (rm *ReaderMock) Get(_ context.Context, c []string, tid string) (map[string]Content, error) {
 	return rm.mockGet(c, tid)
 }
 
-func (rm *ReaderMock) GetInternal(c []string, tid string) (map[string]Content, error) {
+func (rm *ReaderMock) GetInternal(_ context.Context, c []string, tid string) (map[string]Content, error) {
 	return rm.mockGetInternal(c, tid)
 }
 
@@ -53,7 +54,7 @@ func TestUnrollContent_ClipSet(t *testing.T) {
 	err = json.Unmarshal(fileBytes, &c)
 	assert.NoError(t, err, "Cannot build json body")
 	req := UnrollEvent{c, "tid_sample", "sample_uuid"}
-	actual, err := unroller.UnrollContent(req)
+	actual, err := unroller.UnrollContent(context.Background(), req)
 	assert.NoError(t, err, "Should not get an error when expanding clipset")
 
 	actualJSON, err := json.Marshal(actual)
@@ -193,7 +194,7 @@ func TestUnrollContent_LiveBlogPackage(t *testing.T) {
 	err = json.Unmarshal(fileBytes, &c)
 	assert.NoError(t, err, "Cannot build json body")
 	req := UnrollEvent{c, "tid_sample", "sample_uuid"}
-	actual, err := unroller.UnrollContent(req)
+	actual, err := unroller.UnrollContent(context.Background(), req)
 	assert.NoError(t, err, "Should not get an error when expanding clipset")
 
 	actualJSON, err := json.Marshal(actual)
@@ -228,7 +229,7 @@ func TestUnrollContent_ContentPackage(t *testing.T) {
 	err = json.Unmarshal(fileBytes, &c)
 	assert.NoError(t, err, "Cannot build json body")
 	req := UnrollEvent{c, "tid_sample", "sample_uuid"}
-	actual, err := unroller.UnrollInternalContent(req)
+	actual, err := unroller.UnrollInternalContent(context.Background(), req)
 	assert.NoError(t, err, "Should not get an error when expanding clipset")
 
 	actualJSON, err := json.Marshal(actual)
@@ -263,7 +264,7 @@ func TestUnrollContent_article_with_empty_ImageSet_members_should_be_not_null(t
 	err = json.Unmarshal(fileBytes, &c)
 	assert.NoError(t, err, "Cannot build json body")
 	req := UnrollEvent{c, "tid_sample", "sample_uuid"}
-	actual, err := unroller.UnrollContent(req)
+	actual, err := unroller.UnrollContent(context.Background(), req)
 	assert.NoError(t, err, "Should not get an error when expanding clipset")
 
 	actualJSON, err := json.Marshal(actual)
@@ -298,10 +299,62 @@ func TestUnrollContent_article_with_empty_ClipSet_members_should_be_not_null(t *
 	err = json.Unmarshal(fileBytes, &c)
 	assert.NoError(t, err, "Cannot build json body")
 	req := UnrollEvent{c, "tid_sample", "sample_uuid"}
-	actual, err := unroller.UnrollContent(req)
+	actual, err := unroller.UnrollContent(context.Background(), req)
 	assert.NoError(t, err, "Should not get an error when expanding clipset")
 
 	actualJSON, err := json.Marshal(actual)
 	assert.NoError(t, err, "Expected to marshall correctly")
 	assert.JSONEq(t, string(expected), string(actualJSON))
 }
+
+func TestContent_deepClone(t *testing.T) {
+	original := Content{
+		id: "http://www.ft.com/thing/22c0d426-1466-11e7-b0c1-37e417ee6c76",
+		mainImageField: map[string]interface{}{
+			id: "http://api.ft.com/content/639cd952-149f-11e7-2ea7-a07ecd9ac73f",
+		},
+		leadImages: []interface{}{
+			map[string]interface{}{id: "http://api.ft.com/content/89f194c8-13bc-11e7-80f4-13e067d5072c"},
+		},
+		membersField: []Content{{id: "http://api.ft.com/content/d6c3a1d6-9b08-11e7-8cf8-1a0da58f8a2a"}},
+	}
+
+	clone := original.deepClone()
+	assert.Equal(t, original, clone)
+
+	clone[mainImageField].(map[string]interface{})[id] = "changed"
+	clone[leadImages].([]interface{})[0].(map[string]interface{})[image] = "changed"
+	clone[membersField].([]Content)[0][id] = "changed"
+
+	assert.Equal(t, "http://api.ft.com/content/639cd952-149f-11e7-2ea7-a07ecd9ac73f", original[mainImageField].(map[string]interface{})[id])
+	assert.NotContains(t, original[leadImages].([]interface{})[0], image)
+	assert.Equal(t, "http://api.ft.com/content/d6c3a1d6-9b08-11e7-8cf8-1a0da58f8a2a", original[membersField].([]Content)[0][id])
+	assert.Nil(t, Content(nil).deepClone())
+}
+
+func TestSchema_TracksUniqueUUIDsWithRefs(t *testing.T) {
+	imgUUID := "639cd952-149f-11e7-2ea7-a07ecd9ac73f"
+	embUUID := "d6c3a1d6-9b08-11e7-8cf8-1a0da58f8a2a"
+	mainImage := &ReferenceRule{Field: mainImageField, ExpandSets: true}
+	embedded := &ReferenceRule{Field: embeds, EmbeddedTypes: []string{DynamicContentType}, Resolve: ResolveInternal}
+
+	schema := newSchema()
+	schema.add(imgUUID, schemaRef{rule: mainImage, path: mainImageField})
+	schema.add(embUUID, schemaRef{rule: embedded, path: "embeds[0]"})
+	schema.add(imgUUID, schemaRef{rule: embedded, path: "embeds[1]"})
+	schema.add(embUUID, schemaRef{rule: embedded, path: "embeds[2]"})
+
+	assert.Equal(t, []string{imgUUID, embUUID}, schema.toArray())
+	var paths []string
+	for _, ref := range schema.refsTo(imgUUID) {
+		paths = append(paths, ref.path)
+	}
+	assert.Equal(t, []string{mainImageField, "embeds[1]"}, paths)
+	assert.Len(t, schema.refsTo(embUUID), 2)
+	assert.Equal(t, []string{imgUUID}, schema.setUUIDs(schema.toArray(), nil))
+	assert.Empty(t, schema.setUUIDs(schema.toArray(), map[string]string{imgUUID: cutoffMaxItems}))
+	assert.Equal(t, []schemaBatch{
+		{rule: mainImage, resolve: ResolvePublic, uuids: []string{imgUUID}},
+		{rule: embedded, resolve: ResolveInternal, uuids: []string{embUUID, imgUUID}},
+	}, schema.batches(), "The references of every rule should be read apart, once for every endpoint")
+}
@@ -0,0 +1,123 @@
+package content
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultMaxInFlight  = 64
+	DefaultMaxQueued    = 64
+	DefaultQueueTimeout = time.Second
+	DefaultRetryAfter   = time.Second
+)
+
+// ErrOverloaded is returned for requests shed as too many are already being unrolled.
+var ErrOverloaded = errors.New("too many unroll requests in flight")
+
+// ConcurrencyLimits bound how many requests are unrolled at the same time. Zero values are replaced by the defaults.
+type ConcurrencyLimits struct {
+	// MaxInFlight is the number of requests unrolled at the same time.
+	MaxInFlight int `yaml:"maxInFlight"`
+	// MaxQueued is the number of requests waiting for one of the requests in flight to complete. Requests over it
+	// are shed straight away.
+	MaxQueued int `yaml:"maxQueued"`
+	// QueueTimeout is the time a request waits in the queue for before being shed.
+	QueueTimeout time.Duration `yaml:"queueTimeout"`
+	// RetryAfter is the time shed requests are told to retry after.
+	RetryAfter time.Duration `yaml:"retryAfter"`
+}
+
+func (l ConcurrencyLimits) withDefaults() ConcurrencyLimits {
+	if l.MaxInFlight <= 0 {
+		l.MaxInFlight = DefaultMaxInFlight
+	}
+	if l.MaxQueued <= 0 {
+		l.MaxQueued = DefaultMaxQueued
+	}
+	if l.QueueTimeout <= 0 {
+		l.QueueTimeout = DefaultQueueTimeout
+	}
+	if l.RetryAfter <= 0 {
+		l.RetryAfter = DefaultRetryAfter
+	}
+	return l
+}
+
+// Limiter admits requests while fewer than the maximum are in flight, queueing a bounded number of the others.
+type Limiter struct {
+	limits   ConcurrencyLimits
+	inFlight chan struct{}
+	queued   chan struct{}
+}
+
+func NewLimiter(limits ConcurrencyLimits) *Limiter {
+	limits = limits.withDefaults()
+	return &Limiter{
+		limits:   limits,
+		inFlight: make(chan struct{}, limits.MaxInFlight),
+		queued:   make(chan struct{}, limits.MaxQueued),
+	}
+}
+
+// acquire waits for the request to be admitted. Requests which can't be queued, or are still queued at the end of
+// the queue timeout, fail with ErrOverloaded. The returned function must be called once the request completes.
+func (l *Limiter) acquire(ctx context.Context) (func(), error) {
+	release := func() { <-l.inFlight }
+	select {
+	case l.inFlight <- struct{}{}:
+		return release, nil
+	default:
+	}
+
+	select {
+	case l.queued <- struct{}{}:
+		defer func() { <-l.queued }()
+	default:
+		return nil, ErrOverloaded
+	}
+
+	timer := time.NewTimer(l.limits.QueueTimeout)
+	defer timer.Stop()
+	select {
+	case l.inFlight <- struct{}{}:
+		return release, nil
+	case <-timer.C:
+		return nil, ErrOverloaded
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// retryAfter returns the value of the Retry-After header sent with shed requests, in whole seconds.
+func (l *Limiter) retryAfter() string {
+	return strconv.Itoa(int(math.Ceil(l.limits.RetryAfter.Seconds())))
+}
+
+// WithConcurrencyLimits sheds the requests over the limits of the view they are for. The internal view can be given
+// its own limiter, so that a spike on one of the views doesn't starve the other one, or share the public one.
+func WithConcurrencyLimits(public *Limiter, internal *Limiter) HandlerOption {
+	return func(hh *Handler) {
+		hh.limiters = map[View]*Limiter{PublicView: public, InternalView: internal}
+	}
+}
+
+// admit waits for the request to be admitted by the limiter of the view, if any. Shed requests get a 503 response
+// and false is returned.
+func (hh *Handler) admit(w http.ResponseWriter, r *http.Request, view View, tid string) (func(), bool) {
+	limiter := hh.limiters[view]
+	if limiter == nil {
+		return func() {}, true
+	}
+	release, err := limiter.acquire(r.Context())
+	if err != nil {
+		w.Header().Set("Retry-After", limiter.retryAfter())
+		handleError(r, hh.log, tid, "", w, newUnrollError(CodeOverloaded, "", err))
+		return nil, false
+	}
+	return release, true
+}
@@ -0,0 +1,94 @@
+package content
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter_QueuesThenShedsRequests(t *testing.T) {
+	l := NewLimiter(ConcurrencyLimits{MaxInFlight: 1, MaxQueued: 1, QueueTimeout: time.Minute})
+	ctx := context.Background()
+
+	release, err := l.acquire(ctx)
+	assert.NoError(t, err)
+
+	admitted := make(chan func())
+	go func() {
+		queuedRelease, err := l.acquire(ctx)
+		assert.NoError(t, err, "The queued request should be admitted once a request in flight completes")
+		admitted <- queuedRelease
+	}()
+	assert.Eventually(t, func() bool { return len(l.queued) == 1 }, time.Second, time.Millisecond)
+
+	_, err = l.acquire(ctx)
+	assert.ErrorIs(t, err, ErrOverloaded, "Requests over the queue should be shed straight away")
+
+	release()
+	(<-admitted)()
+	assert.Empty(t, l.inFlight)
+	assert.Empty(t, l.queued)
+}
+
+func TestLimiter_ShedsRequestsQueuedForTooLong(t *testing.T) {
+	l := NewLimiter(ConcurrencyLimits{MaxInFlight: 1, MaxQueued: 1, QueueTimeout: 10 * time.Millisecond})
+	release, err := l.acquire(context.Background())
+	assert.NoError(t, err)
+	defer release()
+
+	_, err = l.acquire(context.Background())
+	assert.ErrorIs(t, err, ErrOverloaded)
+	assert.Empty(t, l.queued, "Shed requests should leave the queue")
+}
+
+func TestConcurrencyLimits_Defaults(t *testing.T) {
+	assert.Equal(t, ConcurrencyLimits{
+		MaxInFlight:  DefaultMaxInFlight,
+		MaxQueued:    DefaultMaxQueued,
+		QueueTimeout: DefaultQueueTimeout,
+		RetryAfter:   DefaultRetryAfter,
+	}, ConcurrencyLimits{}.withDefaults())
+}
+
+func TestGetContent_ShedsRequestsOverTheLimits(t *testing.T) {
+	public := NewLimiter(ConcurrencyLimits{MaxInFlight: 1, MaxQueued: 1, QueueTimeout: 10 * time.Millisecond, RetryAfter: 1500 * time.Millisecond})
+	internal := NewLimiter(ConcurrencyLimits{MaxInFlight: 1})
+	release, err := public.acquire(context.Background())
+	assert.NoError(t, err)
+	defer release()
+
+	reader := &ReaderMock{
+		mockGetInternal: func(_ []string, _ string) (map[string]Content, error) {
+			return map[string]Content{}, nil
+		},
+	}
+	h := NewHandler(
+		NewUniversalUnroller(reader, logger.NewUPPLogger("test-service", "Error"), "test.api.ft.com"),
+		logger.NewUPPLogger("test-service", "Error"),
+		Limits{},
+		WithConcurrencyLimits(public, internal),
+	)
+	body := []byte(`{"id":"http://www.ft.com/thing/22c0d426-1466-11e7-b0c1-37e417ee6c76","bodyXML":"<body></body>"}`)
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/content", bytes.NewReader(body))
+	http.HandlerFunc(h.GetContent).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"))
+	var p problem
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &p))
+	assert.Equal(t, CodeOverloaded, p.Code)
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPost, "/internalcontent", bytes.NewReader(body))
+	http.HandlerFunc(h.GetInternalContent).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Internal requests should not be shed by the limits of the public ones")
+}
@@ -0,0 +1,139 @@
+package content
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+// recordSpans installs a tracer provider recording the spans ended until the end of the test.
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+	return recorder
+}
+
+func TestTrace_SpansAcrossHandlerUnrollerAndReader(t *testing.T) {
+	recorder := recordSpans(t)
+
+	var mu sync.Mutex
+	var traceparents []string
+	contentStore := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		traceparents = append(traceparents, r.Header.Get("traceparent"))
+		mu.Unlock()
+		file, err := os.Open("testdata/source-content-valid-response.json")
+		if assert.NoError(t, err, "File necessary for starting mock server not found.") {
+			defer file.Close()
+			io.Copy(w, file)
+		}
+	}))
+	defer contentStore.Close()
+
+	reader := NewContentReader(ReaderConfig{
+		ContentStoreAppName: "content-source-app-name",
+		ContentStoreHost:    contentStore.URL,
+		ContentPathEndpoint: "/content",
+	}, http.DefaultClient)
+	log := logger.NewUPPLogger("test-service", "Error")
+	h := NewHandler(NewUniversalUnroller(reader, log, "test.api.ft.com"), log, Limits{})
+	r := mux.NewRouter()
+	r.Use(Trace())
+	r.HandleFunc("/content", h.GetContent)
+
+	body, err := os.ReadFile("testdata/content-valid-request.json")
+	assert.NoError(t, err, "Cannot read file necessary for test case")
+	req := httptest.NewRequest(http.MethodPost, "/content", strings.NewReader(string(body)))
+	req.Header.Set("traceparent", testTraceparent)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext().TraceID().String(), "Span %s should continue the trace of the caller", span.Name())
+		spans[span.Name()] = span
+	}
+	for _, name := range []string{"POST /content", "DefaultUnroller.Unroll", "resolveModelsForSetsMembers", "resolveImageSet", "GET /content"} {
+		assert.Contains(t, spans, name)
+	}
+	if server, unroll := spans["POST /content"], spans["DefaultUnroller.Unroll"]; server != nil && unroll != nil {
+		assert.Equal(t, server.SpanContext().SpanID(), unroll.Parent().SpanID())
+	}
+
+	assert.NotEmpty(t, traceparents)
+	for _, traceparent := range traceparents {
+		assert.True(t, strings.HasPrefix(traceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-"), "The trace context should be propagated to the content store, got %q", traceparent)
+	}
+}
+
+func TestDoGet_RecordsUUIDCountAndStatus(t *testing.T) {
+	recorder := recordSpans(t)
+	ts := errorContentServerMock(t, http.StatusServiceUnavailable)
+	defer ts.Close()
+
+	cr := NewContentReader(ReaderConfig{
+		ContentStoreAppName:         "content-source-app-name",
+		ContentStoreHost:            ts.URL,
+		InternalContentPathEndpoint: "/internalcontent",
+	}, http.DefaultClient)
+	_, err := cr.GetInternal(context.Background(), testData, "tid_sample")
+	assert.Error(t, err)
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 1) {
+		attrs := map[string]interface{}{}
+		for _, kv := range spans[0].Attributes() {
+			attrs[string(kv.Key)] = kv.Value.AsInterface()
+		}
+		assert.Equal(t, "GET /internalcontent", spans[0].Name())
+		assert.Equal(t, int64(len(testData)), attrs["content.uuid_count"])
+		assert.Equal(t, int64(http.StatusServiceUnavailable), attrs["http.response.status_code"])
+		assert.Equal(t, "Error", spans[0].Status().Code.String())
+	}
+}
+
+func TestSetupTracing(t *testing.T) {
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	_, err := SetupTracing(TracingConfig{Exporter: "zipkin"})
+	assert.EqualError(t, err, `unsupported traces exporter "zipkin", expected none, stdout, file or otlp`)
+
+	file := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := SetupTracing(TracingConfig{ServiceName: "content-unroller", Exporter: FileExporter, File: file})
+	assert.NoError(t, err)
+	_, span := startSpan(context.Background(), "unrollClipSet")
+	span.End()
+	assert.NoError(t, shutdown(context.Background()))
+
+	exported, err := os.ReadFile(file)
+	assert.NoError(t, err)
+	assert.Contains(t, string(exported), `"Name":"unrollClipSet"`)
+	assert.Contains(t, string(exported), `"Value":"content-unroller"`)
+}
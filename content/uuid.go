@@ -3,21 +3,16 @@ package content
 import (
 	"fmt"
 	"regexp"
-
-	"errors"
 )
 
 const uuidRegex = "([0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12})"
 
-func extractUUIDFromString(url string) (string, error) {
-	re, err := regexp.Compile(uuidRegex)
-	if err != nil {
-		return "", errors.Join(err, fmt.Errorf("error during extracting UUID"))
-	}
+// uuidPattern is compiled once, as UUIDs are extracted for every reference and every tag embedding content.
+var uuidPattern = regexp.MustCompile(uuidRegex)
 
-	values := re.FindStringSubmatch(url)
-	if len(values) > 0 {
-		return values[0], nil
+func extractUUIDFromString(url string) (string, error) {
+	if uuid := uuidPattern.FindString(url); uuid != "" {
+		return uuid, nil
 	}
 	return "", fmt.Errorf("cannot extract UUID from %s", url)
 }
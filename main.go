@@ -1,10 +1,15 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/Financial-Times/content-unroller/content"
@@ -14,6 +19,9 @@ import (
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	cli "github.com/jawher/mow.cli"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/sirupsen/logrus"
 )
 
 const (
@@ -60,6 +68,174 @@ func main() {
 		Desc:   "API host to use for URLs in responses",
 		EnvVar: "API_HOST",
 	})
+	maxRequestSize := app.Int(cli.IntOpt{
+		Name:   "maxRequestSize",
+		Value:  5 * 1024 * 1024,
+		Desc:   "Maximum size in bytes of the content sent for unrolling",
+		EnvVar: "MAX_REQUEST_SIZE",
+	})
+	maxUnrollDepth := app.Int(cli.IntOpt{
+		Name:   "maxUnrollDepth",
+		Value:  content.DefaultMaxDepth,
+		Desc:   "Maximum number of levels of related content expanded below the unrolled content",
+		EnvVar: "MAX_UNROLL_DEPTH",
+	})
+	maxUnrollItems := app.Int(cli.IntOpt{
+		Name:   "maxUnrollItems",
+		Value:  content.DefaultMaxItems,
+		Desc:   "Maximum number of related content items read while unrolling a single content",
+		EnvVar: "MAX_UNROLL_ITEMS",
+	})
+	maxUnrollFetches := app.Int(cli.IntOpt{
+		Name:   "maxUnrollFetches",
+		Value:  content.DefaultMaxFetches,
+		Desc:   "Maximum number of reads from the content store made while unrolling a single content",
+		EnvVar: "MAX_UNROLL_FETCHES",
+	})
+	unrollTimeout := app.String(cli.StringOpt{
+		Name:   "unrollTimeout",
+		Value:  content.DefaultTimeout.String(),
+		Desc:   "Time a single content has to be unrolled in, content not read by then is left unexpanded",
+		EnvVar: "UNROLL_TIMEOUT",
+	})
+	breakerFailures := app.Int(cli.IntOpt{
+		Name:   "breakerFailures",
+		Value:  content.DefaultBreakerFailures,
+		Desc:   "Number of consecutive failed reads from the content store after which it is not read for the cooldown",
+		EnvVar: "BREAKER_FAILURES",
+	})
+	breakerCooldown := app.String(cli.StringOpt{
+		Name:   "breakerCooldown",
+		Value:  content.DefaultBreakerCooldown.String(),
+		Desc:   "Time the content store is not read for after failing, before it is tried again",
+		EnvVar: "BREAKER_COOLDOWN",
+	})
+	degradedMode := app.Bool(cli.BoolOpt{
+		Name:   "degradedMode",
+		Value:  false,
+		Desc:   "Return content without unrolling it, instead of failing, while the content store is unavailable",
+		EnvVar: "DEGRADED_MODE",
+	})
+	maxInFlight := app.Int(cli.IntOpt{
+		Name:   "maxInFlight",
+		Value:  content.DefaultMaxInFlight,
+		Desc:   "Maximum number of requests unrolled at the same time",
+		EnvVar: "MAX_IN_FLIGHT",
+	})
+	maxQueued := app.Int(cli.IntOpt{
+		Name:   "maxQueued",
+		Value:  content.DefaultMaxQueued,
+		Desc:   "Maximum number of requests waiting to be unrolled, requests over it get a 503 response straight away",
+		EnvVar: "MAX_QUEUED",
+	})
+	internalMaxInFlight := app.Int(cli.IntOpt{
+		Name:   "internalMaxInFlight",
+		Value:  0,
+		Desc:   "Maximum number of internal content requests unrolled at the same time, 0 to share the limits of the public requests",
+		EnvVar: "INTERNAL_MAX_IN_FLIGHT",
+	})
+	internalMaxQueued := app.Int(cli.IntOpt{
+		Name:   "internalMaxQueued",
+		Value:  content.DefaultMaxQueued,
+		Desc:   "Maximum number of internal content requests waiting to be unrolled, when they have their own limits",
+		EnvVar: "INTERNAL_MAX_QUEUED",
+	})
+	queueTimeout := app.String(cli.StringOpt{
+		Name:   "queueTimeout",
+		Value:  content.DefaultQueueTimeout.String(),
+		Desc:   "Time a request waits to be unrolled for before getting a 503 response",
+		EnvVar: "QUEUE_TIMEOUT",
+	})
+	retryAfter := app.String(cli.StringOpt{
+		Name:   "retryAfter",
+		Value:  content.DefaultRetryAfter.String(),
+		Desc:   "Time requests getting a 503 response as the service is overloaded are told to retry after",
+		EnvVar: "RETRY_AFTER",
+	})
+	authConfig := app.String(cli.StringOpt{
+		Name:   "authConfig",
+		Value:  "",
+		Desc:   "YAML file with the API keys and HMAC secrets of the clients allowed to call the API, which is open when neither it nor the API keys are set",
+		EnvVar: "AUTH_CONFIG",
+	})
+	apiKeys := app.String(cli.StringOpt{
+		Name:   "apiKeys",
+		Value:  "",
+		Desc:   "Comma separated name=key API keys of the clients allowed to call the API, when there is no auth config file",
+		EnvVar: "API_KEYS",
+	})
+	rateLimitConfig := app.String(cli.StringOpt{
+		Name:   "rateLimitConfig",
+		Value:  "",
+		Desc:   "YAML file with the rate limits of the clients, which are not limited when it is not set",
+		EnvVar: "RATE_LIMIT_CONFIG",
+	})
+	expansionRules := app.String(cli.StringOpt{
+		Name:   "expansionRules",
+		Value:  "",
+		Desc:   "YAML or JSON file declaring the references expanded in each content type, the built-in rules are used when it is not set",
+		EnvVar: "EXPANSION_RULES",
+	})
+	tracesExporter := app.String(cli.StringOpt{
+		Name:   "tracesExporter",
+		Value:  content.NoExporter,
+		Desc:   "Where spans are exported to: none, stdout, file or otlp, configured with the OTEL_EXPORTER_OTLP_* variables",
+		EnvVar: "TRACES_EXPORTER",
+	})
+	tracesFile := app.String(cli.StringOpt{
+		Name:   "tracesFile",
+		Value:  "traces.json",
+		Desc:   "File spans are appended to by the file exporter",
+		EnvVar: "TRACES_FILE",
+	})
+	readTimeout := app.String(cli.StringOpt{
+		Name:   "readTimeout",
+		Value:  defaultReadTimeout.String(),
+		Desc:   "Time a request, including its body, has to be read in",
+		EnvVar: "READ_TIMEOUT",
+	})
+	readHeaderTimeout := app.String(cli.StringOpt{
+		Name:   "readHeaderTimeout",
+		Value:  defaultReadHeaderTimeout.String(),
+		Desc:   "Time the headers of a request have to be read in",
+		EnvVar: "READ_HEADER_TIMEOUT",
+	})
+	writeTimeout := app.String(cli.StringOpt{
+		Name:   "writeTimeout",
+		Value:  defaultWriteTimeout.String(),
+		Desc:   "Time a request has to be served in once its headers are read, it should be longer than the unroll timeout",
+		EnvVar: "WRITE_TIMEOUT",
+	})
+	idleTimeout := app.String(cli.StringOpt{
+		Name:   "idleTimeout",
+		Value:  defaultIdleTimeout.String(),
+		Desc:   "Time an idle keep-alive connection is kept open for",
+		EnvVar: "IDLE_TIMEOUT",
+	})
+	drainDelay := app.String(cli.StringOpt{
+		Name:   "drainDelay",
+		Value:  defaultDrainDelay.String(),
+		Desc:   "Time requests are still accepted for after SIGTERM, while __gtg is failing, before the server stops listening",
+		EnvVar: "DRAIN_DELAY",
+	})
+	shutdownGracePeriod := app.String(cli.StringOpt{
+		Name:   "shutdownGracePeriod",
+		Value:  defaultShutdownGracePeriod.String(),
+		Desc:   "Time the requests in flight have to complete in once the server stops listening",
+		EnvVar: "SHUTDOWN_GRACE_PERIOD",
+	})
+	configFile := app.String(cli.StringOpt{
+		Name:   "config",
+		Value:  "",
+		Desc:   "YAML or JSON config file overriding the options, reloaded on change or SIGHUP",
+		EnvVar: "CONFIG_FILE",
+	})
+	configPollInterval := app.String(cli.StringOpt{
+		Name:   "configPollInterval",
+		Value:  defaultConfigPollInterval.String(),
+		Desc:   "Time between checks of the config file for changes",
+		EnvVar: "CONFIG_POLL_INTERVAL",
+	})
 	logLevel := app.String(cli.StringOpt{
 		Name:   "logLevel",
 		Value:  "INFO",
@@ -70,6 +246,75 @@ func main() {
 	log := logger.NewUPPLogger(AppName, *logLevel)
 
 	app.Action = func() {
+		pollInterval := parseDuration(log, "config poll interval", *configPollInterval)
+		if pollInterval <= 0 {
+			log.Fatalf("Invalid config poll interval %s: must be positive", *configPollInterval)
+		}
+		options := config{
+			LogLevel:       *logLevel,
+			Port:           *port,
+			APIHost:        *apiHost,
+			MaxRequestSize: int64(*maxRequestSize),
+			ContentStore: content.ReaderConfig{
+				ContentStoreAppName:         *contentStoreApplicationName,
+				ContentStoreHost:            *contentStoreHost,
+				ContentPathEndpoint:         *contentPathEndpoint,
+				InternalContentPathEndpoint: *internalContentPathEndpoint,
+			},
+			Limits: content.Limits{
+				MaxDepth:   *maxUnrollDepth,
+				MaxItems:   *maxUnrollItems,
+				MaxFetches: *maxUnrollFetches,
+				Timeout:    parseDuration(log, "unroll timeout", *unrollTimeout),
+			},
+			DegradedMode: *degradedMode,
+			Breaker: breakerConfig{
+				Failures: *breakerFailures,
+				Cooldown: parseDuration(log, "breaker cooldown", *breakerCooldown),
+			},
+			Concurrency: concurrencyConfig{
+				ConcurrencyLimits: content.ConcurrencyLimits{
+					MaxInFlight:  *maxInFlight,
+					MaxQueued:    *maxQueued,
+					QueueTimeout: parseDuration(log, "queue timeout", *queueTimeout),
+					RetryAfter:   parseDuration(log, "retry after", *retryAfter),
+				},
+				InternalMaxInFlight: *internalMaxInFlight,
+				InternalMaxQueued:   *internalMaxQueued,
+			},
+			Server: serverConfig{
+				ReadTimeout:       parseDuration(log, "read timeout", *readTimeout),
+				ReadHeaderTimeout: parseDuration(log, "read header timeout", *readHeaderTimeout),
+				WriteTimeout:      parseDuration(log, "write timeout", *writeTimeout),
+				IdleTimeout:       parseDuration(log, "idle timeout", *idleTimeout),
+				DrainDelay:        parseDuration(log, "drain delay", *drainDelay),
+				GracePeriod:       parseDuration(log, "shutdown grace period", *shutdownGracePeriod),
+			},
+			// the service name can't be set in the config file, so the reloaded configs keep it too
+			Tracing:    content.TracingConfig{ServiceName: AppCode, Exporter: *tracesExporter, File: *tracesFile},
+			RateLimits: *rateLimitConfig,
+			Auth:       *authConfig,
+			APIKeys:    *apiKeys,
+			Rules:      *expansionRules,
+		}
+		cfg := options
+		if *configFile != "" {
+			var err error
+			if cfg, err = loadConfig(*configFile, options); err != nil {
+				log.Fatalf("Unable to load config: %v", err)
+			}
+		} else if err := cfg.validate(); err != nil {
+			log.Fatalf("Invalid options: %v", err)
+		}
+		level, _ := logrus.ParseLevel(cfg.LogLevel)
+		log.SetLevel(level)
+
+		shutdownTracing, err := content.SetupTracing(cfg.Tracing)
+		if err != nil {
+			log.Fatalf("Unable to set up tracing: %v", err)
+		}
+		defer shutdownTracing(context.Background())
+
 		httpClient := &http.Client{
 			Timeout: 10 * time.Second,
 			Transport: &http.Transport{
@@ -80,28 +325,88 @@ func main() {
 			},
 		}
 
+		breaker := content.NewBreaker(cfg.Breaker.Failures, cfg.Breaker.Cooldown)
+		degraded := &atomic.Bool{}
+		degraded.Store(cfg.DegradedMode)
+
 		sc := content.ServiceConfig{
-			ContentStoreAppName:      *contentStoreApplicationName,
-			ContentStoreAppHealthURI: getServiceHealthURI(*contentStoreHost),
+			ContentStoreAppName:      cfg.ContentStore.ContentStoreAppName,
+			ContentStoreAppHealthURI: getServiceHealthURI(cfg.ContentStore.ContentStoreHost),
 			HTTPClient:               httpClient,
+			Breaker:                  breaker,
+			DegradedMode:             degraded,
+			Draining:                 &atomic.Bool{},
 		}
 
-		readerConfig := content.ReaderConfig{
-			ContentStoreAppName:         *contentStoreApplicationName,
-			ContentStoreHost:            *contentStoreHost,
-			ContentPathEndpoint:         *contentPathEndpoint,
-			InternalContentPathEndpoint: *internalContentPathEndpoint,
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+		metrics := content.NewPrometheusMetrics(registry)
+
+		readerConfig := cfg.ContentStore
+		readerConfig.Metrics = metrics
+		reader := content.NewBreakingReader(content.NewContentReader(readerConfig, httpClient), breaker)
+		var unrollerOptions []content.UnrollerOption
+		if cfg.Rules != "" {
+			rules, err := content.LoadRules(cfg.Rules)
+			if err != nil {
+				log.Fatalf("Unable to load expansion rules: %v", err)
+			}
+			unrollerOptions = append(unrollerOptions, content.WithRules(rules))
+		}
+		unroller := content.NewUniversalUnroller(reader, log, cfg.APIHost, unrollerOptions...)
+		concurrencyLimits := cfg.Concurrency.ConcurrencyLimits
+		publicLimiter := content.NewLimiter(concurrencyLimits)
+		internalLimiter := publicLimiter
+		if cfg.Concurrency.InternalMaxInFlight > 0 {
+			concurrencyLimits.MaxInFlight, concurrencyLimits.MaxQueued = cfg.Concurrency.InternalMaxInFlight, cfg.Concurrency.InternalMaxQueued
+			internalLimiter = content.NewLimiter(concurrencyLimits)
 		}
+		handler := content.NewHandler(unroller, log, cfg.Limits,
+			content.WithMetrics(metrics),
+			content.WithConcurrencyLimits(publicLimiter, internalLimiter),
+			content.WithDegradedModeSwitch(breaker, degraded),
+		)
 
-		reader := content.NewContentReader(readerConfig, httpClient)
-		unroller := content.NewUniversalUnroller(reader, log, *apiHost)
-		handler := content.NewHandler(unroller, log)
+		var rateLimiter *content.RateLimiter
+		if cfg.RateLimits != "" {
+			rateLimits, err := content.LoadRateLimitConfig(cfg.RateLimits)
+			if err != nil {
+				log.Fatalf("Unable to load rate limits: %v", err)
+			}
+			rateLimiter = content.NewRateLimiter(rateLimits, metrics)
+		}
 
-		h := setupServiceHandler(sc, *handler)
-		err := http.ListenAndServe(":"+*port, h)
+		authenticator, err := loadAuthenticator(cfg.Auth, cfg.APIKeys)
+		if err != nil {
+			log.Fatalf("Unable to load clients: %v", err)
+		}
+
+		if *configFile != "" {
+			rl := newReloader(*configFile, options, cfg, func(cfg config) {
+				level, _ := logrus.ParseLevel(cfg.LogLevel)
+				log.SetLevel(level)
+				handler.SetLimits(cfg.Limits)
+				degraded.Store(cfg.DegradedMode)
+			}, log)
+			hup := make(chan os.Signal, 1)
+			signal.Notify(hup, syscall.SIGHUP)
+			done := make(chan struct{})
+			defer close(done)
+			go rl.watch(pollInterval, hup, done)
+		}
+
+		h := setupServiceHandler(sc, handler, metrics, authenticator, rateLimiter, log, cfg.MaxRequestSize)
+		srv := newServer(":"+cfg.Port, h, cfg.Server)
+		ln, err := net.Listen("tcp", srv.Addr)
 		if err != nil {
 			log.Fatalf("Unable to start server: %v", err)
 		}
+
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+		if err := serve(srv, ln, stop, sc.Draining, cfg.Server, log); err != nil {
+			log.WithError(err).Error("Server did not shut down cleanly")
+		}
 	}
 
 	log.Infof("Application started with args %s", os.Args)
@@ -111,30 +416,84 @@ func main() {
 	}
 }
 
-func setupServiceHandler(sc content.ServiceConfig, handler content.Handler) *mux.Router {
+func setupServiceHandler(sc content.ServiceConfig, handler *content.Handler, metrics *content.PrometheusMetrics, authenticator *content.Authenticator, rateLimiter *content.RateLimiter, log *logger.UPPLogger, maxRequestSize int64) *mux.Router {
 	r := mux.NewRouter()
 
-	var checks []fthealth.Check
 	var gtgHandler func(http.ResponseWriter, *http.Request)
 
-	r.HandleFunc("/content", handler.GetContent).Methods("POST")
-	r.HandleFunc("/internalcontent", handler.GetInternalContent).Methods("POST")
-	checks = []fthealth.Check{sc.ContentStoreCheck()}
+	api := r.NewRoute().Subrouter()
+	api.Use(
+		content.Trace(),
+		content.Instrument(metrics),
+		content.RecoverPanics(log),
+		content.Timing(log),
+		content.MaxRequestSize(maxRequestSize),
+	)
+	if rateLimiter != nil {
+		api.Use(content.LimitRateByAddress(rateLimiter, log))
+	}
+	if authenticator != nil {
+		api.Use(content.Authenticate(authenticator, log))
+	}
+	if rateLimiter != nil {
+		api.Use(content.LimitRate(rateLimiter, log))
+	}
+	api.Use(content.RequireJSON(log))
+	api.HandleFunc("/content", handler.GetContent).Methods("POST")
+	api.HandleFunc("/internalcontent", handler.GetInternalContent).Methods("POST")
+	api.HandleFunc("/content/plan", handler.GetContentPlan).Methods("POST")
+	api.HandleFunc("/internalcontent/plan", handler.GetInternalContentPlan).Methods("POST")
 	gtgHandler = httphandlers.NewGoodToGoHandler(sc.GtgCheck)
 
 	r.Path(httphandlers.BuildInfoPath).HandlerFunc(httphandlers.BuildInfoHandler)
 	r.Path(httphandlers.PingPath).HandlerFunc(httphandlers.PingHandler)
 
-	hc := fthealth.TimedHealthCheck{
-		HealthCheck: fthealth.HealthCheck{SystemCode: AppCode, Name: AppName, Description: AppDesc, Checks: checks},
-		Timeout:     10 * time.Second,
+	// the checks are built for every run, as degraded mode can be switched on and off while the service runs
+	healthHandler := func(w http.ResponseWriter, req *http.Request) {
+		hc := fthealth.TimedHealthCheck{
+			HealthCheck: fthealth.HealthCheck{SystemCode: AppCode, Name: AppName, Description: AppDesc, Checks: sc.Checks()},
+			Timeout:     10 * time.Second,
+		}
+		fthealth.Handler(&hc)(w, req)
 	}
 
-	r.Path("/__health").Handler(handlers.MethodHandler{"GET": http.HandlerFunc(fthealth.Handler(&hc))})
+	r.Path("/__health").Handler(handlers.MethodHandler{"GET": http.HandlerFunc(healthHandler)})
+	r.Path("/metrics").Handler(handlers.MethodHandler{"GET": metrics.Handler()})
 	r.Path("/__gtg").Handler(handlers.MethodHandler{"GET": http.HandlerFunc(gtgHandler)})
 	return r
 }
 
+func parseDuration(log *logger.UPPLogger, name string, value string) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid %s %s: %v", name, value, err)
+	}
+	return d
+}
+
+// loadAuthenticator returns the authenticator of the clients in the auth config file or the API keys, or nil when
+// neither are set and the API is open.
+func loadAuthenticator(configPath string, apiKeys string) (*content.Authenticator, error) {
+	var (
+		cfg content.AuthConfig
+		err error
+	)
+	switch {
+	case configPath != "" && apiKeys != "":
+		return nil, errors.New("only one of the auth config file and the API keys can be set")
+	case configPath != "":
+		cfg, err = content.LoadAuthConfig(configPath)
+	case apiKeys != "":
+		cfg, err = content.ParseAPIKeys(apiKeys)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return content.NewAuthenticator(cfg), nil
+}
+
 func getServiceHealthURI(hostname string) string {
 	return fmt.Sprintf("%s%s", hostname, "/__health")
 }
@@ -13,11 +13,13 @@ import (
 	"github.com/Financial-Times/go-logger/v2"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 )
 
 const (
 	contentStoreAppName = "content-source-app-name"
+	testMaxRequestSize  = 1024 * 1024
 )
 
 func TestContent_ShouldReturn200(t *testing.T) {
@@ -69,6 +71,33 @@ func TestContent_ShouldReturn400WhenInvalidContentRequest(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
 }
 
+func TestContent_ShouldReturn415WhenBodyIsNotJSON(t *testing.T) {
+	contentStoreServiceMock := startContentServerMock("testdata/source-content-valid-response.json")
+	srv := startUnrollerService(contentStoreServiceMock.URL)
+	defer contentStoreServiceMock.Close()
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/content", "text/plain", strings.NewReader(`{"id":"36037ab1-da3b-35bf-b5ee-4fc23723b635"}`))
+	assert.NoError(t, err, "")
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+}
+
+func TestContent_ShouldReturn413WhenBodyIsTooLarge(t *testing.T) {
+	contentStoreServiceMock := startContentServerMock("testdata/source-content-valid-response.json")
+	srv := startUnrollerService(contentStoreServiceMock.URL)
+	defer contentStoreServiceMock.Close()
+	defer srv.Close()
+
+	body := `{"id":"36037ab1-da3b-35bf-b5ee-4fc23723b635","bodyXML":"` + strings.Repeat("a", testMaxRequestSize) + `"}`
+	resp, err := http.Post(srv.URL+"/content", "application/json", strings.NewReader(body))
+	assert.NoError(t, err, "")
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+}
+
 func TestInternalContent_ShouldReturn200(t *testing.T) {
 	contentStoreServiceMock := startContentServerMock("testdata/internalcontent-source-valid-response.json")
 	srv := startUnrollerService(contentStoreServiceMock.URL)
@@ -163,6 +192,95 @@ func TestShouldNotBeGoodToGoWhenContentStoreIsNotHappy(t *testing.T) {
 	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode, "Response status should be 503")
 }
 
+func TestContentPlan_ShouldReturn200WithoutReadingContent(t *testing.T) {
+	contentStoreServiceMock := startUnhealthyContentServerMock()
+	srv := startUnrollerService(contentStoreServiceMock.URL)
+	defer contentStoreServiceMock.Close()
+	defer srv.Close()
+
+	for _, path := range []string{"/content/plan", "/internalcontent/plan"} {
+		body, err := os.ReadFile("testdata/internalcontent-valid-request.json")
+		assert.NoError(t, err, "Cannot read file necessary for test case")
+		resp, err := http.Post(srv.URL+path, "application/json", bytes.NewReader(body))
+		assert.NoError(t, err, "Should not fail")
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusOK, resp.StatusCode, path)
+		actualResponse, err := io.ReadAll(resp.Body)
+		assert.NoError(t, err, "")
+		assert.Contains(t, string(actualResponse), `"reads":[[`, path)
+	}
+}
+
+func TestMetrics_ShouldCountRequestsAndReads(t *testing.T) {
+	contentStoreServiceMock := startContentServerMock("testdata/source-content-valid-response.json")
+	srv := startUnrollerService(contentStoreServiceMock.URL)
+	defer contentStoreServiceMock.Close()
+	defer srv.Close()
+
+	body, err := os.ReadFile("testdata/content-valid-request.json")
+	assert.NoError(t, err, "Cannot read file necessary for test case")
+	resp, err := http.Post(srv.URL+"/content", "application/json", bytes.NewReader(body))
+	assert.NoError(t, err, "Should not fail")
+	resp.Body.Close()
+
+	resp, err = http.Get(srv.URL + "/metrics")
+	assert.NoError(t, err, "")
+	defer resp.Body.Close()
+	metrics, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err, "")
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(metrics), `content_unroller_requests_total{content_type="Article",endpoint="/content",status="200"} 1`)
+	assert.Contains(t, string(metrics), `content_unroller_request_duration_seconds_count{content_type="Article",endpoint="/content"} 1`)
+	assert.Contains(t, string(metrics), `content_unroller_upstream_requests_total{status="200",target=""}`)
+	assert.Contains(t, string(metrics), `content_unroller_expansions_total{field="mainImage"} 1`)
+}
+
+func TestAuth_ShouldProtectOnlyTheAPIEndpoints(t *testing.T) {
+	contentStoreServiceMock := startContentServerMock("testdata/source-content-valid-response.json")
+	authenticator, err := loadAuthenticator("", "next-article=secret-key")
+	assert.NoError(t, err)
+	srv := startAuthenticatedUnrollerService(contentStoreServiceMock.URL, authenticator)
+	defer contentStoreServiceMock.Close()
+	defer srv.Close()
+
+	body, err := os.ReadFile("testdata/content-valid-request.json")
+	assert.NoError(t, err, "Cannot read file necessary for test case")
+	for key, expectedStatus := range map[string]int{"": http.StatusUnauthorized, "wrong-key": http.StatusUnauthorized, "secret-key": http.StatusOK} {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/content", bytes.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("X-Api-Key", key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err, "Should not fail")
+		resp.Body.Close()
+		assert.Equal(t, expectedStatus, resp.StatusCode, "API key %q", key)
+	}
+
+	for _, path := range []string{"/__gtg", "/__health", "/__ping", "/__build-info", "/metrics"} {
+		resp, err := http.Get(srv.URL + path)
+		assert.NoError(t, err, "Cannot send request to %s", path)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "Admin endpoint %s should stay open", path)
+	}
+}
+
+func TestLoadAuthenticator(t *testing.T) {
+	authenticator, err := loadAuthenticator("", "")
+	assert.NoError(t, err)
+	assert.Nil(t, authenticator, "The API should be open without clients")
+
+	_, err = loadAuthenticator("content/testdata/auth.yaml", "next-article=secret-key")
+	assert.Error(t, err, "Only one of the config file and the API keys should be set")
+
+	authenticator, err = loadAuthenticator("content/testdata/auth.yaml", "")
+	assert.NoError(t, err)
+	assert.NotNil(t, authenticator)
+}
+
 func startContentServerMock(resource string) *httptest.Server {
 	router := mux.NewRouter()
 	router.Path("/__health").Handler(handlers.MethodHandler{"GET": http.HandlerFunc(statusOkHandler)})
@@ -200,6 +318,10 @@ func statusServiceUnavailableHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func startUnrollerService(contentStoreURL string) *httptest.Server {
+	return startAuthenticatedUnrollerService(contentStoreURL, nil)
+}
+
+func startAuthenticatedUnrollerService(contentStoreURL string, authenticator *content.Authenticator) *httptest.Server {
 	sc := content.ServiceConfig{
 		ContentStoreAppName:      contentStoreAppName,
 		ContentStoreAppHealthURI: getServiceHealthURI(contentStoreURL),
@@ -213,11 +335,13 @@ func startUnrollerService(contentStoreURL string) *httptest.Server {
 		InternalContentPathEndpoint: "",
 	}
 
+	metrics := content.NewPrometheusMetrics(prometheus.NewRegistry())
+	rc.Metrics = metrics
 	reader := content.NewContentReader(rc, http.DefaultClient)
 	testLogger := logger.NewUPPLogger("test-service", "Error")
 	unroller := content.NewUniversalUnroller(reader, testLogger, contentStoreURL)
-	handler := content.NewHandler(unroller, testLogger)
+	handler := content.NewHandler(unroller, testLogger, content.Limits{}, content.WithMetrics(metrics))
 
-	h := setupServiceHandler(sc, *handler)
+	h := setupServiceHandler(sc, handler, metrics, authenticator, nil, testLogger, testMaxRequestSize)
 	return httptest.NewServer(h)
 }
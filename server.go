@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/Financial-Times/go-logger/v2"
+)
+
+const (
+	defaultReadTimeout       = 10 * time.Second
+	defaultReadHeaderTimeout = 5 * time.Second
+	// the write timeout covers unrolling, so it is longer than the default unroll timeout
+	defaultWriteTimeout        = 15 * time.Second
+	defaultIdleTimeout         = 60 * time.Second
+	defaultDrainDelay          = 5 * time.Second
+	defaultShutdownGracePeriod = 20 * time.Second
+)
+
+// serverConfig holds the timeouts of the HTTP server and how it shuts down.
+type serverConfig struct {
+	ReadTimeout       time.Duration `yaml:"readTimeout"`
+	ReadHeaderTimeout time.Duration `yaml:"readHeaderTimeout"`
+	WriteTimeout      time.Duration `yaml:"writeTimeout"`
+	IdleTimeout       time.Duration `yaml:"idleTimeout"`
+	// DrainDelay is the time the server keeps accepting requests once it is not good to go anymore, so that the
+	// load balancer stops sending it new requests before it stops listening.
+	DrainDelay time.Duration `yaml:"drainDelay"`
+	// GracePeriod is the time the requests in flight have to complete once the server stops listening.
+	GracePeriod time.Duration `yaml:"shutdownGracePeriod"`
+}
+
+func newServer(addr string, h http.Handler, cfg serverConfig) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// serve serves requests from ln until a signal is received on stop. The service is then marked as draining, which
+// fails the good to go check, keeps serving for the drain delay, and shuts down once the requests in flight
+// complete. Requests still in flight at the end of the grace period are cut off and reported as an error.
+func serve(srv *http.Server, ln net.Listener, stop <-chan os.Signal, draining *atomic.Bool, cfg serverConfig, log *logger.UPPLogger) error {
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(ln)
+	}()
+
+	select {
+	case err := <-served:
+		return err
+	case sig := <-stop:
+		log.Infof("Received %v, draining requests for %v before shutting down", sig, cfg.DrainDelay)
+	}
+
+	draining.Store(true)
+	time.Sleep(cfg.DrainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.GracePeriod)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		srv.Close()
+		return fmt.Errorf("requests in flight did not complete within %v: %w", cfg.GracePeriod, err)
+	}
+	if err := <-served; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	log.Info("Server shut down")
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Financial-Times/content-unroller/content"
+	"github.com/Financial-Times/go-logger/v2"
+	"github.com/Financial-Times/service-status-go/httphandlers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewServer_AppliesTimeouts(t *testing.T) {
+	cfg := serverConfig{
+		ReadTimeout:       time.Second,
+		ReadHeaderTimeout: 2 * time.Second,
+		WriteTimeout:      3 * time.Second,
+		IdleTimeout:       4 * time.Second,
+	}
+	srv := newServer(":9090", http.NotFoundHandler(), cfg)
+
+	assert.Equal(t, ":9090", srv.Addr)
+	assert.Equal(t, time.Second, srv.ReadTimeout)
+	assert.Equal(t, 2*time.Second, srv.ReadHeaderTimeout)
+	assert.Equal(t, 3*time.Second, srv.WriteTimeout)
+	assert.Equal(t, 4*time.Second, srv.IdleTimeout)
+}
+
+type testServer struct {
+	url      string
+	stop     chan os.Signal
+	draining *atomic.Bool
+	served   chan error
+}
+
+// startTestServer serves h together with the good to go endpoint of a service which is otherwise always good to go.
+func startTestServer(t *testing.T, h http.HandlerFunc, cfg serverConfig) *testServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen: %v", err)
+	}
+	ts := &testServer{
+		url:      "http://" + ln.Addr().String(),
+		stop:     make(chan os.Signal, 1),
+		draining: &atomic.Bool{},
+		served:   make(chan error, 1),
+	}
+	degraded := &atomic.Bool{}
+	degraded.Store(true)
+	sc := content.ServiceConfig{DegradedMode: degraded, Draining: ts.draining}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", h)
+	mux.HandleFunc("/__gtg", httphandlers.NewGoodToGoHandler(sc.GtgCheck))
+
+	srv := newServer(ln.Addr().String(), mux, cfg)
+	go func() {
+		ts.served <- serve(srv, ln, ts.stop, ts.draining, cfg, logger.NewUPPLogger("test-service", "Error"))
+	}()
+	return ts
+}
+
+func (ts *testServer) get(path string) (int, error) {
+	resp, err := http.Get(ts.url + path)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+func TestServe_DrainsRequestsInFlightOnSIGTERM(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	ts := startTestServer(t, func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusOK)
+	}, serverConfig{DrainDelay: 200 * time.Millisecond, GracePeriod: 5 * time.Second})
+
+	status, err := ts.get("/__gtg")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, status, "The service should be good to go before shutting down")
+
+	inFlight := make(chan int, 1)
+	go func() {
+		status, err := ts.get("/slow")
+		assert.NoError(t, err, "The request in flight should not be cut off")
+		inFlight <- status
+	}()
+	<-started
+
+	ts.stop <- syscall.SIGTERM
+	assert.Eventually(t, ts.draining.Load, time.Second, 10*time.Millisecond)
+	status, err = ts.get("/__gtg")
+	assert.NoError(t, err, "Requests should still be accepted during the drain delay")
+	assert.Equal(t, http.StatusServiceUnavailable, status, "The service should not be good to go while draining")
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-inFlight)
+	select {
+	case err := <-ts.served:
+		assert.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("The server should shut down once the requests in flight complete")
+	}
+
+	_, err = ts.get("/__gtg")
+	assert.Error(t, err, "The server should not accept requests once shut down")
+}
+
+func TestServe_CutsOffRequestsOverTheGracePeriod(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	defer close(release)
+	ts := startTestServer(t, func(w http.ResponseWriter, _ *http.Request) {
+		close(started)
+		<-release
+	}, serverConfig{GracePeriod: 100 * time.Millisecond})
+
+	go ts.get("/slow")
+	<-started
+	ts.stop <- syscall.SIGTERM
+
+	select {
+	case err := <-ts.served:
+		assert.ErrorContains(t, err, "requests in flight did not complete within 100ms")
+	case <-time.After(5 * time.Second):
+		t.Fatal("The server should shut down at the end of the grace period")
+	}
+}